@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// gAbiToGoTypeMap maps the built-in ABI types to the Go types used for them
+// in generated code.
+var gAbiToGoTypeMap = map[string]string{
+	"bool":    "bool",
+	"int8":    "int8",
+	"uint8":   "uint8",
+	"int16":   "int16",
+	"uint16":  "uint16",
+	"int32":   "int32",
+	"uint32":  "uint32",
+	"int64":   "int64",
+	"uint64":  "uint64",
+	"float32": "float32",
+	"float64": "float64",
+	"string":  "string",
+
+	"int128":               "chain.Int128",
+	"uint128":              "chain.Uint128",
+	"varint32":             "chain.VarInt32",
+	"varuint32":            "chain.VarUint32",
+	"float128":             "chain.Float128",
+	"time_point":           "chain.TimePoint",
+	"time_point_sec":       "chain.TimePointSec",
+	"block_timestamp_type": "chain.BlockTimestampType",
+	"name":                 "chain.Name",
+	"checksum160":          "chain.Checksum160",
+	"checksum256":          "chain.Checksum256",
+	"checksum512":          "chain.Checksum512",
+	"public_key":           "chain.PublicKey",
+	"signature":            "chain.Signature",
+	"symbol":               "chain.Symbol",
+	"symbol_code":          "chain.SymbolCode",
+	"asset":                "chain.Asset",
+	"extended_asset":       "chain.ExtendedAsset",
+}
+
+// bindingWrapper is an optional or binary extension type of the ABI. It is
+// generated as a struct like the //optional and //binary_extension structs
+// of contracts, with the value in the exported Value field.
+type bindingWrapper struct {
+	name   string
+	typ    int
+	member StructMember
+}
+
+// BindingGenerator generates Go bindings for the ABI of another contract:
+// structs with Pack, Unpack and Size methods, readers for its tables and
+// functions that send its actions as inline actions. The code to serialize
+// the structs is generated by the code generator for contracts.
+type BindingGenerator struct {
+	*CodeGenerator
+	abi         *ABI
+	packageName string
+	account     string
+	typeDefs    map[string]string
+	structs     map[string]*ABIStruct
+	variants    map[string]*VariantDef
+	wrappers    []bindingWrapper
+	wrapperMap  map[string]string
+}
+
+// ReadABIFile reads an ABI file. ABIs generated by other tools may have
+// error messages and ABI extensions, which are not needed for bindings and
+// are skipped.
+func ReadABIFile(abiFile string) (*ABI, error) {
+	data, err := ioutil.ReadFile(abiFile)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		ABI
+		ErrorMessages json.RawMessage `json:"error_messages"`
+		AbiExtensions json.RawMessage `json:"abi_extensions"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", abiFile, err)
+	}
+	return &file.ABI, nil
+}
+
+// NewBindingGenerator returns a generator for the bindings of abi in the
+// package packageName. If account is not empty, it is used as the account
+// of the contract by the generated functions.
+func NewBindingGenerator(abi *ABI, packageName string, account string) *BindingGenerator {
+	g := &BindingGenerator{
+		CodeGenerator: NewCodeGenerator(),
+		abi:           abi,
+		packageName:   packageName,
+		account:       account,
+		typeDefs:      make(map[string]string),
+		structs:       make(map[string]*ABIStruct),
+		variants:      make(map[string]*VariantDef),
+		wrapperMap:    make(map[string]string),
+	}
+	for _, typeDef := range abi.Types {
+		g.typeDefs[typeDef.NewTypeName] = typeDef.Type
+	}
+	for i := range abi.Structs {
+		g.structs[abi.Structs[i].Name] = &abi.Structs[i]
+	}
+	for i := range abi.Variants {
+		g.variants[abi.Variants[i].Name] = &abi.Variants[i]
+	}
+	return g
+}
+
+// GenerateBindings generates the bindings for the ABI in abiFile and writes
+// them to outFile, or to stdout if outFile is empty.
+func GenerateBindings(abiFile string, packageName string, account string, outFile string) error {
+	if packageName == "" {
+		return errors.New("no package name supplied (-package)")
+	}
+	if account != "" && !IsNameValid(account) {
+		return fmt.Errorf("invalid account name: %s", account)
+	}
+	abi, err := ReadABIFile(abiFile)
+	if err != nil {
+		return err
+	}
+	code, err := NewBindingGenerator(abi, packageName, account).Generate()
+	if err != nil {
+		return err
+	}
+	if outFile == "" {
+		_, err = os.Stdout.Write(code)
+		return err
+	}
+	return ioutil.WriteFile(outFile, code, 0644)
+}
+
+// goName turns an ABI name like currency_stats into an exported Go name like
+// CurrencyStats.
+func goName(name string) string {
+	name = strings.NewReplacer("[]", "_array", "[", "_array", "]", "", "?", "", "$", "").Replace(name)
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '.' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	s := b.String()
+	if s == "" || !token.IsIdentifier(s) {
+		s = "X" + s
+	}
+	return s
+}
+
+// paramName turns the Go name of a field into a Go parameter name.
+func paramName(name string) string {
+	s := strings.ToLower(name[:1]) + name[1:]
+	// auth is a parameter of the send functions, and v and a are their
+	// variables.
+	if token.IsKeyword(s) || s == "auth" || s == "v" || s == "a" {
+		s += "_"
+	}
+	return s
+}
+
+// resolveType returns the description of the Go type of abiType.
+func (g *BindingGenerator) resolveType(abiType string) (*containerType, error) {
+	for i := 0; ; i++ {
+		typ, ok := g.typeDefs[abiType]
+		if !ok {
+			break
+		}
+		if i == len(g.typeDefs) {
+			return nil, fmt.Errorf("recursive type %s", abiType)
+		}
+		abiType = typ
+	}
+
+	leaf := func(goType string) *containerType {
+		return &containerType{
+			kind:   CONTAINER_NONE,
+			goType: goType,
+			value:  StructMember{Type: goType, LeadingType: TYPE_NORMAL},
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(abiType, "?") || strings.HasSuffix(abiType, "$"):
+		name, err := g.wrapper(abiType)
+		if err != nil {
+			return nil, err
+		}
+		return leaf(name), nil
+	case strings.HasSuffix(abiType, "]"):
+		start := strings.LastIndex(abiType, "[")
+		if start <= 0 {
+			return nil, fmt.Errorf("invalid type %s", abiType)
+		}
+		elem, err := g.resolveType(abiType[:start])
+		if err != nil {
+			return nil, err
+		}
+		length := abiType[start+1 : len(abiType)-1]
+		if length == "" {
+			return &containerType{kind: CONTAINER_SLICE, goType: "[]" + elem.goType, elem: elem}, nil
+		}
+		n, err := strconv.ParseInt(length, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid array type %s", abiType)
+		}
+		return &containerType{kind: CONTAINER_ARRAY, goType: "[" + length + "]" + elem.goType, elem: elem, length: n}, nil
+	case abiType == "bytes":
+		return &containerType{kind: CONTAINER_SLICE, goType: "[]byte", elem: leaf("byte")}, nil
+	}
+
+	if goType, ok := gAbiToGoTypeMap[abiType]; ok {
+		return leaf(goType), nil
+	}
+	if _, ok := g.structs[abiType]; ok {
+		return leaf(goName(abiType)), nil
+	}
+	if _, ok := g.variants[abiType]; ok {
+		return leaf(goName(abiType)), nil
+	}
+	return nil, fmt.Errorf("unknown ABI type %s", abiType)
+}
+
+// wrapper returns the name of the struct generated for the optional or
+// binary extension type abiType.
+func (g *BindingGenerator) wrapper(abiType string) (string, error) {
+	if name, ok := g.wrapperMap[abiType]; ok {
+		return name, nil
+	}
+	w := bindingWrapper{}
+	valueType := abiType[:len(abiType)-1]
+	if strings.HasSuffix(abiType, "?") {
+		w.typ = OptionalType
+		w.name = "Optional" + goName(valueType)
+	} else {
+		w.typ = BinaryExtensionType
+		w.name = "BinaryExtension" + goName(valueType)
+	}
+	g.wrapperMap[abiType] = w.name
+	member, err := g.member("Value", valueType)
+	if err != nil {
+		return "", err
+	}
+	w.member = member
+	g.wrappers = append(g.wrappers, w)
+	return w.name, nil
+}
+
+// member returns the struct member with the given Go name for a field of
+// type abiType.
+func (g *BindingGenerator) member(name string, abiType string) (StructMember, error) {
+	c, err := g.resolveType(abiType)
+	if err != nil {
+		return StructMember{}, err
+	}
+	member := StructMember{Name: name, Type: c.goType, LeadingType: TYPE_NORMAL}
+	switch {
+	case c.kind == CONTAINER_SLICE && c.elem.kind == CONTAINER_NONE:
+		member.Type = c.elem.goType
+		member.LeadingType = TYPE_SLICE
+	case c.kind != CONTAINER_NONE:
+		member.LeadingType = TYPE_CONTAINER
+		member.container = c
+	}
+	return member, nil
+}
+
+// memberGoType returns the type of member in a struct declaration.
+func memberGoType(member StructMember) string {
+	if member.IsSlice() {
+		return "[]" + member.Type
+	}
+	return member.Type
+}
+
+// structMembers returns the members of the ABI struct s. A base struct is
+// embedded as the first member, like contracts declare it.
+func (g *BindingGenerator) structMembers(s *ABIStruct) ([]StructMember, error) {
+	var members []StructMember
+	// The names of the generated methods and of the fields that are taken,
+	// which get a trailing underscore instead.
+	used := map[string]bool{"Pack": true, "Unpack": true, "Size": true}
+	if s.Base != "" {
+		if _, ok := g.structs[s.Base]; !ok {
+			return nil, fmt.Errorf("base %s of struct %s is not a struct", s.Base, s.Name)
+		}
+		name := goName(s.Base)
+		used[name] = true
+		members = append(members, StructMember{Name: name, Type: name, LeadingType: TYPE_NORMAL, Embedded: true})
+	}
+	for _, field := range s.Fields {
+		name := goName(field.Name)
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		member, err := g.member(name, field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of struct %s: %w", field.Name, s.Name, err)
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (g *BindingGenerator) writeStruct(name string, members []StructMember) {
+	g.writeCode("type %s struct {", name)
+	for _, member := range members {
+		if member.Embedded {
+			g.writeCode("\t%s", member.Type)
+		} else {
+			g.writeCode("\t%s %s", member.Name, memberGoType(member))
+		}
+	}
+	g.writeCode("}")
+}
+
+// Generate returns the generated Go file.
+func (g *BindingGenerator) Generate() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	g.codeFile = buf
+
+	g.writeCode("// Code generated by tinygo abigen. DO NOT EDIT.\n")
+	g.writeCode("package %s\n", g.packageName)
+	g.writeCode("import (")
+	g.writeCode("\t\"github.com/uuosio/chain\"")
+	if len(g.abi.Tables) != 0 {
+		g.writeCode("\t\"github.com/uuosio/chain/database\"")
+	}
+	g.writeCode(")\n")
+
+	if g.account != "" {
+		g.writeCode("// ContractAccount is the account of the contract the actions are sent to.")
+		g.writeCode("var ContractAccount = chain.Name{N: uint64(%d)} //%s", StringToName(g.account), g.account)
+	} else {
+		g.writeCode("// ContractAccount is the account of the contract the actions are sent to.")
+		g.writeCode("// It has to be set before any action is sent.")
+		g.writeCode("var ContractAccount chain.Name")
+	}
+
+	for _, typeDef := range g.abi.Types {
+		c, err := g.resolveType(typeDef.Type)
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", typeDef.NewTypeName, err)
+		}
+		g.writeCode("\ntype %s = %s", goName(typeDef.NewTypeName), c.goType)
+	}
+
+	for i := range g.abi.Structs {
+		s := &g.abi.Structs[i]
+		members, err := g.structMembers(s)
+		if err != nil {
+			return nil, err
+		}
+		g.writeCode("")
+		g.writeStruct(goName(s.Name), members)
+		g.genPackUnpackCode(goName(s.Name), members)
+	}
+
+	for _, variant := range g.abi.Variants {
+		var members []StructMember
+		for _, typ := range variant.Types {
+			c, err := g.resolveType(typ)
+			if err != nil {
+				return nil, fmt.Errorf("variant %s: %w", variant.Name, err)
+			}
+			if c.kind != CONTAINER_NONE {
+				return nil, fmt.Errorf("variant %s: unsupported type %s", variant.Name, typ)
+			}
+			members = append(members, StructMember{Type: c.goType, LeadingType: TYPE_NORMAL})
+		}
+		name := goName(variant.Name)
+		g.writeCode("\ntype %s struct {\n\tvalue interface{}\n}", name)
+		g.writeCode("\n// Value returns a pointer to the value of the variant.")
+		g.writeCode("func (t *%s) Value() interface{} {\n\treturn t.value\n}", name)
+		g.genPackUnpackCodeForVariant(name, members)
+	}
+
+	// Wrappers of wrappers are added while generating the code.
+	for i := 0; i < len(g.wrappers); i++ {
+		w := g.wrappers[i]
+		if w.typ == OptionalType {
+			g.writeCode("\ntype %s struct {\n\tchain.Optional\n\tValue %s\n}", w.name, memberGoType(w.member))
+		} else {
+			g.writeCode("\ntype %s struct {\n\tchain.BinaryExtension\n\tValue %s\n}", w.name, memberGoType(w.member))
+		}
+		g.genPackCodeForSpecialStruct(w.typ, w.name, w.member)
+		g.genUnpackCodeForSpecialStruct(w.typ, w.name, w.member)
+		g.genSizeCodeForSpecialStruct(w.typ, w.name, w.member)
+	}
+
+	for _, table := range g.abi.Tables {
+		if _, ok := g.structs[table.Type]; !ok {
+			return nil, fmt.Errorf("type %s of table %s is not a struct", table.Type, table.Name)
+		}
+		if !IsNameValid(table.Name) {
+			return nil, fmt.Errorf("invalid table name: %s", table.Name)
+		}
+		t := bindingTable{
+			Name:      goName(table.Name),
+			TableName: table.Name,
+			RawName:   StringToName(table.Name),
+			Type:      goName(table.Type),
+		}
+		if err := g.writeCodeEx(cBindingTableTemplate, t); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, action := range g.abi.Actions {
+		if err := g.writeSendFunction(action); err != nil {
+			return nil, err
+		}
+	}
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format the generated code: %w", err)
+	}
+	return code, nil
+}
+
+type bindingTable struct {
+	Name      string
+	TableName string
+	RawName   uint64
+	Type      string
+}
+
+// writeSendFunction writes the function that sends action as an inline
+// action, with the fields of its struct as parameters.
+func (g *BindingGenerator) writeSendFunction(action ABIAction) error {
+	if !IsNameValid(action.Name) {
+		return fmt.Errorf("invalid action name: %s", action.Name)
+	}
+	s, ok := g.structs[action.Type]
+	if !ok {
+		return fmt.Errorf("type %s of action %s is not a struct", action.Type, action.Name)
+	}
+	members, err := g.structMembers(s)
+	if err != nil {
+		return err
+	}
+
+	params := []string{"auth *chain.PermissionLevel"}
+	values := []string{}
+	used := make(map[string]bool)
+	for _, member := range members {
+		name := paramName(member.Name)
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		params = append(params, name+" "+memberGoType(member))
+		values = append(values, member.Name+": "+name)
+	}
+
+	funcName := "Send" + goName(action.Name)
+	g.writeCode("\n// %s sends the %s action of ContractAccount as an inline action.", funcName, action.Name)
+	g.writeCode("func %s(%s) {", funcName, strings.Join(params, ", "))
+	g.writeCode("\tv := &%s{%s}", goName(s.Name), strings.Join(values, ", "))
+	g.writeCode("\ta := &chain.Action{")
+	g.writeCode("\t\tAccount:       ContractAccount,")
+	g.writeCode("\t\tName:          chain.Name{N: uint64(%d)}, //%s", StringToName(action.Name), action.Name)
+	g.writeCode("\t\tAuthorization: []*chain.PermissionLevel{auth},")
+	g.writeCode("\t\tData:          v.Pack(),")
+	g.writeCode("\t}")
+	g.writeCode("\ta.Send()")
+	g.writeCode("}")
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+// This file tests the generation of Go bindings from the ABI in
+// testdata/abigen.
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBindingGenerator(t *testing.T) {
+	abi, err := ReadABIFile(filepath.Join("testdata", "abigen", "token.abi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := NewBindingGenerator(abi, "token", "eosio.token").Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "token.go", code, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, code)
+	}
+
+	for _, expected := range []string{
+		"type AccountName = chain.Name",
+		"type MemoList = []string",
+		"type CurrencyStats struct {",
+		"\tIssuer        chain.Name\n",
+		"type Batch struct {\n\tNote\n",
+		"\tTransfers []Transfer\n",
+		"\tGrid      [][]uint64\n",
+		"\tHash      [4]uint32\n",
+		"\tLimit     OptionalAsset\n",
+		"\tExtra     BinaryExtensionVaruint32Array\n",
+		"type OptionalAsset struct {\n\tchain.Optional\n\tValue chain.Asset\n}",
+		"type BinaryExtensionVaruint32Array struct {\n\tchain.BinaryExtension\n\tValue []chain.VarUint32\n}",
+		"type Payload struct {\n\tvalue interface{}\n}",
+		"func NewAccountsTable(code chain.Name, scope chain.Name) *AccountsTable {",
+		"func (t *StatTable) Get(id uint64) *CurrencyStats {",
+		"var ContractAccount = chain.Name{N: uint64(6138663591592764928)} //eosio.token",
+		"func SendTransfer(auth *chain.PermissionLevel, from chain.Name, to chain.Name, quantity chain.Asset, memo string) {",
+		"func SendBatch(auth *chain.PermissionLevel, note Note, type_ uint8,",
+		// Fields don't take the names of the generated methods, and
+		// parameters those of the variables of the send functions.
+		"type Resize struct {\n\tSize_   uint32\n\tPack_   bool\n\tUnpack_ string\n\tSize__  uint8\n\tA       chain.Name\n}",
+		"func SendResize(auth *chain.PermissionLevel, size_ uint32, pack_ bool, unpack_ string, size__ uint8, a_ chain.Name) {",
+		"v := &Resize{Size_: size_, Pack_: pack_, Unpack_: unpack_, Size__: size__, A: a_}",
+	} {
+		if !strings.Contains(string(code), expected) {
+			t.Errorf("generated code does not contain %q", expected)
+		}
+	}
+
+	abi.Structs[0].Fields[0].Type = "unknown"
+	_, err = NewBindingGenerator(abi, "token", "").Generate()
+	if err == nil || !strings.Contains(err.Error(), "field balance of struct account: unknown ABI type unknown") {
+		t.Errorf("expected an error for the unknown type, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/wasmfile"
+)
+
+// The chain intrinsics that read-only transactions reject: the database
+// writes, sending and canceling actions, notifying accounts and the
+// privileged intrinsics that change the chain configuration. Read-only
+// actions must not reach them.
+var eosioWriteIntrinsics = map[string]bool{
+	"db_store_i64":              true,
+	"db_update_i64":             true,
+	"db_remove_i64":             true,
+	"db_idx64_store":            true,
+	"db_idx64_update":           true,
+	"db_idx64_remove":           true,
+	"db_idx128_store":           true,
+	"db_idx128_update":          true,
+	"db_idx128_remove":          true,
+	"db_idx256_store":           true,
+	"db_idx256_update":          true,
+	"db_idx256_remove":          true,
+	"db_idx_double_store":       true,
+	"db_idx_double_update":      true,
+	"db_idx_double_remove":      true,
+	"db_idx_long_double_store":  true,
+	"db_idx_long_double_update": true,
+	"db_idx_long_double_remove": true,
+	"kv_set":                    true,
+	"kv_erase":                  true,
+	"send_inline":               true,
+	"send_context_free_inline":  true,
+	"send_deferred":             true,
+	"cancel_deferred":           true,
+	"require_recipient":         true,
+
+	"set_resource_limits":              true,
+	"set_resource_limit":               true,
+	"set_proposed_producers":           true,
+	"set_proposed_producers_ex":        true,
+	"set_privileged":                   true,
+	"set_blockchain_parameters_packed": true,
+	"set_parameters_packed":            true,
+	"set_kv_parameters_packed":         true,
+	"set_wasm_parameters_packed":       true,
+	"preactivate_feature":              true,
+}
+
+// readOnlyAction is a read-only action with the names its function may have
+// in the name section: the dispatch method and the handler.
+type readOnlyAction struct {
+	Name      string
+	Functions []string
+}
+
+// contractReadOnlyActions returns the read-only actions of the contract.
+func contractReadOnlyActions(gen *CodeGenerator) []readOnlyAction {
+	var actions []readOnlyAction
+	for _, action := range gen.actions {
+		if action.ReadOnly {
+			actions = append(actions, readOnlyAction{action.ActionName, []string{
+				"(*main." + action.ActionName + ").dispatch",
+				"(*main." + action.StructName + ")." + action.FuncName,
+			}})
+		}
+	}
+	return actions
+}
+
+// packageReadOnlyActions returns the read-only actions of the ABI file next
+// to the contract in pkgName, which is a package directory or a Go file, for
+// builds without -gen-code that don't load the package. The ABI doesn't name
+// the handlers, so only the dispatch methods are looked for. A contract
+// without an ABI file has no read-only actions.
+func packageReadOnlyActions(pkgName string) ([]readOnlyAction, error) {
+	dir := pkgName
+	if filepath.Ext(pkgName) == ".go" {
+		dir = filepath.Dir(pkgName)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.abi"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	if len(files) > 1 {
+		return nil, fmt.Errorf("can't check the read-only actions: more than one ABI file in %s: %s", dir, strings.Join(files, ", "))
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		return nil, err
+	}
+	var abi ABI
+	if err := json.Unmarshal(data, &abi); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", files[0], err)
+	}
+	var actions []readOnlyAction
+	for _, action := range abi.Actions {
+		if action.ReadOnly {
+			actions = append(actions, readOnlyAction{action.Name, []string{"(*main." + action.Name + ").dispatch"}})
+		}
+	}
+	return actions, nil
+}
+
+// readOnlyViolations returns, for each of the read-only actions that can
+// modify the state of the chain in the wasm module data, a call path to the
+// intrinsic that does so. Starting from the function of the action, it
+// follows the direct calls, and an indirect call can reach every function in
+// the table with the same signature. It needs the name section, so it runs
+// before the post-link pass. An error is returned if an action can't be
+// checked because its functions are not in the name section.
+func readOnlyViolations(data []byte, actions []readOnlyAction) ([]string, error) {
+	m, err := wasmfile.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	funcIndex := make(map[string]uint32)
+	for i := range m.Codes {
+		index := uint32(m.NumImportedFuncs + i)
+		funcIndex[m.FuncName(index)] = index
+	}
+	signature := func(t wasmfile.FuncType) string {
+		return string(t.Params) + ":" + string(t.Results)
+	}
+	tableFuncs := make(map[string][]uint32) // signature to functions
+	for _, elem := range m.Elements {
+		for _, index := range elem.Functions {
+			if t, ok := m.FuncType(index); ok {
+				tableFuncs[signature(t)] = append(tableFuncs[signature(t)], index)
+			}
+		}
+	}
+
+	var violations []string
+	for _, action := range actions {
+		var start uint32
+		found := false
+		for _, name := range action.Functions {
+			if index, ok := funcIndex[name]; ok {
+				start, found = index, true
+				break
+			}
+		}
+		if !found {
+			// The name section is stripped, or the dispatch method was
+			// renamed or inlined: the action can't be checked.
+			return nil, fmt.Errorf("can't check read-only action %s: %s is not in the name section",
+				action.Name, strings.Join(action.Functions, " or "))
+		}
+
+		// Breadth-first, so the reported path is a shortest one.
+		caller := map[uint32]uint32{start: start}
+		worklist := []uint32{start}
+		var write *uint32
+		for len(worklist) != 0 && write == nil {
+			index := worklist[0]
+			worklist = worklist[1:]
+			if imp := m.FuncImport(index); imp != nil {
+				if eosioWriteIntrinsics[imp.Name] {
+					write = &index
+				}
+				continue
+			}
+			reach := func(callee uint32) {
+				if _, ok := caller[callee]; !ok {
+					caller[callee] = index
+					worklist = append(worklist, callee)
+				}
+			}
+			ir := wasmfile.NewInstructionReader(m.Codes[int(index)-m.NumImportedFuncs].Body)
+			for !ir.Done() {
+				in := ir.Next()
+				switch in.Op {
+				case 0x10: // call
+					reach(in.Index)
+				case 0x11: // call_indirect
+					if int(in.Index) < len(m.Types) {
+						for _, callee := range tableFuncs[signature(m.Types[in.Index])] {
+							reach(callee)
+						}
+					}
+				}
+			}
+			if ir.Err() != nil {
+				return nil, fmt.Errorf("%s: %w", m.FuncName(index), ir.Err())
+			}
+		}
+		if write == nil {
+			continue
+		}
+		path := []string{m.FuncName(*write)}
+		for index := *write; index != start; {
+			index = caller[index]
+			path = append([]string{m.FuncName(index)}, path...)
+		}
+		violations = append(violations, fmt.Sprintf("read-only action %s can modify the chain state: %s", action.Name, strings.Join(path, " -> ")))
+	}
+	return violations, nil
+}
+
+// checkReadOnlyActions checks that the read-only actions of the contract in
+// the wasm file can't write to the database or send actions.
+func checkReadOnlyActions(file string, actions []readOnlyAction) error {
+	if len(actions) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	violations, err := readOnlyViolations(data, actions)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if len(violations) != 0 {
+		return fmt.Errorf("%s:\n\t%s", file, strings.Join(violations, "\n\t"))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/wasmfile"
+	"github.com/tinygo-org/tinygo/wasmfile/wasmtest"
+)
+
+func TestReadOnlyViolations(t *testing.T) {
+	gen := NewCodeGenerator()
+	gen.actions = []ActionInfo{
+		{ActionName: "getbalance", StructName: "Contract", FuncName: "GetBalance", ReadOnly: true},
+		{ActionName: "gettotal", StructName: "Contract", FuncName: "GetTotal", ReadOnly: true},
+		{ActionName: "transfer", StructName: "Contract", FuncName: "Transfer"},
+	}
+
+	// getbalance reaches the database write through an indirect call,
+	// gettotal only prints.
+	module := wasmtest.Module(
+		wasmtest.Section(wasmfile.SectionType, wasmtest.Vec([]byte{0x60, 0, 0})),
+		wasmtest.Section(wasmfile.SectionImport, wasmtest.Vec(
+			wasmtest.ImportFunc("env", "db_store_i64", 0),
+			wasmtest.ImportFunc("env", "prints", 0),
+		)),
+		wasmtest.Section(wasmfile.SectionFunction, wasmtest.Vec([]byte{0}, []byte{0}, []byte{0}, []byte{0}, []byte{0})),
+		wasmtest.Section(wasmfile.SectionTable, wasmtest.Vec([]byte{0x70, 0, 1})),
+		wasmtest.Section(wasmfile.SectionMemory, wasmtest.Vec([]byte{0, 1})),
+		wasmtest.Section(wasmfile.SectionExport, wasmtest.Vec(append(wasmtest.Name("apply"), wasmfile.ExternalFunction, 2))),
+		wasmtest.Section(wasmfile.SectionElement, wasmtest.Vec([]byte{0, 0x41, 0, 0x0b, 1, 4})),
+		wasmtest.Section(wasmfile.SectionCode, wasmtest.Vec(
+			wasmtest.Function([]byte{0}, 0x10, 3, 0x10, 5, 0x10, 6, 0x0b), // apply
+			wasmtest.Function([]byte{0}, 0x41, 0, 0x11, 0, 0, 0x0b),       // getbalance
+			wasmtest.Function([]byte{0}, 0x10, 0, 0x0b),                   // store
+			wasmtest.Function([]byte{0}, 0x10, 1, 0x0b),                   // gettotal
+			wasmtest.Function([]byte{0}, 0x10, 4, 0x0b),                   // transfer
+		)),
+		wasmtest.Section(wasmfile.SectionCustom, wasmtest.Names("db_store_i64", "prints", "apply", "(*main.getbalance).dispatch", "main.store", "(*main.gettotal).dispatch", "(*main.Contract).Transfer")),
+	)
+
+	violations, err := readOnlyViolations(module, contractReadOnlyActions(gen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"read-only action getbalance can modify the chain state: (*main.getbalance).dispatch -> main.store -> env.db_store_i64",
+	}
+	if !reflect.DeepEqual(violations, expected) {
+		t.Errorf("unexpected violations:\n%q\nexpected:\n%q", violations, expected)
+	}
+
+	// An action without functions in the name section can't be checked.
+	gen.actions = append(gen.actions, ActionInfo{ActionName: "getname", StructName: "Contract", FuncName: "GetName", ReadOnly: true})
+	_, err = readOnlyViolations(module, contractReadOnlyActions(gen))
+	if err == nil || !strings.Contains(err.Error(), "can't check read-only action getname: (*main.getname).dispatch or (*main.Contract).GetName is not in the name section") {
+		t.Errorf("expected an error for getname, got %v", err)
+	}
+}
+
+func TestPackageReadOnlyActions(t *testing.T) {
+	dir := t.TempDir()
+	actions, err := packageReadOnlyActions(dir)
+	if err != nil || actions != nil {
+		t.Errorf("expected no read-only actions without an ABI file, got %v %v", actions, err)
+	}
+
+	abi := `{"version": "eosio::abi/1.2", "actions": [
+		{"name": "getbalance", "type": "getbalance", "ricardian_contract": "", "read_only": true},
+		{"name": "transfer", "type": "transfer", "ricardian_contract": ""}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "token.abi"), []byte(abi), 0644); err != nil {
+		t.Fatal(err)
+	}
+	actions, err = packageReadOnlyActions(filepath.Join(dir, "contract.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []readOnlyAction{{"getbalance", []string{"(*main.getbalance).dispatch"}}}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected read-only actions %v, got %v", expected, actions)
+	}
+}
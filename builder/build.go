@@ -199,6 +199,7 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 		AutomaticStackSize: config.AutomaticStackSize(),
 		DefaultStackSize:   config.StackSize(),
 		NeedsStackObjects:  config.NeedsStackObjects(),
+		PanicFlag:          config.PanicFlag(),
 		Debug:              true,
 	}
 
@@ -840,6 +841,15 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(Buil
 				}
 			}
 
+			// Check the imports of eosio contracts, which are linked with
+			// --allow-undefined.
+			if config.Target.EosioIntrinsics != "" {
+				err := checkEosioImports(executable, config.Target.EosioIntrinsics)
+				if err != nil {
+					return err
+				}
+			}
+
 			// Run wasm-opt if necessary.
 			if config.Scheduler() == "asyncify" {
 				var optLevel, shrinkLevel int
@@ -37,6 +37,18 @@ func NewConfig(options *compileopts.Options) (*compileopts.Config, error) {
 		return nil, fmt.Errorf("requires go version 1.18 through 1.19, got go%d.%d", major, minor)
 	}
 
+	if options.GC == "arena" {
+		eosio := false
+		for _, tag := range spec.BuildTags {
+			eosio = eosio || tag == "eosio"
+		}
+		if !eosio {
+			return nil, errors.New("-gc=arena is only supported on eosio targets")
+		}
+	} else if options.AllocSites {
+		return nil, errors.New("-alloc-sites requires -gc=arena")
+	}
+
 	clangHeaderPath := getClangHeaderPath(goenv.Get("TINYGOROOT"))
 
 	return &compileopts.Config{
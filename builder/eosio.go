@@ -0,0 +1,177 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/wasmfile"
+)
+
+// Intrinsics provided by EOSIO 2.0, which are available on every later
+// version of the chain.
+var eosioBaseIntrinsics = []string{
+	// action
+	"read_action_data", "action_data_size", "current_receiver", "publication_time", "get_sender",
+	// authorization
+	"require_auth", "require_auth2", "has_auth", "require_recipient", "is_account",
+	// permission
+	"check_transaction_authorization", "check_permission_authorization", "get_permission_last_used", "get_account_creation_time",
+	// console
+	"prints", "prints_l", "printi", "printui", "printi128", "printui128", "printsf", "printdf", "printqf", "printn", "printhex",
+	// system
+	"eosio_assert", "eosio_assert_message", "eosio_assert_code", "eosio_exit", "abort", "current_time", "is_feature_activated", "get_context_free_data",
+	// privileged
+	"is_feature_active", "activate_feature", "preactivate_feature", "set_resource_limits", "get_resource_limits",
+	"set_proposed_producers", "set_proposed_producers_ex", "get_blockchain_parameters_packed", "set_blockchain_parameters_packed",
+	"is_privileged", "set_privileged", "get_active_producers",
+	// crypto
+	"assert_recover_key", "recover_key", "assert_sha256", "assert_sha1", "assert_sha512", "assert_ripemd160", "sha1", "sha256", "sha512", "ripemd160",
+	// transaction
+	"send_inline", "send_context_free_inline", "send_deferred", "cancel_deferred",
+	"read_transaction", "transaction_size", "expiration", "tapos_block_num", "tapos_block_prefix", "get_action",
+	// memory
+	"memcpy", "memmove", "memcmp", "memset",
+	// database
+	"db_store_i64", "db_update_i64", "db_remove_i64", "db_get_i64", "db_next_i64", "db_previous_i64",
+	"db_find_i64", "db_lowerbound_i64", "db_upperbound_i64", "db_end_i64",
+	// compiler builtins
+	"__ashlti3", "__ashrti3", "__lshlti3", "__lshrti3", "__divti3", "__udivti3", "__multi3", "__modti3", "__umodti3",
+	"__addtf3", "__subtf3", "__multf3", "__divtf3", "__negtf2", "__extendsftf2", "__extenddftf2", "__trunctfdf2", "__trunctfsf2",
+	"__fixtfsi", "__fixtfdi", "__fixtfti", "__fixunstfsi", "__fixunstfdi", "__fixunstfti", "__fixsfti", "__fixdfti", "__fixunssfti", "__fixunsdfti",
+	"__floatsidf", "__floatsitf", "__floatditf", "__floatunsitf", "__floatunditf", "__floattidf", "__floatuntidf",
+	"__cmptf2", "__eqtf2", "__netf2", "__getf2", "__gttf2", "__letf2", "__lttf2", "__unordtf2",
+}
+
+// Intrinsics added by the protocol features of EOSIO 2.1 that were kept by
+// Leap: ACTION_RETURN_VALUE, CONFIGURABLE_WASM_LIMITS and
+// BLOCKCHAIN_PARAMETERS.
+var eosio21Intrinsics = []string{
+	"set_action_return_value",
+	"get_wasm_parameters_packed", "set_wasm_parameters_packed",
+	"get_parameters_packed", "set_parameters_packed",
+}
+
+// Intrinsics of the KV database of EOSIO 2.1, which was removed in Leap.
+var eosioKVIntrinsics = []string{
+	"kv_erase", "kv_set", "kv_get", "kv_get_data",
+	"kv_it_create", "kv_it_destroy", "kv_it_status", "kv_it_compare", "kv_it_key_compare",
+	"kv_it_move_to_end", "kv_it_next", "kv_it_prev", "kv_it_lower_bound", "kv_it_key", "kv_it_value",
+	"get_kv_parameters_packed", "set_kv_parameters_packed", "set_resource_limit", "get_resource_limit",
+}
+
+// Intrinsics added by Leap 3: GET_CODE_HASH, GET_BLOCK_NUM and
+// CRYPTO_PRIMITIVES.
+var leap3Intrinsics = []string{
+	"get_code_hash", "get_block_num",
+	"alt_bn128_add", "alt_bn128_mul", "alt_bn128_pair", "mod_exp", "blake2_f", "sha3", "k1_recover",
+}
+
+// Intrinsics added by Leap 5: BLS_PRIMITIVES2.
+var leap5Intrinsics = []string{
+	"bls_g1_add", "bls_g2_add", "bls_g1_weighted_sum", "bls_g2_weighted_sum", "bls_pairing",
+	"bls_g1_map", "bls_g2_map", "bls_fp_mod", "bls_fp_mul", "bls_fp_exp",
+}
+
+// eosioIntrinsicSets are the intrinsics in the env module of each chain
+// version, selected with the eosio-intrinsics property of the target.
+var eosioIntrinsicSets = map[string][]string{
+	"eosio-2": eosioIntrinsicSet(eosioBaseIntrinsics, eosio21Intrinsics, eosioKVIntrinsics),
+	"leap-3":  eosioIntrinsicSet(eosioBaseIntrinsics, eosio21Intrinsics, leap3Intrinsics),
+	"leap-4":  eosioIntrinsicSet(eosioBaseIntrinsics, eosio21Intrinsics, leap3Intrinsics),
+	"leap-5":  eosioIntrinsicSet(eosioBaseIntrinsics, eosio21Intrinsics, leap3Intrinsics, leap5Intrinsics),
+}
+
+// eosioIntrinsicSet concatenates lists of intrinsics and adds the functions
+// of the secondary indexes, which are the same on all versions.
+func eosioIntrinsicSet(lists ...[]string) []string {
+	var set []string
+	for _, list := range lists {
+		set = append(set, list...)
+	}
+	for _, index := range []string{"idx64", "idx128", "idx256", "idx_double", "idx_long_double"} {
+		for _, op := range []string{"store", "update", "remove", "find_secondary", "find_primary", "lowerbound", "upperbound", "end", "next", "previous"} {
+			set = append(set, "db_"+index+"_"+op)
+		}
+	}
+	return set
+}
+
+// checkEosioImports checks that every function imported by the linked
+// contract is an intrinsic of the chain version. Contracts are linked with
+// --allow-undefined, so a missing function is only noticed by the linker as
+// an import. Each unknown import is reported with the functions that call
+// it.
+func checkEosioImports(executable, version string) error {
+	list, ok := eosioIntrinsicSets[version]
+	if !ok {
+		var versions []string
+		for v := range eosioIntrinsicSets {
+			versions = append(versions, v)
+		}
+		sort.Strings(versions)
+		return fmt.Errorf("unknown eosio-intrinsics %q, expected one of %s", version, strings.Join(versions, ", "))
+	}
+	intrinsics := make(map[string]bool, len(list))
+	for _, name := range list {
+		intrinsics[name] = true
+	}
+
+	data, err := ioutil.ReadFile(executable)
+	if err != nil {
+		return err
+	}
+	m, err := wasmfile.Parse(data)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", executable, err)
+	}
+	users := eosioImportUsers(m)
+	var errs []error
+	for i := 0; i < m.NumImportedFuncs; i++ {
+		imp := m.FuncImport(uint32(i))
+		if imp.Module == "env" && intrinsics[imp.Name] {
+			continue
+		}
+		msg := fmt.Sprintf("contract imports %s.%s, which is not an intrinsic of %s chains", imp.Module, imp.Name, version)
+		if len(users[uint32(i)]) != 0 {
+			msg += " (referenced by " + strings.Join(users[uint32(i)], ", ") + ")"
+		}
+		errs = append(errs, fmt.Errorf("%s", msg))
+	}
+	if len(errs) != 0 {
+		return newMultiError(errs)
+	}
+	return nil
+}
+
+// eosioImportUsers returns the names of the functions that call each
+// imported function. Imports in the function table are used by the table.
+func eosioImportUsers(m *wasmfile.Module) map[uint32][]string {
+	users := make(map[uint32][]string)
+	seen := make(map[[2]uint32]bool)
+	use := func(imp uint32, user uint32, name string) {
+		if !seen[[2]uint32{imp, user}] {
+			seen[[2]uint32{imp, user}] = true
+			users[imp] = append(users[imp], name)
+		}
+	}
+	for i, code := range m.Codes {
+		index := uint32(m.NumImportedFuncs + i)
+		ir := wasmfile.NewInstructionReader(code.Body)
+		for !ir.Done() {
+			in := ir.Next()
+			if in.Op == 0x10 && int(in.Index) < m.NumImportedFuncs {
+				use(in.Index, index, m.FuncName(index))
+			}
+		}
+	}
+	for _, e := range m.Elements {
+		for _, f := range e.Functions {
+			if int(f) < m.NumImportedFuncs {
+				use(f, ^uint32(0), "the function table")
+			}
+		}
+	}
+	return users
+}
@@ -0,0 +1,53 @@
+package builder
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/wasmfile"
+	"github.com/tinygo-org/tinygo/wasmfile/wasmtest"
+)
+
+func TestCheckEosioImports(t *testing.T) {
+	module := wasmtest.Module(
+		wasmtest.Section(wasmfile.SectionType, wasmtest.Vec([]byte{0x60, 0, 0})),
+		wasmtest.Section(wasmfile.SectionImport, wasmtest.Vec(
+			wasmtest.ImportFunc("env", "prints_l", 0),
+			wasmtest.ImportFunc("env", "clock_time_get", 0),
+			wasmtest.ImportFunc("wasi_snapshot_preview1", "fd_write", 0),
+		)),
+		wasmtest.Section(wasmfile.SectionFunction, wasmtest.Vec([]byte{0}, []byte{0})),
+		wasmtest.Section(wasmfile.SectionCode, wasmtest.Vec(
+			wasmtest.Function([]byte{0}, 0x10, 1, 0x0b),          // runtime.ticks
+			wasmtest.Function([]byte{0}, 0x10, 2, 0x10, 0, 0x0b), // main.main
+		)),
+		wasmtest.Section(wasmfile.SectionCustom, wasmtest.Names("prints_l", "clock_time_get", "fd_write", "runtime.ticks", "main.main")),
+	)
+
+	file := filepath.Join(t.TempDir(), "contract.wasm")
+	if err := ioutil.WriteFile(file, module, 0666); err != nil {
+		t.Fatal(err)
+	}
+	err := checkEosioImports(file, "leap-5")
+	multi, ok := err.(*MultiError)
+	if !ok {
+		t.Fatalf("expected two errors, got %v", err)
+	}
+	expected := []string{
+		"contract imports env.clock_time_get, which is not an intrinsic of leap-5 chains (referenced by runtime.ticks)",
+		"contract imports wasi_snapshot_preview1.fd_write, which is not an intrinsic of leap-5 chains (referenced by main.main)",
+	}
+	if len(multi.Errs) != len(expected) {
+		t.Fatalf("unexpected errors: %v", multi.Errs)
+	}
+	for i, err := range multi.Errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+
+	if err := checkEosioImports(file, "eosio-1"); err == nil || err.Error() != `unknown eosio-intrinsics "eosio-1", expected one of eosio-2, leap-3, leap-4, leap-5` {
+		t.Errorf("unexpected error for an unknown version: %v", err)
+	}
+}
@@ -6,20 +6,27 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
-	"go/parser"
 	"go/token"
+	"go/types"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 	"text/template"
 
 	"github.com/fatih/color"
+	"github.com/tinygo-org/tinygo/compileopts"
+	"golang.org/x/tools/go/packages"
 )
 
+// chainPackagePath is the import path of the chain library. Types declared in
+// it are always referred to as chain.X in generated code, independent of the
+// name under which a contract imports the package.
+const chainPackagePath = "github.com/uuosio/chain"
+
 /*
 	bool
 	int8
@@ -70,6 +77,72 @@ type ActionInfo struct {
 	FuncName   string
 	IsNotify   bool
 	Ignore     bool
+	Ricardian  string
+	Result     *StructMember
+	Pos        token.Pos
+	// Auth holds the parameters that must authorize the action, from the
+	// auth=<param> attributes.
+	Auth []string
+	// ReadOnly is set by the read-only attribute: the action doesn't modify
+	// the state of the chain.
+	ReadOnly bool
+	// NotifyCode is the contract of a notification handler written as
+	// //notify code::action, or "*" for any contract. It is empty for the
+	// form without a contract, which also handles the action of any contract.
+	NotifyCode string
+}
+
+// TypeName returns the name of the struct that is generated to unpack the
+// action. Notification handlers with a contract are named after both, as a
+// contract can handle the same action of several contracts.
+func (a *ActionInfo) TypeName() string {
+	switch a.NotifyCode {
+	case "":
+		return a.ActionName
+	case "*":
+		return "notify_any_" + a.ActionName
+	default:
+		return "notify_" + strings.ReplaceAll(a.NotifyCode, ".", "_") + "_" + a.ActionName
+	}
+}
+
+// inABI reports whether the action is described in the ABI. Notification
+// handlers with a contract aren't, as they aren't actions of this contract.
+func (a *ActionInfo) inABI() bool {
+	return a.NotifyCode == ""
+}
+
+// ResultStructName returns the name of the struct that is generated to pack
+// the return value of the action.
+func (a *ActionInfo) ResultStructName() string {
+	return a.ActionName + "Result"
+}
+
+// callArgs returns the arguments of the action method, which are the fields
+// of the unpacked action struct t.
+func (a *ActionInfo) callArgs() string {
+	args := "("
+	for i, member := range a.Members {
+		if member.IsPointer() {
+			args += "&t." + member.Name
+		} else {
+			args += "t." + member.Name
+		}
+		if i != len(a.Members)-1 {
+			args += ", "
+		}
+	}
+	return args + ")"
+}
+
+// callCode returns the code that invokes the action method with args and, if
+// the method returns a value, passes the packed value to the chain.
+func (a *ActionInfo) callCode(args string) string {
+	call := fmt.Sprintf("contract.%s%s", a.FuncName, args)
+	if a.Result == nil {
+		return call
+	}
+	return fmt.Sprintf("ret := %s{%s}\n            chain.SetActionReturnValue(ret.Pack())", a.ResultStructName(), call)
 }
 
 type SecondaryIndexInfo struct {
@@ -112,6 +185,7 @@ type StructInfo struct {
 	PackageName   string
 	IgnoreFromABI bool
 	Comment       string
+	Pos           token.Pos
 }
 
 type TableInfo struct {
@@ -123,6 +197,7 @@ type TableInfo struct {
 	IgnoreFromABI    bool
 	Comment          string
 	PrimaryKey       string
+	PrimaryKeyName   string
 	SecondaryIndexes []SecondaryIndexInfo
 }
 
@@ -132,26 +207,42 @@ type FunctionInfo struct {
 
 type CodeGenerator struct {
 	dirName            string
-	currentFile        string
 	contractName       string
 	contractStructName string
 	hasNewContractFunc bool
 	fset               *token.FileSet
-	codeFile           *os.File
+	pkg                *types.Package
+	info               *types.Info
+	codeFile           io.Writer
 	actions            []ActionInfo
 	structs            []*StructInfo
 	tables             []*TableInfo
 	specialAbiTypes    []SpecialAbiType
 	structMap          map[string]*StructInfo
 
-	hasMainFunc   bool
-	abiStructsMap map[string]*StructInfo
-	PackerMap     map[string]*StructInfo
-	VariantMap    map[string]*StructInfo
-	actionMap     map[string]bool
-	abiTypeMap    map[string]bool
-	indexTypeMap  map[string]bool
-	functionMap   map[string][]FunctionInfo
+	hasMainFunc      bool
+	strictRicardian  bool
+	ricardianClauses []ABIRicardianClause
+	abiStructsMap    map[string]*StructInfo
+	PackerMap        map[string]*StructInfo
+	VariantMap       map[string]*StructInfo
+	actionMap        map[string]bool
+	notifyMap        map[string][]string // action to the contracts of its notification handlers
+	abiTypeMap       map[string]bool
+	typeDefs         map[string]string
+	pairStructs      map[string]ABIStruct
+	indexTypeMap     map[string]bool
+	functionMap      map[string][]FunctionInfo
+
+	// zeroCopy makes the generated Unpack methods alias the strings and byte
+	// slices to the data they are unpacked from, which for actions is the
+	// action data that doesn't change while the action runs. This applies to
+	// the Unpack method of every struct that isn't stored in a table (see
+	// findStoredStructs), also when the contract calls it itself, so such
+	// structs must not be unpacked from a buffer that is changed or reused
+	// afterwards.
+	zeroCopy      bool
+	storedStructs map[string]bool
 }
 
 type ABITable struct {
@@ -166,6 +257,12 @@ type ABIAction struct {
 	Name              string `json:"name"`
 	Type              string `json:"type"`
 	RicardianContract string `json:"ricardian_contract"`
+	ReadOnly          bool   `json:"read_only,omitempty"`
+}
+
+type ABIActionResult struct {
+	Name       string `json:"name"`
+	ResultType string `json:"result_type"`
 }
 
 type ABIStructField struct {
@@ -179,21 +276,27 @@ type ABIStruct struct {
 	Fields []ABIStructField `json:"fields"`
 }
 
+type ABITypeDef struct {
+	NewTypeName string `json:"new_type_name"`
+	Type        string `json:"type"`
+}
+
 type VariantDef struct {
 	Name  string   `json:"name"`
 	Types []string `json:"types"`
 }
 
 type ABI struct {
-	Version          string       `json:"version"`
-	Structs          []ABIStruct  `json:"structs"`
-	Types            []string     `json:"types"`
-	Actions          []ABIAction  `json:"actions"`
-	Tables           []ABITable   `json:"tables"`
-	RicardianClauses []string     `json:"ricardian_clauses"`
-	Variants         []VariantDef `json:"variants"`
-	AbiExtensions    []string     `json:"abi_extensions"`
-	ErrorMessages    []string     `json:"error_messages"`
+	Version          string               `json:"version"`
+	Structs          []ABIStruct          `json:"structs"`
+	Types            []ABITypeDef         `json:"types"`
+	Actions          []ABIAction          `json:"actions"`
+	Tables           []ABITable           `json:"tables"`
+	RicardianClauses []ABIRicardianClause `json:"ricardian_clauses"`
+	Variants         []VariantDef         `json:"variants"`
+	AbiExtensions    []string             `json:"abi_extensions"`
+	ErrorMessages    []string             `json:"error_messages"`
+	ActionResults    []ABIActionResult    `json:"action_results,omitempty"`
 }
 
 const (
@@ -201,14 +304,32 @@ const (
 	TYPE_NORMAL
 	TYPE_SLICE
 	TYPE_POINTER
+	TYPE_CONTAINER
 )
 
 type StructMember struct {
 	Name        string
 	Type        string
 	RawType     ast.Expr
+	GoType      types.Type
 	LeadingType int
+	Embedded    bool
 	Pos         token.Pos
+
+	// TypeDef is the name of a named type or type alias of the contract
+	// package the member is declared with. It becomes an entry of the ABI
+	// types list, for the element type if typeDefOfElem is set.
+	TypeDef       string
+	typeDefOfElem bool
+	// Underlying is the basic type of a defined type like "type Balance
+	// uint64". The encoder of that type is used for the member.
+	Underlying string
+
+	// container describes the type of TYPE_CONTAINER members.
+	container *containerType
+	// zeroCopy unpacks a string or byte slice member without copying it, see
+	// CodeGenerator.zeroCopy.
+	zeroCopy bool
 }
 
 func (t *StructMember) IsPointer() bool {
@@ -219,6 +340,49 @@ func (t *StructMember) IsSlice() bool {
 	return t.LeadingType == TYPE_SLICE
 }
 
+func (t *StructMember) IsContainer() bool {
+	return t.LeadingType == TYPE_CONTAINER
+}
+
+// typeNames returns the names of the types the member is composed of.
+func (t *StructMember) typeNames() []string {
+	if !t.IsContainer() {
+		return []string{t.Type}
+	}
+	var names []string
+	var walk func(c *containerType)
+	walk = func(c *containerType) {
+		if c.kind == CONTAINER_NONE {
+			names = append(names, c.value.Type)
+			return
+		}
+		if c.key != nil {
+			walk(c.key)
+		}
+		walk(c.elem)
+	}
+	walk(t.container)
+	return names
+}
+
+// codecType returns the type whose encoder is used for the member.
+func (t *StructMember) codecType() string {
+	if t.Underlying != "" {
+		return t.Underlying
+	}
+	return t.Type
+}
+
+// codecVar converts varName, a value of the member's (element) type, to the
+// type returned by codecType. The result is addressable so it can be used
+// for both packing and unpacking.
+func (t *StructMember) codecVar(varName string) string {
+	if t.Underlying == "" {
+		return varName
+	}
+	return fmt.Sprintf("(*(*%s)(&%s))", t.Underlying, varName)
+}
+
 func (t *StructMember) unpackBaseType() string {
 	var varName string
 	if t.IsSlice() {
@@ -226,8 +390,14 @@ func (t *StructMember) unpackBaseType() string {
 	} else {
 		varName = fmt.Sprintf("t.%s", t.Name)
 	}
+	varName = t.codecVar(varName)
 
-	packer, ok := UnpackBasicType(varName, t.Type)
+	if t.zeroCopy {
+		if unpacker, ok := gZeroCopyUnpackMap[t.codecType()]; ok {
+			return fmt.Sprintf(unpacker, varName)
+		}
+	}
+	packer, ok := UnpackBasicType(varName, t.codecType())
 	if ok {
 		return packer
 	} else {
@@ -254,6 +424,12 @@ func (t *StructMember) unpackBaseType() string {
 	// extended_asset
 }
 
+// memberBlockCode puts the code of a member in a block statement, indented
+// to be written by writeCode.
+func memberBlockCode(code string) string {
+	return strings.ReplaceAll(blockCode("", code), "\n", "\n\t")
+}
+
 func (t *StructMember) PackMember() string {
 	if t.Name == "" {
 		err := fmt.Errorf("anonymount Type does not supported currently: %s", t.Type)
@@ -267,6 +443,23 @@ func (t *StructMember) PackMember() string {
 	// 	return ""
 	// }
 
+	if t.IsContainer() {
+		return memberBlockCode(t.container.packCode("t."+t.Name, 0))
+	}
+
+	if t.Underlying != "" {
+		if t.IsSlice() {
+			packer, _ := PackBasicType(t.codecVar("t."+t.Name+"[i]"), t.Underlying)
+			code, err := packArrayLoop(t.Name, packer)
+			if err != nil {
+				panic(err)
+			}
+			return code
+		}
+		packer, _ := PackBasicType(t.codecVar("t."+t.Name), t.Underlying)
+		return packer
+	}
+
 	if t.IsSlice() {
 		code, err := packArrayType(t.Name, t.Type)
 		if err != nil {
@@ -291,8 +484,14 @@ func (t *StructMember) UnpackMember() string {
 	// 	return ""
 	// }
 
+	if t.IsContainer() {
+		return memberBlockCode(t.container.unpackCode("t."+t.Name, 0))
+	}
+
 	if t.IsSlice() {
-		if t.Type == "byte" {
+		if t.Type == "byte" && t.zeroCopy {
+			return fmt.Sprintf(gZeroCopyUnpackMap["[]byte"], "t."+t.Name)
+		} else if t.Type == "byte" {
 			return unpackType("UnpackBytes", fmt.Sprintf("t.%s", t.Name))
 		} else {
 			unpackCode := t.unpackBaseType()
@@ -311,11 +510,14 @@ func (t *StructMember) UnpackMember() string {
 }
 
 func (s StructMember) GetSize() string {
+	if s.IsContainer() {
+		return memberBlockCode(s.container.sizeCode("t."+s.Name, 0))
+	}
 	if s.IsSlice() {
 		code := fmt.Sprintf("size += chain.PackedVarUint32Length(uint32(len(t.%s)))\n", s.Name)
-		return code + "    " + calcArrayMemberSize(s.Name, s.Type)
+		return code + "    " + calcArrayMemberSize(s.Name, s.codecType())
 	} else {
-		return calcNotArrayMemberSize(s.Name, s.Type)
+		return calcNotArrayMemberSize(s.Name, s.codecType())
 	}
 }
 
@@ -329,9 +531,28 @@ func (s StructMember) PackVariantMember() string {
 }
 
 func (s StructMember) GetVariantSize() string {
+	if s.Type == "string" {
+		return "size += chain.PackedVarUint32Length(uint32(len(*t.value.(*string)))) + len(*t.value.(*string))"
+	}
 	return calcNotArrayMemberSize(fmt.Sprintf("value.(*%s)", s.Type), s.Type)
 }
 
+// GetValueType returns the Go type of the secondary values.
+func (t SecondaryIndexInfo) GetValueType() string {
+	return GetIndexType(t.Type)
+}
+
+// GetGreater returns the condition that the secondary value a is greater than
+// b. The chain types compare with Cmp.
+func (t SecondaryIndexInfo) GetGreater(a, b string) string {
+	switch t.Type {
+	case "IDX64", "IDXFloat64":
+		return a + " > " + b
+	default:
+		return a + ".Cmp(&" + b + ") > 0"
+	}
+}
+
 func (t SecondaryIndexInfo) GetSetter() string {
 	value := fmt.Sprintf("v.(%s)", GetIndexType(t.Type))
 	if strings.Index(t.Setter, "%v") >= 0 {
@@ -348,7 +569,10 @@ func NewCodeGenerator() *CodeGenerator {
 	t.PackerMap = make(map[string]*StructInfo)
 	t.VariantMap = make(map[string]*StructInfo)
 	t.actionMap = make(map[string]bool)
+	t.notifyMap = make(map[string][]string)
 	t.abiTypeMap = make(map[string]bool)
+	t.typeDefs = make(map[string]string)
+	t.pairStructs = make(map[string]ABIStruct)
 	t.indexTypeMap = make(map[string]bool)
 	t.functionMap = make(map[string][]FunctionInfo)
 
@@ -387,26 +611,42 @@ func (t *CodeGenerator) convertToAbiType(pos token.Pos, goType string) (string,
 }
 
 func (t *CodeGenerator) convertType(goType StructMember) (string, error) {
+	if goType.IsContainer() {
+		abiType, err := t.containerAbiType(goType.container)
+		if err != nil {
+			return "", err
+		}
+		return t.addTypeDef(goType, abiType), nil
+	}
+
 	typ := goType.Type
-	var specialAbiType *SpecialAbiType
 	//special case for []byte type
 	if typ == "byte" && goType.IsSlice() {
-		return "bytes", nil
+		return t.addTypeDef(goType, "bytes"), nil
 	}
 
-	pos := goType.Pos
-	for i := range t.specialAbiTypes {
-		if t.specialAbiTypes[i].name == typ {
-			specialAbiType = &t.specialAbiTypes[i]
-			typ = specialAbiType.member.Type
-			pos = specialAbiType.member.Pos
-			break
+	var abiType string
+	if specialAbiType := t.findSpecialAbiType(typ); specialAbiType != nil {
+		valueType, err := t.convertType(specialAbiType.member)
+		if err != nil {
+			return "", err
+		}
+		if specialAbiType.typ == BinaryExtensionType {
+			abiType = valueType + "$"
+		} else if specialAbiType.typ == OptionalType {
+			abiType = valueType + "?"
+		} else {
+			return "", fmt.Errorf("unknown special abi type %d", specialAbiType.typ)
+		}
+	} else {
+		var err error
+		abiType, err = t.convertToAbiType(goType.Pos, goType.codecType())
+		if err != nil {
+			return "", err
+		}
+		if goType.typeDefOfElem {
+			abiType = t.addTypeDef(goType, abiType)
 		}
-	}
-
-	abiType, err := t.convertToAbiType(pos, typ)
-	if err != nil {
-		return "", err
 	}
 
 	if goType.IsSlice() {
@@ -415,18 +655,42 @@ func (t *CodeGenerator) convertType(goType StructMember) (string, error) {
 		// }
 		abiType += "[]"
 	}
+	if !goType.typeDefOfElem {
+		abiType = t.addTypeDef(goType, abiType)
+	}
+	return abiType, nil
+}
 
-	if specialAbiType != nil {
-		if specialAbiType.typ == BinaryExtensionType {
-			return abiType + "$", nil
-		} else if specialAbiType.typ == OptionalType {
-			return abiType + "?", nil
-		} else {
-			return "", fmt.Errorf("unknown special abi type %d", specialAbiType.typ)
+// addTypeDef adds the named type or type alias member is declared with to
+// the ABI types, as a new name for abiType. It returns the ABI type to use
+// for the member.
+func (t *CodeGenerator) addTypeDef(member StructMember, abiType string) string {
+	if member.TypeDef == "" {
+		return abiType
+	}
+	t.typeDefs[member.TypeDef] = abiType
+	return member.TypeDef
+}
+
+// checkEmbedded verifies that s embeds at most one struct, as its first field.
+// That struct becomes the base of s in the ABI and its fields are serialized
+// before the other fields of s.
+func (t *CodeGenerator) checkEmbedded(s *StructInfo) error {
+	for i, member := range s.Members {
+		if !member.Embedded {
+			continue
+		}
+		if i != 0 {
+			return t.newError(member.Pos, "embedded field %s in %s can not be represented in the ABI: only the first field can be an embedded struct", member.Type, s.StructName)
+		}
+		if member.LeadingType != TYPE_NORMAL {
+			return t.newError(member.Pos, "embedded field %s in %s can not be represented in the ABI: it must be a struct, not a pointer", member.Type, s.StructName)
+		}
+		if _, ok := t.structMap[member.Type]; !ok {
+			return t.newError(member.Pos, "embedded field %s in %s can not be represented in the ABI: it is not a struct of this contract", member.Type, s.StructName)
 		}
-	} else {
-		return abiType, nil
 	}
+	return nil
 }
 
 func (t *CodeGenerator) newError(p token.Pos, format string, args ...interface{}) error {
@@ -434,47 +698,132 @@ func (t *CodeGenerator) newError(p token.Pos, format string, args ...interface{}
 	return errors.New(t.getLineInfo(p) + ":\n" + errMsg)
 }
 
-func parseType(field *ast.Field) (string, int) {
-	switch fieldType := field.Type.(type) {
-	case *ast.Ident:
-		return fieldType.Name, TYPE_NORMAL
+// unalias returns the type a type alias refers to. Older toolchains never
+// represent aliases explicitly, newer ones do so through types.Alias.
+func unalias(typ types.Type) types.Type {
+	for {
+		alias, ok := typ.(interface{ Rhs() types.Type })
+		if !ok {
+			return typ
+		}
+		typ = alias.Rhs()
+	}
+}
+
+// typeName returns the name under which typ is known to the generator. Types
+// of the contract package are unqualified and types of the chain package are
+// qualified with "chain", whatever name the package was imported under.
+func (t *CodeGenerator) typeName(typ types.Type) string {
+	return types.TypeString(unalias(typ), func(pkg *types.Package) string {
+		if pkg == t.pkg {
+			return ""
+		}
+		if pkg.Path() == chainPackagePath {
+			return "chain"
+		}
+		return pkg.Name()
+	})
+}
+
+// isChainType reports whether typ is the named type chain.<name>.
+func isChainType(typ types.Type, name string) bool {
+	named, ok := unalias(typ).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == chainPackagePath && obj.Name() == name
+}
+
+// parseType resolves a type expression through the type checker and returns
+// the name of the (element) type together with its leading type.
+func (t *CodeGenerator) parseType(expr ast.Expr) (string, int) {
+	typ := unalias(t.info.TypeOf(expr))
+	if typ == nil || typ == types.Typ[types.Invalid] {
+		// Keep the source text around so that errors can mention it.
+		return types.ExprString(expr), TYPE_UNSUPPORTED
+	}
+	if t.isContainerType(typ) {
+		return t.typeName(typ), TYPE_CONTAINER
+	}
+
+	switch v := typ.(type) {
+	case *types.Slice:
+		return t.typeName(v.Elem()), TYPE_SLICE
+	case *types.Pointer:
+		return t.typeName(v.Elem()), TYPE_POINTER
+	case *types.Named:
+		// A defined slice type of the contract package is handled like the
+		// slice itself, see parseTypeDef.
+		if slice, ok := v.Underlying().(*types.Slice); ok && v.Obj().Pkg() == t.pkg {
+			return t.typeName(slice.Elem()), TYPE_SLICE
+		}
+		return t.typeName(typ), TYPE_NORMAL
+	case *types.Basic:
+		return t.typeName(typ), TYPE_NORMAL
+	default:
+		return t.typeName(typ), TYPE_UNSUPPORTED
+	}
+}
+
+// parseMemberType sets the type of member from the type expression expr.
+func (t *CodeGenerator) parseMemberType(member *StructMember, expr ast.Expr) {
+	member.RawType = expr
+	member.GoType = t.info.TypeOf(expr)
+	member.Type, member.LeadingType = t.parseType(expr)
+	if member.IsContainer() {
+		member.container = t.parseContainer(member.GoType, member.Pos)
+		if member.container == nil {
+			member.LeadingType = TYPE_UNSUPPORTED
+		}
+	}
+	t.parseTypeDef(member, expr)
+}
+
+// parseTypeDef records the named type or type alias of the contract package
+// that expr refers to, either directly or as the element type of a slice,
+// as the ABI type of member. Defined types are only supported if they are
+// based on a basic type or a slice, as other defined types do not have the
+// Pack and Unpack methods of their underlying type.
+func (t *CodeGenerator) parseTypeDef(member *StructMember, expr ast.Expr) {
+	elemOnly := false
+	switch v := expr.(type) {
 	case *ast.ArrayType:
-		leadingType := TYPE_UNSUPPORTED
-		if fieldType.Len != nil {
-			leadingType = TYPE_UNSUPPORTED
-		} else {
-			leadingType = TYPE_SLICE
-		}
-		//*ast.BasicLit
-		switch v := fieldType.Elt.(type) {
-		case *ast.Ident:
-			return v.Name, leadingType
-		case *ast.SelectorExpr:
-			ident := v.X.(*ast.Ident)
-			return ident.Name + "." + v.Sel.Name, leadingType
-		default:
-			return "", leadingType
+		if member.LeadingType != TYPE_SLICE {
+			return
 		}
-	case *ast.SelectorExpr:
-		ident := fieldType.X.(*ast.Ident)
-		return ident.Name + "." + fieldType.Sel.Name, TYPE_NORMAL
+		expr = v.Elt
+		elemOnly = true
 	case *ast.StarExpr:
-		switch v2 := fieldType.X.(type) {
-		case *ast.Ident:
-			return v2.Name, TYPE_POINTER
-		case *ast.SelectorExpr:
-			switch x := v2.X.(type) {
-			case *ast.Ident:
-				return x.Name + "." + v2.Sel.Name, TYPE_POINTER
-			default:
-				return "", TYPE_UNSUPPORTED
+		expr = v.X
+	}
+
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return
+	}
+	obj, ok := t.info.Uses[ident].(*types.TypeName)
+	if !ok || obj.Pkg() != t.pkg {
+		return
+	}
+
+	if !obj.IsAlias() {
+		switch underlying := obj.Type().Underlying().(type) {
+		case *types.Basic:
+			member.Underlying = underlying.Name()
+		case *types.Slice:
+			if elem, ok := underlying.Elem().(*types.Named); ok && elem.Obj().Pkg() == t.pkg {
+				if basic, ok := elem.Underlying().(*types.Basic); ok {
+					member.Underlying = basic.Name()
+				}
 			}
+		case *types.Map, *types.Array:
 		default:
-			return "", TYPE_UNSUPPORTED
+			return
 		}
-	default:
-		return "", TYPE_UNSUPPORTED
 	}
+	member.TypeDef = obj.Name()
+	member.typeDefOfElem = elemOnly
 }
 
 func (t *CodeGenerator) parseField(field *ast.Field, memberList *[]StructMember, isStructField bool, ignore bool) error {
@@ -490,6 +839,17 @@ func (t *CodeGenerator) parseField(field *ast.Field, memberList *[]StructMember,
 	}
 
 	if field.Names == nil {
+		if !isStructField {
+			return nil
+		}
+		// An embedded field is named after its type. It is validated by
+		// checkEmbedded once it is known which structs end up in the ABI.
+		member := StructMember{}
+		member.Pos = field.Pos()
+		t.parseMemberType(&member, field.Type)
+		member.Name = member.Type[strings.LastIndex(member.Type, ".")+1:]
+		member.Embedded = true
+		*memberList = append(*memberList, member)
 		return nil
 	}
 
@@ -497,8 +857,7 @@ func (t *CodeGenerator) parseField(field *ast.Field, memberList *[]StructMember,
 		member := StructMember{}
 		member.Pos = field.Pos()
 		member.Name = name.Name
-		member.RawType = field.Type
-		member.Type, member.LeadingType = parseType(field)
+		t.parseMemberType(&member, field.Type)
 		*memberList = append(*memberList, member)
 	}
 	return nil
@@ -530,15 +889,10 @@ func (t *CodeGenerator) parseSpecialAbiType(packageName string, v *ast.GenDecl)
 		return false
 	}
 
-	typ, ok := field1.Type.(*ast.SelectorExpr)
-	if !ok {
-		return false
-	}
-
-	ident := typ.X.(*ast.Ident)
-	if ident.Name+"."+typ.Sel.Name == "chain.BinaryExtension" {
+	typ := t.info.TypeOf(field1.Type)
+	if isChainType(typ, "BinaryExtension") {
 		extension.typ = BinaryExtensionType
-	} else if ident.Name+"."+typ.Sel.Name == "chain.Optional" {
+	} else if isChainType(typ, "Optional") {
 		extension.typ = OptionalType
 	} else {
 		return false
@@ -550,18 +904,9 @@ func (t *CodeGenerator) parseSpecialAbiType(packageName string, v *ast.GenDecl)
 	}
 
 	extension.member.Name = field2.Names[0].Name
-
-	switch typ := field2.Type.(type) {
-	case *ast.Ident:
-		extension.member.Type = typ.Name
-		extension.member.Pos = typ.Pos()
-	case *ast.SelectorExpr:
-		ident := typ.X.(*ast.Ident)
-		extension.member.Type = ident.Name + "." + typ.Sel.Name
-		extension.member.Pos = typ.Pos()
-	default:
-		// err := t.newError(v.Pos(), "Unsupported type: %[1]T %[1]v", typ)
-		//panic(err)
+	extension.member.Pos = field2.Type.Pos()
+	t.parseMemberType(&extension.member, field2.Type)
+	if extension.member.LeadingType == TYPE_UNSUPPORTED || extension.member.LeadingType == TYPE_POINTER {
 		return false
 	}
 	t.specialAbiTypes = append(t.specialAbiTypes, extension)
@@ -659,13 +1004,14 @@ func (t *CodeGenerator) parseTableIndex(field *ast.Field, info *TableInfo) error
 		}
 
 		if len(indexInfo) == 1 {
-			ty, _ := parseType(field)
+			ty, _ := t.parseType(field.Type)
 			if len(field.Names) != 1 {
 				errMsg := fmt.Sprintf("primary field can not have multiple names %s", info.TableName)
 				return t.newError(comment.Pos(), errMsg)
 			}
 			if ty == "uint64" {
 				info.PrimaryKey = fmt.Sprintf("t.%s", field.Names[0].Name)
+				info.PrimaryKeyName = field.Names[0].Name
 			} else {
 				errMsg := fmt.Sprintf("unrecognized primary format:")
 				return t.newError(comment.Pos(), errMsg)
@@ -680,13 +1026,16 @@ func (t *CodeGenerator) parseTableIndex(field *ast.Field, info *TableInfo) error
 				return t.newError(comment.Pos(), "Duplicated primary key in struct "+info.StructInfo.StructName)
 			}
 			info.PrimaryKey = primary
+			if len(field.Names) != 0 {
+				info.PrimaryKeyName = field.Names[0].Name
+			}
 		} else {
 			errMsg := fmt.Sprintf("Invalid primary key in struct %s: %s", info.StructInfo.StructName, indexText)
 			return t.newError(comment.Pos(), errMsg)
 		}
 	} else if dbType == "//secondary" {
 		name := field.Names[0].Name
-		ty, _ := parseType(field)
+		ty, _ := t.parseType(field.Type)
 		var dbType string
 		var idx string
 		if ty == "uint64" {
@@ -759,6 +1108,7 @@ func (t *CodeGenerator) parseTableStruct(packageName string, declare *ast.GenDec
 	}
 
 	info := &TableInfo{}
+	info.StructInfo.Pos = declare.Pos()
 	tableName := parts[1]
 	if !IsNameValid(tableName) {
 		return t.newError(declare.Pos(), "Invalid table name:"+tableName)
@@ -830,6 +1180,7 @@ func (t *CodeGenerator) parseStruct(packageName string, declare *ast.GenDecl) er
 
 	info := StructInfo{}
 	info.PackageName = packageName
+	info.Pos = declare.Pos()
 	isContractStruct := false
 	var lastLineDoc string
 
@@ -957,7 +1308,7 @@ func (t *CodeGenerator) parseFunc(f *ast.FuncDecl) error {
 
 	//	parts := Split(text)
 	parts := strings.Fields(text)
-	if len(parts) < 2 || len(parts) > 3 {
+	if len(parts) < 2 {
 		return nil
 	}
 
@@ -967,29 +1318,72 @@ func (t *CodeGenerator) parseFunc(f *ast.FuncDecl) error {
 	}
 
 	actionName := parts[1]
+	notifyCode := ""
+	if i := strings.Index(actionName, "::"); i >= 0 && parts[0] == "//notify" {
+		notifyCode = actionName[:i]
+		actionName = actionName[i+2:]
+		if notifyCode != "*" && !IsNameValid(notifyCode) {
+			return t.newError(doc.Pos(), "Invalid contract name: %s", notifyCode)
+		}
+	}
 	if !IsNameValid(actionName) {
 		errMsg := fmt.Sprintf("Invalid action name: %s", actionName)
 		return t.newError(doc.Pos(), errMsg)
 	}
 
-	if _, ok := t.actionMap[actionName]; ok {
-		errMsg := fmt.Sprintf("Duplicate action name: %s", actionName)
-		return t.newError(doc.Pos(), errMsg)
+	if notifyCode == "" {
+		if _, ok := t.actionMap[actionName]; ok {
+			errMsg := fmt.Sprintf("Duplicate action name: %s", actionName)
+			return t.newError(doc.Pos(), errMsg)
+		}
+	}
+	if parts[0] == "//notify" {
+		// The handlers of an action must not overlap: there is either one
+		// handler for any contract, or one for each contract.
+		for _, code := range t.notifyMap[actionName] {
+			if code == notifyCode {
+				return t.newError(doc.Pos(), "Duplicate notification handler: %s", parts[1])
+			}
+			if code == "" || code == "*" || notifyCode == "" || notifyCode == "*" {
+				return t.newError(doc.Pos(), "Notification handler %s overlaps with the handler of %s::%s", parts[1], code, actionName)
+			}
+		}
 	}
 
 	ignore := false
-	if len(parts) == 3 {
-		if parts[2] != "ignore" {
-			errMsg := fmt.Sprintf("Bad action, %s not recognized as a valid parameter", parts[2])
-			return errors.New(errMsg)
+	readOnly := false
+	var auth []string
+	for _, attr := range parts[2:] {
+		switch {
+		case attr == "ignore" && !ignore:
+			ignore = true
+		case attr == "read-only" && !readOnly && parts[0] == "//action":
+			readOnly = true
+		case strings.HasPrefix(attr, "auth=") && parts[0] == "//action":
+			param := strings.TrimPrefix(attr, "auth=")
+			for _, v := range auth {
+				if v == param {
+					return t.newError(doc.Pos(), "Bad action, %s is repeated", attr)
+				}
+			}
+			auth = append(auth, param)
+		default:
+			return t.newError(doc.Pos(), "Bad action, %s not recognized as a valid parameter", attr)
 		}
-		ignore = true
+	}
+	if ignore && len(auth) != 0 {
+		return t.newError(doc.Pos(), "Bad action, the parameters of ignore action %s can not be used for auth", actionName)
 	}
 
 	action := ActionInfo{}
 	action.ActionName = actionName
+	action.NotifyCode = notifyCode
 	action.FuncName = f.Name.Name
 	action.Ignore = ignore
+	action.Auth = auth
+	action.ReadOnly = readOnly
+	action.Ricardian = ricardianFromDoc(f.Doc)
+	action.Pos = doc.Pos()
 
 	if parts[0] == "//notify" {
 		action.IsNotify = true
@@ -997,6 +1391,21 @@ func (t *CodeGenerator) parseFunc(f *ast.FuncDecl) error {
 		action.IsNotify = false
 	}
 
+	if results := f.Type.Results; results != nil && len(results.List) != 0 {
+		if action.IsNotify {
+			return t.newError(results.Pos(), "notify handler %s can not return a value", f.Name.Name)
+		}
+		if len(results.List) != 1 || len(results.List[0].Names) > 1 {
+			return t.newError(results.Pos(), "action %s can return at most one value", actionName)
+		}
+		field := results.List[0]
+		result := StructMember{}
+		result.Name = "value"
+		result.Pos = field.Pos()
+		t.parseMemberType(&result, field.Type)
+		action.Result = &result
+	}
+
 	if f.Recv.List != nil {
 		for _, v := range f.Recv.List {
 			expr, ok := v.Type.(*ast.StarExpr) //ast.Ident ast.StarExpr
@@ -1018,8 +1427,40 @@ func (t *CodeGenerator) parseFunc(f *ast.FuncDecl) error {
 			return err
 		}
 	}
+	if err := t.checkAuthParams(&action); err != nil {
+		return err
+	}
 	t.actions = append(t.actions, action)
-	t.actionMap[actionName] = true
+	if notifyCode == "" {
+		t.actionMap[actionName] = true
+	}
+	if action.IsNotify {
+		t.notifyMap[actionName] = append(t.notifyMap[actionName], notifyCode)
+	}
+	return nil
+}
+
+// checkAuthParams checks that the parameters of the auth attributes of the
+// action are accounts.
+func (t *CodeGenerator) checkAuthParams(action *ActionInfo) error {
+	for _, param := range action.Auth {
+		var member *StructMember
+		for i := range action.Members {
+			if action.Members[i].Name == param {
+				member = &action.Members[i]
+			}
+		}
+		if member == nil {
+			return t.newError(action.Pos, "auth parameter %s is not a parameter of action %s", param, action.ActionName)
+		}
+		abiType, err := t.convertType(*member)
+		if err != nil {
+			return err
+		}
+		if abiType != "name" || member.IsPointer() {
+			return t.newError(member.Pos, "auth parameter %s of action %s must be a chain.Name, not %s", param, action.ActionName, member.Type)
+		}
+	}
 	return nil
 }
 
@@ -1041,49 +1482,68 @@ func isErrorPackage(pkgName string) bool {
 	return false
 }
 
-func (t *CodeGenerator) ParseTags(file *ast.File) map[string]bool {
-	tagMap := make(map[string]bool)
-	for _, comment := range file.Comments {
-		for _, list := range comment.List {
-			if list.Slash < file.Package {
-				prefix := "// +build "
-				if strings.HasPrefix(list.Text, prefix) {
-					tags := strings.TrimPrefix(list.Text, prefix)
-					_tags := strings.Split(tags, ",")
-					for _, tag := range _tags {
-						tagMap[tag] = true
-					}
-				}
-			}
-		}
+// LoadPackage loads and type-checks the contract package matched by pattern
+// (a directory or a single Go file relative to t.dirName) with the given build
+// tags, then parses the declarations of all of its files.
+func (t *CodeGenerator) LoadPackage(pattern string, generatedFile string, tags []string) error {
+	generatedPath, err := filepath.Abs(filepath.Join(t.dirName, generatedFile))
+	if err != nil {
+		return err
+	}
+
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles |
+			packages.NeedImports | packages.NeedDeps | packages.NeedSyntax |
+			packages.NeedTypes | packages.NeedTypesInfo,
+		Dir:  t.dirName,
+		Fset: t.fset,
+		// The previously generated file may be stale or missing entirely, so
+		// replace it with an empty file while loading the package.
+		Overlay: map[string][]byte{
+			generatedPath: []byte("package main\n"),
+		},
+	}
+	if len(tags) != 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(tags, ",")}
 	}
-	return tagMap
-}
 
-func (t *CodeGenerator) ParseGoFile(goFile string, tags []string) error {
-	t.currentFile = goFile
-	file, err := parser.ParseFile(t.fset, goFile, nil, parser.ParseComments)
+	pkgs, err := packages.Load(cfg, pattern)
 	if err != nil {
 		return err
 	}
-	tagsMap := t.ParseTags(file)
-	if len(tagsMap) > 0 {
-		found := false
-		for _, tag := range tags {
-			if _, ok := tagsMap[tag]; ok {
-				found = true
-				break
-			}
-			if _, ok := tagsMap["!"+tag]; ok {
-				found = false
-				break
-			}
+	if len(pkgs) != 1 {
+		return fmt.Errorf("expected exactly one package in %s, found %d", t.dirName, len(pkgs))
+	}
+
+	pkg := pkgs[0]
+	for _, e := range pkg.Errors {
+		// Contract code usually refers to declarations that only exist in the
+		// generated file, so type errors are expected at this point. Any type
+		// that can not be resolved is reported when it is used in the ABI.
+		if e.Kind == packages.TypeError {
+			continue
 		}
-		if !found {
-			return nil
+		return errors.New(e.Error())
+	}
+
+	if pkg.Name != "main" {
+		return nil
+	}
+
+	t.pkg = pkg.Types
+	t.info = pkg.TypesInfo
+	for _, file := range pkg.Syntax {
+		if t.fset.File(file.Pos()).Name() == generatedPath {
+			continue
+		}
+		if err := t.parseFile(file); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+func (t *CodeGenerator) parseFile(file *ast.File) error {
 	for _, imp := range file.Imports {
 		pkgName := imp.Path.Value
 		if isLargePackage(pkgName) {
@@ -1098,11 +1558,7 @@ func (t *CodeGenerator) ParseGoFile(goFile string, tags []string) error {
 		}
 	}
 
-	if file.Name.Name != "main" {
-		return nil
-	}
-
-	log.Println("Processing file:", goFile)
+	log.Println("Processing file:", t.fset.File(file.Pos()).Name())
 
 	for _, decl := range file.Decls {
 		switch v := decl.(type) {
@@ -1148,49 +1604,84 @@ func genCodeWithTemplate(tpl string, s interface{}) (string, error) {
 
 func (t *CodeGenerator) genActionCode(notify bool) error {
 	t.writeCode("        switch action.N {")
+	done := make(map[string]bool)
 	for _, action := range t.actions {
 		if action.IsNotify == notify {
 		} else {
 			continue
 		}
+		if done[action.ActionName] {
+			continue
+		}
+		done[action.ActionName] = true
 		t.writeCode("        case uint64(%d): //%s", StringToName(action.ActionName), action.ActionName)
-		if !action.Ignore {
-			t.writeCode("            t := %s{}", action.ActionName)
-			t.writeCode("            t.Unpack(data)")
-			args := "("
-			for i, member := range action.Members {
-				if member.IsPointer() {
-					args += "&t." + member.Name
-				} else {
-					args += "t." + member.Name
-				}
+		if action.NotifyCode == "" || action.NotifyCode == "*" {
+			if err := t.genActionCall(&action, "            "); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Handlers of the action of specific contracts.
+		t.writeCode("            switch firstReceiver.N {")
+		for _, handler := range t.actions {
+			if handler.IsNotify != notify || handler.ActionName != action.ActionName {
+				continue
+			}
+			t.writeCode("            case uint64(%d): //%s", StringToName(handler.NotifyCode), handler.NotifyCode)
+			if err := t.genActionCall(&handler, "                "); err != nil {
+				return err
+			}
+		}
+		t.writeCode("            }")
+	}
+	t.writeCode("        }")
+	return nil
+}
+
+// genActionCall generates the code that unpacks the action data and calls
+// the handler of the action.
+func (t *CodeGenerator) genActionCall(action *ActionInfo, indent string) error {
+	if !action.Ignore {
+		t.writeCode("%st := %s{}", indent, action.TypeName())
+		t.writeCode("%st.Unpack(data)", indent)
+		for _, param := range action.Auth {
+			t.writeCode("%schain.RequireAuth(t.%s)", indent, param)
+		}
+		if action.ReadOnly {
+			t.writeCode("%st.dispatch(contract)", indent)
+			return nil
+		}
+		t.writeCode("%s%s", indent, action.callCode(action.callArgs()))
+	} else {
+		args := "("
+		for i, member := range action.Members {
+			if member.IsPointer() || member.IsSlice() {
+				//args += "&t." + member.Name
+				args += "nil"
 				if i != len(action.Members)-1 {
 					args += ", "
 				}
+			} else {
+				return fmt.Errorf("ignore action has not pointer parameter: %s", member.Name)
 			}
-			args += ")"
-			t.writeCode("            contract.%s%s", action.FuncName, args)
-		} else {
-			args := "("
-			for i, member := range action.Members {
-				if member.IsPointer() || member.IsSlice() {
-					//args += "&t." + member.Name
-					args += "nil"
-					if i != len(action.Members)-1 {
-						args += ", "
-					}
-				} else {
-					return fmt.Errorf("ignore action has not pointer parameter: %s", member.Name)
-				}
-			}
-			args += ")"
-			t.writeCode("            contract.%s%s", action.FuncName, args)
 		}
+		args += ")"
+		t.writeCode("%s%s", indent, action.callCode(args))
 	}
-	t.writeCode("        }")
 	return nil
 }
 
+// genDispatchCode generates the method that calls the handler of a read-only
+// action. It is never inlined, so the build can find the functions that the
+// action reaches by the name of the method.
+func (t *CodeGenerator) genDispatchCode(action *ActionInfo) {
+	t.writeCode("//go:noinline")
+	t.writeCode("func (t *%s) dispatch(contract *%s) {", action.ActionName, action.StructName)
+	t.writeCode("    %s", action.callCode(action.callArgs()))
+	t.writeCode("}")
+}
+
 func (t *CodeGenerator) GenActionCode() {
 	t.genActionCode(false)
 }
@@ -1213,15 +1704,20 @@ func packArrayType(goName string, goType string) (string, error) {
 		return fmt.Sprintf("enc.PackBytes(t.%s)", goName), nil
 	} else {
 		packMember := packNotArrayType(goName+"[i]", goType, "        ")
-		code, err := genCodeWithTemplate(`
+		return packArrayLoop(goName, packMember)
+	}
+}
+
+// packArrayLoop packs the slice t.<goName> with packMember, which packs the
+// element t.<goName>[i].
+func packArrayLoop(goName string, packMember string) (string, error) {
+	return genCodeWithTemplate(`
 	{
 		enc.PackLength(len(t.{{.name}}))
 		for i := range t.{{.name}} {
 			{{.packMember}}
 		}
 	}`, map[string]string{"name": goName, "packMember": packMember})
-		return code, err
-	}
 }
 
 func unpackType(funcName string, varName string) string {
@@ -1245,6 +1741,75 @@ func (t *CodeGenerator) genStruct(structName string, members []StructMember) {
 	t.writeCode("}")
 }
 
+// genActionSenders generates the functions that create and send the action
+// with the packed struct of the action as data.
+func (t *CodeGenerator) genActionSenders(action *ActionInfo) error {
+	type ActionSender struct {
+		Name        string
+		ActionName  string
+		RawName     uint64
+		Params      string
+		Args        string
+		Values      string
+		Pointers    []string
+		Data        string
+		Permissions string
+		SenderID    string
+		Payer       string
+		DelaySec    string
+		Tx          string
+	}
+
+	// The names of the parameters of the action are kept, so the names of
+	// the other parameters and variables must not collide with them.
+	used := make(map[string]bool)
+	for _, member := range action.Members {
+		used[member.Name] = true
+	}
+	name := func(s string) string {
+		for used[s] {
+			s += "_"
+		}
+		return s
+	}
+
+	s := ActionSender{
+		Name:        strings.ToUpper(action.FuncName[:1]) + action.FuncName[1:],
+		ActionName:  action.ActionName,
+		RawName:     StringToName(action.ActionName),
+		Permissions: name("permissions"),
+		SenderID:    name("senderID"),
+		Payer:       name("payer"),
+		DelaySec:    name("delaySec"),
+		Tx:          name("tx"),
+		Data:        name("data"),
+	}
+	values := make([]string, 0, len(action.Members))
+	for _, member := range action.Members {
+		if member.Name == "chain" {
+			return t.newError(member.Pos, "parameter %s of %s shadows the chain package", member.Name, action.ActionName)
+		}
+		switch {
+		case member.IsSlice():
+			s.Params += fmt.Sprintf(", %s []%s", member.Name, member.Type)
+		case member.IsPointer():
+			s.Params += fmt.Sprintf(", %s *%s", member.Name, member.Type)
+		default:
+			s.Params += fmt.Sprintf(", %s %s", member.Name, member.Type)
+		}
+		s.Args += ", " + member.Name
+		if member.IsPointer() {
+			// The action stores the value, and a nil pointer is packed
+			// as the zero value.
+			s.Pointers = append(s.Pointers, member.Name)
+		} else {
+			values = append(values, fmt.Sprintf("%s: %s", member.Name, member.Name))
+		}
+	}
+	s.Values = strings.Join(values, ", ")
+	return t.writeCodeEx(cActionSenderTemplate, s)
+}
+
 func (t *CodeGenerator) hasFinalizeFunction() bool {
 	funcs, ok := t.functionMap[t.contractStructName]
 	if !ok {
@@ -1278,6 +1843,15 @@ func (t *CodeGenerator) genPackUnpackCode(structName string, members []StructMem
 		return
 	}
 
+	if t.zeroCopy && !t.storedStructs[structName] {
+		aliased := make([]StructMember, len(members))
+		copy(aliased, members)
+		for i := range aliased {
+			aliased[i].zeroCopy = true
+		}
+		members = aliased
+	}
+
 	type Struct struct {
 		StructName string
 		Members    []StructMember
@@ -1290,6 +1864,49 @@ func (t *CodeGenerator) genPackUnpackCode(structName string, members []StructMem
 	t.writeCode(code)
 }
 
+// findStoredStructs returns the structs that are stored in tables, as the
+// type of a table or in a member of a stored struct. They are unpacked from
+// the database, so they must not alias the data.
+func (t *CodeGenerator) findStoredStructs() map[string]bool {
+	stored := make(map[string]bool)
+	var addStruct func(name string)
+	var addContainer func(c *containerType)
+	addStruct = func(name string) {
+		if stored[name] {
+			return
+		}
+		info, ok := t.structMap[name]
+		if !ok {
+			info, ok = t.VariantMap[name]
+		}
+		if !ok {
+			return
+		}
+		stored[name] = true
+		for _, member := range info.Members {
+			if member.container != nil {
+				addContainer(member.container)
+			} else {
+				addStruct(member.Type)
+			}
+		}
+	}
+	addContainer = func(c *containerType) {
+		if c == nil {
+			return
+		}
+		if c.kind == CONTAINER_NONE {
+			addStruct(c.value.Type)
+		}
+		addContainer(c.key)
+		addContainer(c.elem)
+	}
+	for _, table := range t.tables {
+		addStruct(table.StructInfo.StructName)
+	}
+	return stored
+}
+
 func (t *CodeGenerator) genPackUnpackCodeForVariant(structName string, members []StructMember) {
 	type Struct struct {
 		StructName string
@@ -1366,12 +1983,7 @@ func (t *CodeGenerator) genSizeCodeForSpecialStruct(specialType int, structName
 		t.writeCode("    if !t.HasValue {")
 		t.writeCode("        return size")
 		t.writeCode("    }")
-		if member.IsSlice() {
-			t.writeCode("    size += chain.PackedVarUint32Length(uint32(len(t.%s)))", member.Name)
-			t.writeCode(calcArrayMemberSize(member.Name, member.Type))
-		} else {
-			t.writeCode(calcNotArrayMemberSize(member.Name, member.Type))
-		}
+		t.writeCode(member.GetSize())
 		t.writeCode("    return size")
 		t.writeCode("}")
 	} else if specialType == OptionalType {
@@ -1380,12 +1992,7 @@ func (t *CodeGenerator) genSizeCodeForSpecialStruct(specialType int, structName
 		t.writeCode("    if !t.IsValid {")
 		t.writeCode("        return size")
 		t.writeCode("    }")
-		if member.IsSlice() {
-			t.writeCode("    size += chain.PackedVarUint32Length(uint32(len(t.%s)))", member.Name)
-			t.writeCode(calcArrayMemberSize(member.Name, member.Type))
-		} else {
-			t.writeCode(calcNotArrayMemberSize(member.Name, member.Type))
-		}
+		t.writeCode(member.GetSize())
 		t.writeCode("    return size")
 		t.writeCode("}")
 	}
@@ -1395,29 +2002,66 @@ func (t *CodeGenerator) GenCode(generatedFile string) error {
 	if generatedFile == "" {
 		generatedFile = "generated.go"
 	}
-	f, err := os.Create(filepath.Join(t.dirName, generatedFile))
+	code, err := t.genCode()
 	if err != nil {
 		return err
 	}
-	t.codeFile = f
+	return ioutil.WriteFile(filepath.Join(t.dirName, generatedFile), code, 0644)
+}
+
+// genCode returns the contents of the generated Go file.
+func (t *CodeGenerator) genCode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	t.codeFile = buf
+	if err := t.writeGeneratedCode(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
+func (t *CodeGenerator) writeGeneratedCode() error {
 	for _, info := range t.structs {
 		log.Println("++struct:", info.StructName)
 	}
 
 	t.writeCode(cImportCode)
+	if t.zeroCopy {
+		t.storedStructs = t.findStoredStructs()
+		t.writeCode(cZeroCopyCode)
+	}
 
 	for _, action := range t.actions {
-		t.genStruct(action.ActionName, action.Members)
+		t.genStruct(action.TypeName(), action.Members)
 		for _, v := range action.Members {
 			if v.LeadingType == TYPE_UNSUPPORTED {
 				return t.newError(v.Pos, "type of %s is unsupported in %s", v.Name, action.ActionName)
 			}
 		}
-		t.genPackUnpackCode(action.ActionName, action.Members)
+		t.genPackUnpackCode(action.TypeName(), action.Members)
+		if !action.IsNotify {
+			if err := t.genActionSenders(&action); err != nil {
+				return err
+			}
+		}
+
+		if action.Result != nil {
+			if action.Result.LeadingType == TYPE_UNSUPPORTED || action.Result.LeadingType == TYPE_POINTER {
+				return t.newError(action.Result.Pos, "return type %s of %s is unsupported", action.Result.Type, action.ActionName)
+			}
+			results := []StructMember{*action.Result}
+			t.genStruct(action.ResultStructName(), results)
+			t.genPackUnpackCode(action.ResultStructName(), results)
+		}
+
+		if action.ReadOnly && !action.Ignore {
+			t.genDispatchCode(&action)
+		}
 	}
 
-	for _, _struct := range t.abiStructsMap {
+	for _, _struct := range t.sortedStructs(t.abiStructsMap) {
+		if err := t.checkEmbedded(_struct); err != nil {
+			return err
+		}
 		for _, v := range _struct.Members {
 			if v.LeadingType == TYPE_UNSUPPORTED || v.LeadingType == TYPE_POINTER {
 				return t.newError(v.Pos, "unsupported type %s in %s", v.Type, _struct.StructName)
@@ -1426,7 +2070,14 @@ func (t *CodeGenerator) GenCode(generatedFile string) error {
 		t.genPackUnpackCode(_struct.StructName, _struct.Members)
 	}
 
-	for _, _struct := range t.PackerMap {
+	for _, _struct := range t.sortedStructs(t.PackerMap) {
+		if _, ok := t.abiStructsMap[_struct.StructName]; ok {
+			// already generated above
+			continue
+		}
+		if err := t.checkEmbedded(_struct); err != nil {
+			return err
+		}
 		for _, v := range _struct.Members {
 			if v.LeadingType == TYPE_UNSUPPORTED || v.LeadingType == TYPE_POINTER {
 				return t.newError(v.Pos, "unsupported type %s in %s", v.Type, _struct.StructName)
@@ -1435,7 +2086,7 @@ func (t *CodeGenerator) GenCode(generatedFile string) error {
 		t.genPackUnpackCode(_struct.StructName, _struct.Members)
 	}
 
-	for _, _struct := range t.VariantMap {
+	for _, _struct := range t.sortedStructs(t.VariantMap) {
 		t.genPackUnpackCodeForVariant(_struct.StructName, _struct.Members)
 	}
 
@@ -1493,43 +2144,64 @@ func (t *CodeGenerator) GenCode(generatedFile string) error {
 	return nil
 }
 
-func (t *CodeGenerator) GenAbi() error {
-	var abiFile string
+// abiFile returns the path of the ABI file.
+func (t *CodeGenerator) abiFile() string {
 	if t.contractName == "" {
-		abiFile = t.dirName + "/generated.abi"
-	} else {
-		abiFile = t.dirName + "/" + t.contractName + ".abi"
+		return t.dirName + "/generated.abi"
 	}
+	return t.dirName + "/" + t.contractName + ".abi"
+}
 
-	f, err := os.Create(abiFile)
+func (t *CodeGenerator) GenAbi() error {
+	result, err := t.genAbiJSON()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	return ioutil.WriteFile(t.abiFile(), result, 0644)
+}
 
-	abi := ABI{}
+// genAbiJSON returns the contents of the ABI file.
+func (t *CodeGenerator) genAbiJSON() ([]byte, error) {
+	abi, err := t.genAbi()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(abi, "", "    ")
+}
+
+func (t *CodeGenerator) genAbi() (*ABI, error) {
+	abi := &ABI{}
 	abi.Version = "eosio::abi/1.1"
 	abi.Structs = make([]ABIStruct, 0, len(t.structs)+len(t.actions))
 
-	abi.Types = []string{}
+	abi.Types = []ABITypeDef{}
 	abi.Actions = []ABIAction{}
 	abi.Tables = []ABITable{}
-	abi.RicardianClauses = []string{}
+	abi.RicardianClauses = make([]ABIRicardianClause, 0, len(t.ricardianClauses))
+	abi.RicardianClauses = append(abi.RicardianClauses, t.ricardianClauses...)
 	abi.Variants = []VariantDef{}
 	abi.AbiExtensions = []string{}
 	abi.ErrorMessages = []string{}
 
-	for _, _struct := range t.abiStructsMap {
+	for _, _struct := range t.sortedStructs(t.abiStructsMap) {
 		if _struct.IgnoreFromABI {
 			continue
 		}
+		if err := t.checkEmbedded(_struct); err != nil {
+			return nil, err
+		}
 		s := ABIStruct{}
 		s.Name = _struct.StructName
 		s.Base = ""
 		s.Fields = make([]ABIStructField, 0, len(_struct.Members))
 		for _, member := range _struct.Members {
+			if member.Embedded {
+				s.Base = member.Type
+				continue
+			}
 			abiType, err := t.convertType(member)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			field := ABIStructField{Name: member.Name, Type: abiType}
 			s.Fields = append(s.Fields, field)
@@ -1538,6 +2210,9 @@ func (t *CodeGenerator) GenAbi() error {
 	}
 
 	for _, action := range t.actions {
+		if !action.inABI() {
+			continue
+		}
 		s := ABIStruct{}
 		s.Name = action.ActionName
 		s.Base = ""
@@ -1545,7 +2220,7 @@ func (t *CodeGenerator) GenAbi() error {
 		for _, member := range action.Members {
 			abiType, err := t.convertType(member)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			field := ABIStructField{Name: member.Name, Type: abiType}
 			s.Fields = append(s.Fields, field)
@@ -1555,11 +2230,28 @@ func (t *CodeGenerator) GenAbi() error {
 
 	abi.Actions = make([]ABIAction, 0, len(t.actions))
 	for _, action := range t.actions {
+		if !action.inABI() {
+			continue
+		}
 		a := ABIAction{}
 		a.Name = action.ActionName
 		a.Type = action.ActionName
-		a.RicardianContract = ""
+		a.RicardianContract = action.Ricardian
+		a.ReadOnly = action.ReadOnly
 		abi.Actions = append(abi.Actions, a)
+
+		if action.Result != nil {
+			resultType, err := t.convertType(*action.Result)
+			if err != nil {
+				return nil, err
+			}
+			abi.ActionResults = append(abi.ActionResults, ABIActionResult{action.ActionName, resultType})
+		}
+	}
+
+	// Action return values were introduced in ABI version 1.2.
+	if len(abi.ActionResults) != 0 {
+		abi.Version = "eosio::abi/1.2"
 	}
 
 	for _, table := range t.tables {
@@ -1573,10 +2265,24 @@ func (t *CodeGenerator) GenAbi() error {
 		abiTable.IndexType = "i64"
 		abiTable.KeyNames = []string{}
 		abiTable.KeyTypes = []string{}
+		if !table.Singleton {
+			// Keys are listed in the order of the indexes of the multi-index
+			// table: the primary key first, followed by the secondary indexes.
+			primaryKeyName := table.PrimaryKeyName
+			if primaryKeyName == "" {
+				primaryKeyName = "primary"
+			}
+			abiTable.KeyNames = append(abiTable.KeyNames, primaryKeyName)
+			abiTable.KeyTypes = append(abiTable.KeyTypes, "i64")
+			for _, index := range table.SecondaryIndexes {
+				abiTable.KeyNames = append(abiTable.KeyNames, index.Name)
+				abiTable.KeyTypes = append(abiTable.KeyTypes, indexTypeToAbiKeyType(index.Type))
+			}
+		}
 		abi.Tables = append(abi.Tables, abiTable)
 	}
 
-	for _, variant := range t.VariantMap {
+	for _, variant := range t.sortedStructs(t.VariantMap) {
 		// type VariantDef struct {
 		// 	Name  string   `json:"name"`
 		// 	Types []string `json:"types"`
@@ -1586,19 +2292,27 @@ func (t *CodeGenerator) GenAbi() error {
 		for _, member := range variant.Members {
 			tp, err := t.convertType(member)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			v.Types = append(v.Types, tp)
 		}
 		abi.Variants = append(abi.Variants, v)
 	}
 
+	// The types and the pair structs of maps are collected while converting the types above.
+	for name, typ := range t.typeDefs {
+		abi.Types = append(abi.Types, ABITypeDef{NewTypeName: name, Type: typ})
+	}
+	for _, s := range t.pairStructs {
+		abi.Structs = append(abi.Structs, s)
+	}
+
 	sort.Slice(abi.Structs, func(i, j int) bool {
 		return strings.Compare(abi.Structs[i].Name, abi.Structs[j].Name) < 0
 	})
 
 	sort.Slice(abi.Types, func(i, j int) bool {
-		return strings.Compare(abi.Types[i], abi.Types[j]) < 0
+		return strings.Compare(abi.Types[i].NewTypeName, abi.Types[j].NewTypeName) < 0
 	})
 
 	sort.Slice(abi.Actions, func(i, j int) bool {
@@ -1609,73 +2323,65 @@ func (t *CodeGenerator) GenAbi() error {
 		return strings.Compare(abi.Tables[i].Name, abi.Tables[j].Name) < 0
 	})
 
+	sort.Slice(abi.ActionResults, func(i, j int) bool {
+		return strings.Compare(abi.ActionResults[i].Name, abi.ActionResults[j].Name) < 0
+	})
+
 	// Structs          []ABIStruct `json:"structs"`
 	// Types            []string    `json:"types"`
 	// Actions          []ABIAction `json:"actions"`
 	// Tables           []ABITable  `json:"tables"`
 
-	result, err := json.MarshalIndent(abi, "", "    ")
-	if err != nil {
-		panic(err)
-	}
-	f.Write(result)
-	f.Close()
-	return nil
+	return abi, nil
 }
 
-func (t *CodeGenerator) FetchAllGoFiles(dir string) []string {
-	goFiles := []string{}
-	files, err := ioutil.ReadDir(dir)
-	if err != nil {
-		log.Fatal(err)
+// sortedStructs returns the structs of m in the order of their declarations,
+// so that the generated files do not depend on the iteration order of m.
+func (t *CodeGenerator) sortedStructs(m map[string]*StructInfo) []*StructInfo {
+	structs := make([]*StructInfo, 0, len(m))
+	for _, s := range m {
+		structs = append(structs, s)
 	}
-
-	for _, f := range files {
-		if f.IsDir() {
-			continue
+	sort.Slice(structs, func(i, j int) bool {
+		a, b := t.fset.Position(structs[i].Pos), t.fset.Position(structs[j].Pos)
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
 		}
-
-		if filepath.Ext(f.Name()) != ".go" {
-			continue
-		}
-
-		if f.Name() == "generated.go" {
-			continue
-		}
-		goFiles = append(goFiles, path.Join(dir, f.Name()))
-	}
-	return goFiles
-}
-
-func (t *CodeGenerator) Finish() {
-	t.codeFile.Close()
+		return a.Offset < b.Offset
+	})
+	return structs
 }
 
-func (t *CodeGenerator) isSpecialAbiType(goType string) (string, bool) {
-	for _, specialType := range t.specialAbiTypes {
-		if specialType.name == goType {
-			return specialType.member.Type, true
+func (t *CodeGenerator) findSpecialAbiType(goType string) *SpecialAbiType {
+	for i := range t.specialAbiTypes {
+		if t.specialAbiTypes[i].name == goType {
+			return &t.specialAbiTypes[i]
 		}
 	}
-	return "", false
+	return nil
 }
 
 func (t *CodeGenerator) addAbiStruct(s *StructInfo) {
+	if _, ok := t.abiStructsMap[s.StructName]; ok {
+		return
+	}
 	t.abiStructsMap[s.StructName] = s
 	for _, member := range s.Members {
-		s2, ok := t.structMap[member.Type]
+		t.addAbiStructsOf(member)
+	}
+}
+
+// addAbiStructsOf adds the structs member is composed of to the ABI.
+func (t *CodeGenerator) addAbiStructsOf(member StructMember) {
+	for _, name := range member.typeNames() {
+		s2, ok := t.structMap[name]
 		if ok {
 			t.addAbiStruct(s2)
 			continue
 		}
 
-		typeName, ok := t.isSpecialAbiType(member.Type)
-		if ok {
-			log.Println("++++++++++isSpecialAbiType:", typeName)
-			s2, ok := t.structMap[typeName]
-			if ok {
-				t.addAbiStruct(s2)
-			}
+		if specialType := t.findSpecialAbiType(name); specialType != nil {
+			t.addAbiStructsOf(specialType.member)
 		}
 	}
 }
@@ -1693,10 +2399,10 @@ func (t *CodeGenerator) Analyse() {
 
 	for _, action := range t.actions {
 		for _, member := range action.Members {
-			item, ok := t.structMap[member.Type]
-			if ok {
-				t.addAbiStruct(item)
-			}
+			t.addAbiStructsOf(member)
+		}
+		if action.Result != nil {
+			t.addAbiStructsOf(*action.Result)
 		}
 	}
 
@@ -1706,42 +2412,75 @@ func (t *CodeGenerator) Analyse() {
 	}
 }
 
-func GenerateCode(inFile string, outFile string, tags []string) error {
+func GenerateCode(inFile string, outFile string, tags []string, options *compileopts.Options) error {
+	_, err := generateCode(inFile, outFile, tags, options)
+	return err
+}
+
+// generateCode generates the code and the ABI of the contract like
+// GenerateCode, and returns the parsed contract.
+func generateCode(inFile string, outFile string, tags []string, options *compileopts.Options) (*CodeGenerator, error) {
+	if outFile == "" {
+		outFile = "generated.go"
+	}
+	gen, err := loadContract(inFile, outFile, tags, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gen.LoadRicardian(); err != nil {
+		return nil, err
+	}
+
+	if gen.strictRicardian {
+		if err := gen.checkRicardian(); err != nil {
+			return nil, err
+		}
+	}
+
+	gen.Analyse()
+	if options.CheckGenerated {
+		return gen, gen.checkGenerated(outFile)
+	}
+
+	if err := gen.GenAbi(); err != nil {
+		return nil, err
+	}
+
+	if err := gen.GenCode(outFile); err != nil {
+		return nil, err
+	}
+	return gen, nil
+}
+
+// loadContract parses the actions and tables of the contract in inFile, which
+// is a package directory or a Go file. The generated file outFile is left
+// out.
+func loadContract(inFile string, outFile string, tags []string, options *compileopts.Options) (*CodeGenerator, error) {
 	// log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
 	gen := NewCodeGenerator()
 	gen.fset = token.NewFileSet()
+	gen.strictRicardian = options.StrictRicardian
+	gen.zeroCopy = options.ZeroCopy
 
+	pattern := "."
 	if filepath.Ext(inFile) == ".go" {
 		gen.dirName = filepath.Dir(inFile)
-		if err := gen.ParseGoFile(inFile, tags); err != nil {
-			return err
-		}
+		pattern = "./" + filepath.Base(inFile)
 	} else {
 		gen.dirName = inFile
-		goFiles := gen.FetchAllGoFiles(inFile)
-		for _, f := range goFiles {
-			if err := gen.ParseGoFile(f, tags); err != nil {
-				return err
-			}
-		}
+	}
+
+	if err := gen.LoadPackage(pattern, outFile, tags); err != nil {
+		return nil, err
 	}
 
 	if gen.contractStructName != "" {
 		if !gen.hasNewContractFunc {
 			errorMsg := `NewContract function not defined, Please define it like this: func NewContract(receiver, firstReceiver, action chain.Name) *` + gen.contractStructName
-			return errors.New(errorMsg)
+			return nil, errors.New(errorMsg)
 		}
 	}
-
-	gen.Analyse()
-	if err := gen.GenAbi(); err != nil {
-		return err
-	}
-
-	if err := gen.GenCode(outFile); err != nil {
-		return err
-	}
-	gen.Finish()
-	return nil
+	return gen, nil
 }
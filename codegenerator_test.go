@@ -0,0 +1,597 @@
+package main
+
+// This file tests the contract code generator by loading the contract
+// packages in testdata/codegen and checking the resulting ABI.
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/token"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadTestContract loads and analyses the contract in testdata/codegen/<name>
+// the same way GenerateCode does for the eosio target.
+func loadTestContract(t *testing.T, name string) *CodeGenerator {
+	t.Helper()
+	gen := NewCodeGenerator()
+	gen.fset = token.NewFileSet()
+	gen.dirName = filepath.Join("testdata", "codegen", name)
+	if err := gen.LoadPackage(".", "generated.go", []string{"tinygo.wasm", "eosio"}); err != nil {
+		t.Fatal("failed to load contract:", err)
+	}
+	gen.Analyse()
+	return gen
+}
+
+func findAbiStruct(abi *ABI, name string) *ABIStruct {
+	for i := range abi.Structs {
+		if abi.Structs[i].Name == name {
+			return &abi.Structs[i]
+		}
+	}
+	return nil
+}
+
+func TestCodeGeneratorTypeResolution(t *testing.T) {
+	gen := loadTestContract(t, "typeresolve")
+	abi, err := gen.genAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ignored.go is excluded by its build constraint.
+	if len(abi.Actions) != 1 || abi.Actions[0].Name != "transfer" {
+		t.Fatalf("unexpected actions: %v", abi.Actions)
+	}
+
+	tests := []struct {
+		name   string
+		fields []ABIStructField
+	}{
+		{"transfer", []ABIStructField{
+			{"from", "AccountName"},
+			{"to", "name"},
+			{"quantity", "asset"},
+			{"memo", "string"},
+			{"info", "Info"},
+		}},
+		{"Info", []ABIStructField{
+			{"owner", "name"},
+			{"values", "uint128[]"},
+		}},
+	}
+	for _, tc := range tests {
+		s := findAbiStruct(abi, tc.name)
+		if s == nil {
+			t.Errorf("struct %s not found in ABI", tc.name)
+			continue
+		}
+		if !reflect.DeepEqual(s.Fields, tc.fields) {
+			t.Errorf("struct %s: expected fields %v, got %v", tc.name, tc.fields, s.Fields)
+		}
+	}
+}
+
+func TestCodeGeneratorRicardian(t *testing.T) {
+	gen := loadTestContract(t, "ricardian")
+	if err := gen.LoadRicardian(); err != nil {
+		t.Fatal(err)
+	}
+	abi, err := gen.genAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedActions := []ABIAction{
+		{"nodoc", "nodoc", "", false},
+		{"saybye", "saybye", "---\nspec_version: \"0.2.0\"\ntitle: Say Bye\n---\n\n{{name}} says bye.", false},
+		{"sayhello", "sayhello", "Say hello to {{name}}.", false},
+	}
+	if !reflect.DeepEqual(abi.Actions, expectedActions) {
+		t.Errorf("expected actions %#v, got %#v", expectedActions, abi.Actions)
+	}
+
+	expectedClauses := []ABIRicardianClause{
+		{"UserAgreement", "User agreement for the chain can go here."},
+		{"BlockProducerAgreement", "I, {{producer}}, hereby nominate myself."},
+	}
+	if !reflect.DeepEqual(abi.RicardianClauses, expectedClauses) {
+		t.Errorf("expected clauses %#v, got %#v", expectedClauses, abi.RicardianClauses)
+	}
+
+	err = gen.checkRicardian()
+	if err == nil || !strings.Contains(err.Error(), "action nodoc has no ricardian contract") {
+		t.Errorf("expected missing ricardian contract error, got %v", err)
+	}
+}
+
+func TestRicardianFromDoc(t *testing.T) {
+	doc := &ast.CommentGroup{List: []*ast.Comment{
+		{Text: "// Say hello to {{name}}.  "},
+		{Text: "//action sayhello"},
+		{Text: "/* Only once. */"},
+	}}
+	if ricardian := ricardianFromDoc(doc); ricardian != "Say hello to {{name}}.\nOnly once." {
+		t.Errorf("unexpected ricardian contract %q", ricardian)
+	}
+	doc = &ast.CommentGroup{List: []*ast.Comment{{Text: "//notify transfer"}}}
+	if ricardian := ricardianFromDoc(doc); ricardian != "" {
+		t.Errorf("unexpected ricardian contract %q", ricardian)
+	}
+}
+
+func TestCodeGeneratorTables(t *testing.T) {
+	gen := loadTestContract(t, "tables")
+	abi, err := gen.genAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fields that eosio-cpp also emits: the table name, the row type and
+	// the index type.
+	var tables []ABITable
+	for _, table := range abi.Tables {
+		tables = append(tables, ABITable{Name: table.Name, Type: table.Type, IndexType: table.IndexType})
+	}
+	expected := []ABITable{
+		{Name: "accounts", Type: "Account", IndexType: "i64"},
+		{Name: "config", Type: "Config", IndexType: "i64"},
+		{Name: "mydata", Type: "MyData", IndexType: "i64"},
+	}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Errorf("expected tables %#v, got %#v", expected, tables)
+	}
+
+	// eosio-cpp leaves key_names and key_types empty. generator-keys.json is
+	// what this code generator emits for them: the primary key and the
+	// secondary indexes of contract.go.
+	data, err := os.ReadFile(filepath.Join("testdata", "codegen", "tables", "generator-keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expectedKeys map[string]struct {
+		KeyNames []string `json:"key_names"`
+		KeyTypes []string `json:"key_types"`
+	}
+	if err := json.Unmarshal(data, &expectedKeys); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range abi.Tables {
+		keys, ok := expectedKeys[table.Name]
+		if !ok {
+			t.Errorf("unexpected table %s", table.Name)
+			continue
+		}
+		if !reflect.DeepEqual(table.KeyNames, keys.KeyNames) || !reflect.DeepEqual(table.KeyTypes, keys.KeyTypes) {
+			t.Errorf("table %s: expected keys %v %v, got %v %v", table.Name, keys.KeyNames, keys.KeyTypes, table.KeyNames, table.KeyTypes)
+		}
+	}
+}
+
+func TestCodeGeneratorTableIteration(t *testing.T) {
+	gen := loadTestContract(t, "tables")
+	code, err := gen.genCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"func (mi *MyDataTable) LowerBound(id uint64) (*database.Iterator, *MyData) {",
+		"func (mi *MyDataTable) Range(lo, hi uint64, fn func(it *database.Iterator, v *MyData) bool) {",
+		"func (mi *MyDataTable) RangeReverse(lo, hi uint64, fn func(it *database.Iterator, v *MyData) bool) {",
+		"func (mi *MyDataTable) EraseByIterator(it *database.Iterator) *database.Iterator {",
+		"func (mi *MyDataTable) Modify(it *database.Iterator, payer chain.Name, fn func(v *MyData)) {",
+		// The secondary indexes take values of their own type.
+		"func (mi *MyDataTable) UpperBoundBybya1(secondary uint64) (*database.SecondaryIterator, *MyData) {",
+		"func (mi *MyDataTable) RangeBybya2(lo, hi chain.Uint128, fn func(it *database.SecondaryIterator, v *MyData) bool) {",
+		"func (mi *MyDataTable) RangeReverseBybya5(lo, hi chain.Float128, fn func(it *database.SecondaryIterator, v *MyData) bool) {",
+		"func (mi *MyDataTable) EraseBybya3(it *database.SecondaryIterator) *database.SecondaryIterator {",
+		"func (mi *MyDataTable) ModifyBybya4(it *database.SecondaryIterator, payer chain.Name, fn func(v *MyData)) {",
+		"func (mi *AccountTable) RangeByowner(lo, hi uint64, fn func(it *database.SecondaryIterator, v *Account) bool) {\n\tif lo > hi {\n\t\treturn\n\t}",
+		"func (mi *MyDataTable) RangeBybya3(lo, hi chain.Uint256, fn func(it *database.SecondaryIterator, v *MyData) bool) {\n\tif lo.Cmp(&hi) > 0 {\n\t\treturn\n\t}",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Errorf("generated code does not contain %q", expected)
+		}
+	}
+	// Singletons have no rows to iterate.
+	if bytes.Contains(code, []byte("func (mi *ConfigTable) Range(")) {
+		t.Error("range iteration generated for singleton")
+	}
+}
+
+func TestCodeGeneratorActionResults(t *testing.T) {
+	gen := loadTestContract(t, "results")
+	abi, err := gen.genAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if abi.Version != "eosio::abi/1.2" {
+		t.Errorf("expected ABI version 1.2, got %s", abi.Version)
+	}
+	expected := []ABIActionResult{
+		{"getbalance", "Balance"},
+		{"getids", "uint64[]"},
+	}
+	if !reflect.DeepEqual(abi.ActionResults, expected) {
+		t.Errorf("expected action results %#v, got %#v", expected, abi.ActionResults)
+	}
+	if findAbiStruct(abi, "Balance") == nil {
+		t.Error("struct Balance is missing from the ABI")
+	}
+}
+
+func TestCodeGeneratorEmbeddedStruct(t *testing.T) {
+	gen := loadTestContract(t, "embedded")
+	abi, err := gen.genAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Message", "Record"} {
+		s := findAbiStruct(abi, name)
+		if s == nil {
+			t.Errorf("struct %s not found in ABI", name)
+			continue
+		}
+		if s.Base != "Header" {
+			t.Errorf("expected base Header for %s, got %q", name, s.Base)
+		}
+	}
+	if s := findAbiStruct(abi, "Header"); s == nil || len(s.Fields) != 2 {
+		t.Errorf("unexpected base struct in ABI: %v", s)
+	}
+
+	gen = loadTestContract(t, "embeddedbad")
+	_, err = gen.genAbi()
+	if err == nil || !strings.Contains(err.Error(), "contract.go:24:2:") || !strings.Contains(err.Error(), "only the first field can be an embedded struct") {
+		t.Errorf("expected a positioned error for the embedded field, got %v", err)
+	}
+}
+
+func TestCodeGeneratorTypeDefs(t *testing.T) {
+	gen := loadTestContract(t, "typedefs")
+	abi, err := gen.genAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedTypes := []ABITypeDef{
+		{"AccountName", "name"},
+		{"Balance", "uint64"},
+		{"Balances", "uint64[]"},
+		{"Memo", "string"},
+	}
+	if !reflect.DeepEqual(abi.Types, expectedTypes) {
+		t.Errorf("expected types %#v, got %#v", expectedTypes, abi.Types)
+	}
+
+	expectedFields := []ABIStructField{
+		{"owner", "AccountName"},
+		{"balance", "Balance"},
+		{"history", "Balance[]"},
+		{"balances", "Balances"},
+		{"memo", "Memo"},
+	}
+	if s := findAbiStruct(abi, "Account"); s == nil || !reflect.DeepEqual(s.Fields, expectedFields) {
+		t.Errorf("expected fields %v, got %v", expectedFields, s)
+	}
+
+	// Defined types are packed with the encoder of their underlying type.
+	member := gen.structMap["Account"].Members[1]
+	if code := member.PackMember(); code != "enc.PackUint64((*(*uint64)(&t.balance)))" {
+		t.Errorf("unexpected pack code for %s: %s", member.Name, code)
+	}
+}
+
+func TestCodeGeneratorContainers(t *testing.T) {
+	gen := loadTestContract(t, "containers")
+	abi, err := gen.genAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFields := []ABIStructField{
+		{"matrix", "uint64[][]"},
+		{"names", "string[][]"},
+		{"blobs", "bytes[]"},
+		{"hash", "uint64[4]"},
+		{"points", "Point[2]"},
+		{"scores", "pair_string_uint64[]"},
+		{"ledger", "Ledger"},
+		{"paths", "pair_uint32_Point_array[]"},
+		{"ids", "uint64[]?"},
+		{"extra", "uint64[]?[]"},
+		{"extended", "uint32[][]$"},
+	}
+	if s := findAbiStruct(abi, "Data"); s == nil || !reflect.DeepEqual(s.Fields, expectedFields) {
+		t.Errorf("expected fields %v, got %v", expectedFields, s)
+	}
+
+	pairs := map[string][]ABIStructField{
+		"pair_string_uint64":      {{"key", "string"}, {"value", "uint64"}},
+		"pair_name_Balance":       {{"key", "name"}, {"value", "Balance"}},
+		"pair_uint32_Point_array": {{"key", "uint32"}, {"value", "Point[]"}},
+	}
+	for name, fields := range pairs {
+		if s := findAbiStruct(abi, name); s == nil || !reflect.DeepEqual(s.Fields, fields) {
+			t.Errorf("expected pair struct %s with fields %v, got %v", name, fields, s)
+		}
+	}
+
+	expectedTypes := []ABITypeDef{
+		{"Balance", "uint64"},
+		{"Ledger", "pair_name_Balance[]"},
+	}
+	if !reflect.DeepEqual(abi.Types, expectedTypes) {
+		t.Errorf("expected types %#v, got %#v", expectedTypes, abi.Types)
+	}
+
+	if s := findAbiStruct(abi, "setdata"); s == nil || s.Fields[1].Type != "Point[][]" {
+		t.Errorf("unexpected action struct: %v", s)
+	}
+	expectedResults := []ABIActionResult{{"getscores", "pair_string_uint64[]"}}
+	if !reflect.DeepEqual(abi.ActionResults, expectedResults) {
+		t.Errorf("expected action results %#v, got %#v", expectedResults, abi.ActionResults)
+	}
+
+	// Map keys are packed in ascending order.
+	for _, member := range gen.structMap["Data"].Members {
+		if member.Name != "ledger" {
+			continue
+		}
+		if code := member.PackMember(); !strings.Contains(code, "keys0[j0].N < keys0[j0-1].N") {
+			t.Errorf("keys of %s are not sorted:\n%s", member.Name, code)
+		}
+	}
+}
+
+func TestCodeGeneratorDeterministic(t *testing.T) {
+	var firstCode, firstAbi []byte
+	for i := 0; i < 5; i++ {
+		gen := loadTestContract(t, "containers")
+		abi, err := gen.genAbiJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := gen.genCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			firstCode, firstAbi = code, abi
+			continue
+		}
+		if !bytes.Equal(code, firstCode) {
+			t.Fatalf("generated code differs between runs:\n%s", unifiedDiff("generated.go", string(firstCode), string(code)))
+		}
+		if !bytes.Equal(abi, firstAbi) {
+			t.Fatalf("generated ABI differs between runs:\n%s", unifiedDiff("containers.abi", string(firstAbi), string(abi)))
+		}
+	}
+
+	// The test contracts have no generated files.
+	gen := loadTestContract(t, "containers")
+	err := gen.checkGenerated("generated.go")
+	if err == nil || !strings.Contains(err.Error(), "generated.go does not exist") {
+		t.Errorf("expected an error for the missing generated.go, got %v", err)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	b := "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk\n"
+	expected := `--- x
++++ x (generated)
+@@ -1,10 +1,11 @@
+ a
+ b
+ c
+-d
++D
+ e
+ f
+ g
+ h
+ i
+ j
++k
+`
+	if diff := unifiedDiff("x", a, b); diff != expected {
+		t.Errorf("expected diff:\n%s\ngot:\n%s", expected, diff)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	// Compare the edits with a longest common subsequence computed from
+	// the full table.
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 200; n++ {
+		a := make([]string, rnd.Intn(20))
+		b := make([]string, rnd.Intn(20))
+		for i := range a {
+			a[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		for i := range b {
+			b[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] > lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		var edits []diffEdit
+		diffLines(a, b, &edits)
+		var gotA, gotB []string
+		common := 0
+		for _, e := range edits {
+			if e.op != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != '-' {
+				gotB = append(gotB, e.line)
+			}
+			if e.op == ' ' {
+				common++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("edits %v don't turn %q into %q", edits, a, b)
+		}
+		if common != lcs[0][0] {
+			t.Fatalf("edits of %q and %q keep %d lines, expected %d", a, b, common, lcs[0][0])
+		}
+	}
+}
+
+func TestCodeGeneratorActionSenders(t *testing.T) {
+	gen := loadTestContract(t, "senders")
+	code, err := gen.genCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"func NewTransferAction(permissions []*chain.PermissionLevel, from chain.Name, to chain.Name, quantity chain.Asset, memo *OptionalMemo) *chain.Action {",
+		"data := &transfer{from: from, to: to, quantity: quantity}\n\tif memo != nil {\n\t\tdata.memo = *memo\n\t}\n",
+		"Data:          data.Pack(),",
+		"func SendTransferInline(permissions []*chain.PermissionLevel, from chain.Name, to chain.Name, quantity chain.Asset, memo *OptionalMemo) {",
+		// Parameters of the action keep their names.
+		"func SendSetPermsDeferred(senderID chain.Uint128, payer_ chain.Name, delaySec int, permissions_ []*chain.PermissionLevel, permissions []chain.Name, payer chain.Name) {",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Errorf("generated code does not contain %q", expected)
+		}
+	}
+	// Notify handlers are not actions of the contract.
+	if bytes.Contains(code, []byte("IssueAction")) || bytes.Contains(code, []byte("SendOnIssue")) {
+		t.Error("senders generated for notify handler")
+	}
+}
+
+func TestCodeGeneratorActionAttributes(t *testing.T) {
+	gen := loadTestContract(t, "attributes")
+	abi, err := gen.genAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range abi.Actions {
+		if action.ReadOnly != (action.Name == "getbalance") {
+			t.Errorf("unexpected read_only %v for action %s", action.ReadOnly, action.Name)
+		}
+	}
+
+	code, err := gen.genCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"t.Unpack(data)\n            chain.RequireAuth(t.from)\n            contract.Transfer(",
+		"chain.RequireAuth(t.owner)\n            chain.RequireAuth(t.spender)\n            contract.Approve(",
+		"func (t *getbalance) dispatch(contract *Contract) {",
+		"t.Unpack(data)\n            t.dispatch(contract)",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Errorf("generated code does not contain %q", expected)
+		}
+	}
+
+	gen = NewCodeGenerator()
+	gen.fset = token.NewFileSet()
+	gen.dirName = filepath.Join("testdata", "codegen", "attributesbad")
+	err = gen.LoadPackage(".", "generated.go", []string{"tinygo.wasm", "eosio"})
+	if err == nil || !strings.Contains(err.Error(), "auth parameter memo of action transfer must be a chain.Name") {
+		t.Errorf("expected an error for the auth parameter, got %v", err)
+	}
+}
+
+func TestCodeGeneratorNotifyContract(t *testing.T) {
+	gen := loadTestContract(t, "notify")
+	code, err := gen.genCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"type notify_eosio_token_transfer struct {",
+		"type notify_fake_token_transfer struct {",
+		"type notify_any_issue struct {",
+		"switch firstReceiver.N {\n            case uint64(6138663591592764928): //eosio.token\n                t := notify_eosio_token_transfer{}\n                t.Unpack(data)\n                contract.OnTransfer(",
+		"//fake.token\n                t := notify_fake_token_transfer{}",
+		"//issue\n            t := notify_any_issue{}",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Errorf("generated code does not contain %q", expected)
+		}
+	}
+
+	// The handlers aren't actions of the contract.
+	abi, err := gen.genAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(abi.Actions) != 1 || abi.Actions[0].Name != "transfer" {
+		t.Errorf("unexpected actions in the ABI: %v", abi.Actions)
+	}
+
+	gen = NewCodeGenerator()
+	gen.fset = token.NewFileSet()
+	gen.dirName = filepath.Join("testdata", "codegen", "notifybad")
+	err = gen.LoadPackage(".", "generated.go", []string{"tinygo.wasm", "eosio"})
+	if err == nil || !strings.Contains(err.Error(), "contract.go:20:1:") || !strings.Contains(err.Error(), "Notification handler *::transfer overlaps with the handler of eosio.token::transfer") {
+		t.Errorf("expected an error for the overlapping handler, got %v", err)
+	}
+}
+
+func TestCodeGeneratorZeroCopy(t *testing.T) {
+	gen := loadTestContract(t, "zerocopy")
+	gen.zeroCopy = true
+	code, err := gen.genCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unpack := func(structName string) string {
+		start := bytes.Index(code, []byte("func (t *"+structName+") Unpack(data []byte) int {"))
+		if start < 0 {
+			t.Fatalf("no Unpack method for %s", structName)
+		}
+		end := bytes.Index(code[start:], []byte("\n}"))
+		return string(code[start : start+end])
+	}
+	// The action and the packer alias the action data.
+	for structName, expected := range map[string][]string{
+		"post":    {"dec.UnpackI((*aliasString)(&t.memo))", "dec.UnpackI((*aliasBytes)(&t.data))"},
+		"Payload": {"dec.UnpackI((*aliasString)(&t.tags[i]))", "dec.UnpackI((*aliasBytes)(&t.blob))"},
+		// The struct of the table and its members copy.
+		"Record":  {"t.memo = dec.UnpackString()"},
+		"Profile": {"t.nickname = dec.UnpackString()"},
+	} {
+		for _, s := range expected {
+			if code := unpack(structName); !strings.Contains(code, s) {
+				t.Errorf("Unpack of %s does not contain %q:\n%s", structName, s, code)
+			}
+		}
+	}
+	if !bytes.Contains(code, []byte("type aliasString string")) {
+		t.Error("the zero-copy types are not generated")
+	}
+}
@@ -84,7 +84,7 @@ func (c *Config) CgoEnabled() bool {
 }
 
 // GC returns the garbage collection strategy in use on this platform. Valid
-// values are "none", "leaking", and "conservative".
+// values are "none", "leaking", "conservative", and "arena" (only on eosio).
 func (c *Config) GC() string {
 	if c.Options.GC != "" {
 		return c.Options.GC
@@ -159,12 +159,33 @@ func (c *Config) OptLevels() (optLevel, sizeLevel int, inlinerThreshold uint) {
 }
 
 // PanicStrategy returns the panic strategy selected for this target. Valid
-// values are "print" (print the panic value, then exit) or "trap" (issue a trap
-// instruction).
+// values are "print" (print the panic value, then exit), "trap" (issue a trap
+// instruction) or "location" (like print, but eosio contracts add the source
+// position of the panic to the abort message).
 func (c *Config) PanicStrategy() string {
 	return c.Options.PanicStrategy
 }
 
+// AllocSites returns whether the source position of each heap allocation is
+// recorded, so that the arena allocator of eosio can count the allocations
+// per call site.
+func (c *Config) AllocSites() bool {
+	return c.Options.AllocSites
+}
+
+// PanicFlag returns whether panics unwind the stack by setting a flag that is
+// checked after each call, instead of jumping to the landing pad of the
+// function with the deferred calls. This is the case for eosio contracts: the
+// chain VM has neither setjmp/longjmp nor the exception handling proposal.
+func (c *Config) PanicFlag() bool {
+	for _, tag := range c.BuildTags() {
+		if tag == "eosio" {
+			return true
+		}
+	}
+	return false
+}
+
 // AutomaticStackSize returns whether goroutine stack sizes should be determined
 // automatically at compile time, if possible. If it is false, no attempt is
 // made.
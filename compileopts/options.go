@@ -8,11 +8,11 @@ import (
 )
 
 var (
-	validGCOptions            = []string{"none", "leaking", "conservative"}
+	validGCOptions            = []string{"none", "leaking", "conservative", "arena"}
 	validSchedulerOptions     = []string{"none", "tasks", "asyncify"}
 	validSerialOptions        = []string{"none", "uart", "usb"}
-	validPrintSizeOptions     = []string{"none", "short", "full"}
-	validPanicStrategyOptions = []string{"print", "trap"}
+	validPrintSizeOptions     = []string{"none", "short", "full", "actions", "actions-json"}
+	validPanicStrategyOptions = []string{"print", "trap", "location"}
 	validOptOptions           = []string{"none", "0", "1", "2", "s", "z"}
 )
 
@@ -27,6 +27,7 @@ type Options struct {
 	Opt             string
 	GC              string
 	PanicStrategy   string
+	AllocSites      bool
 	Scheduler       string
 	StackSize       uint64 // goroutine stack size (if none could be automatically determined)
 	Serial          string
@@ -51,6 +52,10 @@ type Options struct {
 	Directory       string
 	GenCode         bool
 	Strip           bool
+	StrictRicardian bool
+	ZeroCopy        bool
+	NoFloat         bool
+	CheckGenerated  bool
 	PrintJSON       bool
 	Monitor         bool
 	BaudRate        int
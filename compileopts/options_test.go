@@ -9,10 +9,10 @@ import (
 
 func TestVerifyOptions(t *testing.T) {
 
-	expectedGCError := errors.New(`invalid gc option 'incorrect': valid values are none, leaking, conservative`)
+	expectedGCError := errors.New(`invalid gc option 'incorrect': valid values are none, leaking, conservative, arena`)
 	expectedSchedulerError := errors.New(`invalid scheduler option 'incorrect': valid values are none, tasks, asyncify`)
-	expectedPrintSizeError := errors.New(`invalid size option 'incorrect': valid values are none, short, full`)
-	expectedPanicStrategyError := errors.New(`invalid panic option 'incorrect': valid values are print, trap`)
+	expectedPrintSizeError := errors.New(`invalid size option 'incorrect': valid values are none, short, full, actions, actions-json`)
+	expectedPanicStrategyError := errors.New(`invalid panic option 'incorrect': valid values are print, trap, location`)
 
 	testCases := []struct {
 		name          string
@@ -92,6 +92,12 @@ func TestVerifyOptions(t *testing.T) {
 				PrintSizes: "full",
 			},
 		},
+		{
+			name: "PrintSizeOptionActions",
+			opts: compileopts.Options{
+				PrintSizes: "actions",
+			},
+		},
 		{
 			name: "InvalidPanicOption",
 			opts: compileopts.Options{
@@ -111,6 +117,12 @@ func TestVerifyOptions(t *testing.T) {
 				PanicStrategy: "trap",
 			},
 		},
+		{
+			name: "PanicOptionLocation",
+			opts: compileopts.Options{
+				PanicStrategy: "location",
+			},
+		},
 	}
 
 	for _, tc := range testCases {
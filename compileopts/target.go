@@ -63,6 +63,7 @@ type TargetSpec struct {
 	CodeModel        string   `json:"code-model"`
 	RelocationModel  string   `json:"relocation-model"`
 	WasmAbi          string   `json:"wasm-abi"`
+	EosioIntrinsics  string   `json:"eosio-intrinsics"` // intrinsics of the eosio chain version (eosio-2, leap-3, leap-4, leap-5)
 }
 
 // overrideProperties overrides all properties that are set in child into itself using reflection.
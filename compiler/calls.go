@@ -1,7 +1,6 @@
 package compiler
 
 import (
-	"fmt"
 	"go/types"
 	"strconv"
 
@@ -46,21 +45,25 @@ func (b *builder) createRuntimeCallCommon(fnName string, args []llvm.Value, name
 	if isInvoke {
 		return b.createInvoke(llvmFn, args, name)
 	}
-	return b.createCall(llvmFn, args, name)
-}
-
-func (b *builder) createChainCall(fnName string, args []llvm.Value, name string) (llvm.Value, error) {
-	fn, ok := b.program.ImportedPackage("github.com/uuosio/chain").Members[fnName].(*ssa.Function)
-	if !ok {
-		return llvm.Value{}, fmt.Errorf("trying to call non-existent function: %s", fnName)
+	result := b.createCall(llvmFn, args, name)
+	if b.PanicFlag && !panicFlagRuntimeFuncs[fnName] {
+		// Runtime panics (like index out of range) return to this call
+		// instead of jumping to a landing pad. Calls to functions that can't
+		// panic are removed by transform.OptimizeUnwindChecks.
+		b.createUnwindCheck()
 	}
+	return result
+}
 
-	llvmFn := b.getFunction(fn)
-	if llvmFn.IsNil() {
-		panic("trying to call non-existent function: " + fn.RelString(nil))
-	}
-	args = append(args, llvm.Undef(b.i8ptrType)) // unused context parameter
-	return b.createCall(llvmFn, args, name), nil
+// panicFlagRuntimeFuncs are the runtime functions that implement defer frames
+// when Config.PanicFlag is set. They are called without checking the panic
+// flag afterwards.
+var panicFlagRuntimeFuncs = map[string]bool{
+	"isUnwinding":       true,
+	"stopUnwinding":     true,
+	"setupDeferFrame":   true,
+	"destroyDeferFrame": true,
+	"_recover":          true,
 }
 
 // createRuntimeCall creates a new call to runtime.<fnName> with the given
@@ -92,6 +95,11 @@ func (b *builder) createCall(fn llvm.Value, args []llvm.Value, name string) llvm
 // createInvoke is like createCall but continues execution at the landing pad if
 // the call resulted in a panic.
 func (b *builder) createInvoke(fn llvm.Value, args []llvm.Value, name string) llvm.Value {
+	if b.PanicFlag {
+		result := b.createCall(fn, args, name)
+		b.createUnwindCheck()
+		return result
+	}
 	if b.hasDeferFrame() {
 		b.createInvokeCheckpoint()
 	}
@@ -52,6 +52,7 @@ type Config struct {
 	AutomaticStackSize bool
 	DefaultStackSize   uint64
 	NeedsStackObjects  bool
+	PanicFlag          bool // Unwind panics by checking a flag after calls (see compileopts.Config.PanicFlag).
 	Debug              bool // Whether to emit debug information in the LLVM module.
 }
 
@@ -141,6 +142,7 @@ type builder struct {
 	deferPtr          llvm.Value
 	deferFrame        llvm.Value
 	landingpad        llvm.BasicBlock
+	unwindBlock       llvm.BasicBlock // returns a zero value while a panic unwinds (PanicFlag only)
 	difunc            llvm.Metadata
 	dilocals          map[*types.Var]llvm.Metadata
 	initInlinedAt     llvm.Metadata            // fake inlinedAt position
@@ -1660,40 +1662,11 @@ func (b *builder) createFunctionCall(instr *ssa.CallCommon) (llvm.Value, error)
 		// applied) function call. If it is anonymous, it may be a closure.
 		name := fn.RelString(nil)
 		switch {
-		case name == "github.com/uuosio/chain.NewName" || name == "github.com/uuosio/chain.N":
-			if len(instr.Args) != 1 {
-				break
+		case name == "github.com/uuosio/chain.NewName" || name == "github.com/uuosio/chain.N" || name == "github.com/uuosio/chain.S2N":
+			// Names of constant strings are encoded at compile time.
+			if value, ok, err := b.createNameConstant(instr, fn); ok {
+				return value, err
 			}
-
-			expr, ok := instr.Args[0].(*ssa.Const)
-			if !ok {
-				break
-			}
-
-			typ, ok := expr.Type().Underlying().(*types.Basic)
-			if !ok {
-				break
-			}
-
-			if (typ.Info() & types.IsString) == 0 {
-				break
-			}
-
-			var argValues []llvm.Value
-			str := constant.StringVal(expr.Value)
-
-			n := s2n(str)
-			if n2s(n) != str {
-				err := b.makeError(instr.Pos(), "Invalid name: "+str)
-				return llvm.Value{}, err
-			}
-			arg := llvm.ConstInt(b.ctx.Int64Type(), n, false)
-			argValues = append(argValues, arg)
-			ret, err := b.createChainCall("newname", argValues, "")
-			if err != nil {
-				break
-			}
-			return ret, nil
 		case name == "device.Asm" || name == "device/arm.Asm" || name == "device/arm64.Asm" || name == "device/avr.Asm" || name == "device/riscv.Asm":
 			return b.createInlineAsm(instr.Args)
 		case name == "device.AsmFull" || name == "device/arm.AsmFull" || name == "device/arm64.AsmFull" || name == "device/avr.AsmFull" || name == "device/riscv.AsmFull":
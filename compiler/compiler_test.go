@@ -4,11 +4,13 @@ import (
 	"flag"
 	"go/types"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/goenv"
 	"github.com/tinygo-org/tinygo/loader"
 	"tinygo.org/x/go-llvm"
 )
@@ -156,6 +158,100 @@ func TestCompiler(t *testing.T) {
 	}
 }
 
+// compileEosioTestFile compiles a file in testdata for the eosio target, with
+// the panic flag that the target uses.
+func compileEosioTestFile(t *testing.T, file string) (llvm.Module, []error) {
+	t.Helper()
+	options := &compileopts.Options{
+		Target: "eosio",
+	}
+	target, err := compileopts.LoadTarget(options)
+	if err != nil {
+		t.Fatal("failed to load target:", err)
+	}
+	config := &compileopts.Config{
+		Options: options,
+		Target:  target,
+	}
+	compilerConfig := &Config{
+		Triple:             config.Triple(),
+		Features:           config.Features(),
+		GOOS:               config.GOOS(),
+		GOARCH:             config.GOARCH(),
+		CodeModel:          config.CodeModel(),
+		RelocationModel:    config.RelocationModel(),
+		Scheduler:          config.Scheduler(),
+		AutomaticStackSize: config.AutomaticStackSize(),
+		DefaultStackSize:   config.StackSize(),
+		NeedsStackObjects:  config.NeedsStackObjects(),
+		PanicFlag:          config.PanicFlag(),
+	}
+	if !compilerConfig.PanicFlag {
+		t.Fatal("eosio doesn't unwind panics with the panic flag")
+	}
+	machine, err := NewTargetMachine(compilerConfig)
+	if err != nil {
+		t.Fatal("failed to create target machine:", err)
+	}
+	defer machine.Dispose()
+
+	lprogram, err := loader.Load(config, "./testdata/"+file, config.ClangHeaders, types.Config{
+		Sizes: Sizes(machine),
+	})
+	if err != nil {
+		t.Fatal("failed to load program:", err)
+	}
+	if err := lprogram.Parse(); err != nil {
+		t.Fatal("could not parse test case:", err)
+	}
+	program := lprogram.LoadSSA()
+	pkg := lprogram.MainPkg()
+	mod, errs := CompilePackage(file, pkg, program.Package(pkg.Pkg), machine, compilerConfig, false)
+	if errs == nil {
+		if err := llvm.VerifyModule(mod, llvm.PrintMessageAction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mod, errs
+}
+
+// With Config.PanicFlag, a panic returns from the function that panicked, so
+// every call that may panic must be followed by a check of the flag. This
+// includes the deferred calls, so that the remaining deferred calls still run
+// when one of them panics.
+func TestCompilerPanicFlag(t *testing.T) {
+	t.Parallel()
+
+	mod, errs := compileEosioTestFile(t, "defer-panicflag.go")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+
+	// Calls of the runtime are checked in createRuntimeCall, or can't
+	// panic. All other calls, including the indirect calls of function
+	// values and interface methods, must be followed by a check.
+	for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		if !strings.HasPrefix(fn.Name(), "main.defer") {
+			continue
+		}
+		for bb := fn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+			for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+				if inst.IsACallInst().IsNil() {
+					continue
+				}
+				callee := inst.CalledValue()
+				if !callee.IsAFunction().IsNil() && (strings.HasPrefix(callee.Name(), "runtime.") || strings.HasPrefix(callee.Name(), "llvm.")) {
+					continue
+				}
+				next := llvm.NextInstruction(inst)
+				if next.IsNil() || next.IsACallInst().IsNil() || next.CalledValue().Name() != "runtime.isUnwinding" {
+					t.Errorf("call in block %s of %s is not followed by a check of the panic flag", bb.AsValue().Name(), fn.Name())
+				}
+			}
+		}
+	}
+}
+
 // fuzzyEqualIR returns true if the two LLVM IR strings passed in are roughly
 // equal. That means, only relevant lines are compared (excluding comments
 // etc.).
@@ -204,3 +300,111 @@ func filterIrrelevantIRLines(lines []string) []string {
 	}
 	return out
 }
+
+func TestEncodeName(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value uint64
+		valid bool
+	}{
+		{"", 0, true},
+		{"eosio", 6138663577826885632, true},
+		{"eosio.token", 6138663591592764928, true},
+		{"zzzzzzzzzzzzj", 0xffffffffffffffff, true},
+		{"zzzzzzzzzzzzz", 0, false}, // the 13th character is at most j
+		{"toolongname123", 0, false},
+		{"EOSIO", 0, false},
+		{"eosio.", 0, false},
+		{"bob6", 0, false},
+	} {
+		value, err := encodeName(tc.name)
+		if (err == nil) != tc.valid {
+			t.Errorf("encodeName(%q) returned error %v, expected valid=%v", tc.name, err, tc.valid)
+		} else if tc.valid && value != tc.value {
+			t.Errorf("encodeName(%q) = %d, expected %d", tc.name, value, tc.value)
+		}
+	}
+}
+
+// skipWithoutEosioSysroot skips tests of programs that import the chain
+// package, as its cgo preamble needs the headers of the eosio sysroot.
+func skipWithoutEosioSysroot(t *testing.T) {
+	if _, err := os.Stat(filepath.Join(goenv.Get("TINYGOROOT"), "lib", "eosio", "sysroot")); err != nil {
+		t.Skip("eosio sysroot not built:", err)
+	}
+}
+
+// Calls of chain.NewName, chain.N and chain.S2N with a constant string are
+// folded to the encoded name.
+func TestCompilerNameConstant(t *testing.T) {
+	t.Parallel()
+	skipWithoutEosioSysroot(t)
+
+	mod, errs := compileEosioTestFile(t, "name.go")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]uint64{
+		"main.newName": 6138663591592764928, // eosio.token
+		"main.n":       6138663577826885632, // eosio
+		"main.s2n":     3773036822876127232, // alice
+	} {
+		fn := mod.NamedFunction(name)
+		if fn.IsNil() {
+			t.Errorf("function %s not found", name)
+			continue
+		}
+		for bb := fn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+			for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+				if !inst.IsACallInst().IsNil() && strings.HasPrefix(inst.CalledValue().Name(), "github.com/uuosio/chain.") {
+					t.Errorf("%s calls %s", name, inst.CalledValue().Name())
+				}
+				if inst.IsAReturnInst().IsNil() {
+					continue
+				}
+				value := inst.Operand(0)
+				if value.IsConstant() && value.Type().TypeKind() == llvm.StructTypeKind {
+					// chain.Name
+					value = value.Operand(0)
+				}
+				if !value.IsConstant() || value.ZExtValue() != expected {
+					t.Errorf("%s doesn't return the constant %d", name, expected)
+				}
+			}
+		}
+	}
+
+	// A name that isn't constant is encoded at run time.
+	fn := mod.NamedFunction("main.dynamicName")
+	calls := false
+	for bb := fn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+		for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+			calls = calls || !inst.IsACallInst().IsNil() && inst.CalledValue().Name() == "github.com/uuosio/chain.NewName"
+		}
+	}
+	if !calls {
+		t.Error("main.dynamicName doesn't call chain.NewName")
+	}
+}
+
+// An invalid constant name is a build error at the position of the call.
+func TestCompilerInvalidName(t *testing.T) {
+	t.Parallel()
+	skipWithoutEosioSysroot(t)
+
+	_, errs := compileEosioTestFile(t, "name-invalid.go")
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+	err, ok := errs[0].(types.Error)
+	if !ok {
+		t.Fatalf("expected a types.Error, got %T: %v", errs[0], errs[0])
+	}
+	pos := err.Fset.Position(err.Pos)
+	if filepath.Base(pos.Filename) != "name-invalid.go" || pos.Line != 8 || pos.Column != 22 {
+		t.Errorf("error at %s, expected name-invalid.go:8:22", pos)
+	}
+	if !strings.HasPrefix(err.Msg, `invalid name "EOSIO"`) {
+		t.Errorf("unexpected error message %q", err.Msg)
+	}
+}
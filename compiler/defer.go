@@ -25,6 +25,11 @@ import (
 // supportsRecover returns whether the compiler supports the recover() builtin
 // for the current architecture.
 func (b *builder) supportsRecover() bool {
+	if b.PanicFlag {
+		// Panics unwind by returning from every function, see
+		// createUnwindCheck.
+		return true
+	}
 	switch b.archFamily() {
 	case "wasm32":
 		// Probably needs to be implemented using the exception handling
@@ -96,6 +101,12 @@ func (b *builder) createLandingPad() {
 		b.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), b.difunc, llvm.Metadata{})
 	}
 
+	if b.PanicFlag {
+		// The panic reached this function, so the deferred calls must run
+		// normally instead of returning right away.
+		b.createRuntimeCall("stopUnwinding", nil, "")
+	}
+
 	b.createRunDefers()
 
 	// Continue at the 'recover' block, which returns to the parent in an
@@ -210,6 +221,56 @@ li a0, 0
 	b.blockExits[b.currentBlock] = continueBB
 }
 
+// createUnwindCheck checks the panic flag after a call that may have panicked,
+// for targets that can't jump to a landing pad (see Config.PanicFlag). Such a
+// panic unwinds the stack by returning a zero value from every function, until
+// it reaches a function with a defer frame. There, control continues at the
+// landing pad, which runs the deferred calls.
+func (b *builder) createUnwindCheck() {
+	currentBB := b.GetInsertBlock()
+	if currentBB.Parent() != b.llvmFn {
+		// Inside a wrapper created while compiling this function. It returns
+		// to a caller that checks the flag.
+		return
+	}
+	var unwind llvm.BasicBlock
+	if b.hasDeferFrame() && !b.landingpad.IsNil() {
+		unwind = b.landingpad
+	} else {
+		if b.unwindBlock.IsNil() {
+			b.unwindBlock = b.ctx.AddBasicBlock(b.llvmFn, "unwind")
+			b.SetInsertPointAtEnd(b.unwindBlock)
+			returnType := b.llvmFn.Type().ElementType().ReturnType()
+			if returnType.TypeKind() == llvm.VoidTypeKind {
+				b.CreateRetVoid()
+			} else {
+				b.CreateRet(llvm.ConstNull(returnType))
+			}
+			b.SetInsertPointAtEnd(currentBB)
+		}
+		unwind = b.unwindBlock
+	}
+	isUnwinding := b.createRuntimeCall("isUnwinding", nil, "")
+	continueBB := b.insertBasicBlock("unwind.next")
+	b.CreateCondBr(isUnwinding, unwind, continueBB)
+	b.SetInsertPointAtEnd(continueBB)
+	if b.currentBlock != nil && b.blockExits[b.currentBlock] == currentBB {
+		b.blockExits[b.currentBlock] = continueBB
+	}
+}
+
+// createDeferredCall calls a deferred function value or interface method from
+// createRunDefers. With Config.PanicFlag it checks the panic flag afterwards
+// like createInvoke, so that a panic in the deferred call continues at the
+// landing pad and the remaining deferred calls still run.
+func (b *builder) createDeferredCall(fn llvm.Value, args []llvm.Value) {
+	if b.PanicFlag {
+		b.createInvoke(fn, args, "")
+		return
+	}
+	b.createCall(fn, args, "")
+}
+
 // isInLoop checks if there is a path from a basic block to itself.
 func isInLoop(start *ssa.BasicBlock) bool {
 	// Use a breadth-first search to scan backwards through the block graph.
@@ -516,7 +577,7 @@ func (b *builder) createRunDefers() {
 				forwardParams = append(forwardParams, llvm.Undef(b.i8ptrType))
 			}
 
-			b.createCall(fnPtr, forwardParams, "")
+			b.createDeferredCall(fnPtr, forwardParams)
 
 		case *ssa.Function:
 			// Direct call.
@@ -571,7 +632,7 @@ func (b *builder) createRunDefers() {
 			}
 
 			// Call deferred function.
-			b.createCall(b.getFunction(fn), forwardParams, "")
+			b.createDeferredCall(b.getFunction(fn), forwardParams)
 		case *ssa.Builtin:
 			db := b.deferBuiltinFuncs[callback]
 
@@ -0,0 +1,34 @@
+package main
+
+func external()
+
+type closer interface {
+	Close()
+}
+
+// The deferred calls panic, so the panic flag must be checked after each of
+// them for the remaining deferred calls to run.
+
+func deferClosure(n int) {
+	defer func() {
+		external()
+	}()
+	defer func() {
+		if n > 0 {
+			panic("closure")
+		}
+	}()
+	external()
+}
+
+func deferInterface(c closer) {
+	defer external()
+	defer c.Close()
+	external()
+}
+
+func deferFuncValue(fn func()) {
+	defer external()
+	defer fn()
+	external()
+}
@@ -0,0 +1,9 @@
+package main
+
+import "github.com/uuosio/chain"
+
+// Names are checked when they are encoded, so an invalid constant name is a
+// build error.
+func invalidName() chain.Name {
+	return chain.NewName("EOSIO")
+}
@@ -0,0 +1,21 @@
+package main
+
+import "github.com/uuosio/chain"
+
+// The names of constant strings are encoded at compile time.
+
+func newName() chain.Name {
+	return chain.NewName("eosio.token")
+}
+
+func n() chain.Name {
+	return chain.N("eosio")
+}
+
+func s2n() uint64 {
+	return chain.S2N("alice")
+}
+
+func dynamicName(s string) chain.Name {
+	return chain.NewName(s)
+}
@@ -1,5 +1,14 @@
 package compiler
 
+import (
+	"fmt"
+	"go/constant"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
 func char_to_symbol(c byte) byte {
 	if c >= 'a' && c <= 'z' {
 		return (c - 'a') + 6
@@ -66,3 +75,38 @@ func n2s(value uint64) string {
 	}
 	return string(str[:i+1])
 }
+
+// encodeName returns the encoding of the eosio name s. It fails if s isn't
+// the canonical form of a name, which the chain would encode differently or
+// reject.
+func encodeName(s string) (uint64, error) {
+	n := s2n(s)
+	if n2s(n) != s {
+		return 0, fmt.Errorf("invalid name %q: a name has up to 12 characters of a-z, 1-5 and '.' plus a 13th of a-j, 1-5 and '.', and doesn't end with '.'", s)
+	}
+	return n, nil
+}
+
+// createNameConstant returns the result of a call to chain.NewName, chain.N
+// or chain.S2N as a constant if the argument is a constant string. The bool is
+// false if the call can't be folded.
+func (b *builder) createNameConstant(instr *ssa.CallCommon, fn *ssa.Function) (llvm.Value, bool, error) {
+	if len(instr.Args) != 1 {
+		return llvm.Value{}, false, nil
+	}
+	expr, ok := instr.Args[0].(*ssa.Const)
+	if !ok || expr.Value == nil || expr.Value.Kind() != constant.String {
+		return llvm.Value{}, false, nil
+	}
+	n, err := encodeName(constant.StringVal(expr.Value))
+	if err != nil {
+		return llvm.Value{}, true, b.makeError(instr.Pos(), err.Error())
+	}
+	value := llvm.ConstInt(b.ctx.Int64Type(), n, false)
+	result := fn.Signature.Results().At(0).Type()
+	if _, ok := result.Underlying().(*types.Struct); ok {
+		// chain.Name, which only holds the encoded name.
+		value = llvm.ConstNamedStruct(b.getLLVMType(result), []llvm.Value{value})
+	}
+	return value, true, nil
+}
@@ -25,6 +25,75 @@ func (mi *{{.StructName}}Table) GetByIterator(it *database.Iterator) *{{.StructN
 func (mi *{{.StructName}}Table) Update(it *database.Iterator, v *{{.StructName}}, payer chain.Name) {
 	mi.MultiIndexInterface.Update(it, v, payer)
 }
+
+func (mi *{{.StructName}}Table) LowerBound(id uint64) (*database.Iterator, *{{.StructName}}) {
+	it := mi.MultiIndexInterface.Lowerbound(id)
+	if !it.IsOk() {
+		return it, nil
+	}
+	return it, mi.GetByIterator(it)
+}
+
+func (mi *{{.StructName}}Table) UpperBound(id uint64) (*database.Iterator, *{{.StructName}}) {
+	it := mi.MultiIndexInterface.Upperbound(id)
+	if !it.IsOk() {
+		return it, nil
+	}
+	return it, mi.GetByIterator(it)
+}
+
+// Range calls fn for the rows with primary keys in [lo, hi] in ascending
+// order until fn returns false. fn may erase or modify the row.
+func (mi *{{.StructName}}Table) Range(lo, hi uint64, fn func(it *database.Iterator, v *{{.StructName}}) bool) {
+	if lo > hi {
+		return
+	}
+	end := mi.MultiIndexInterface.Upperbound(hi)
+	for it := mi.MultiIndexInterface.Lowerbound(lo); it.IsOk() && it.I != end.I; {
+		next, _ := mi.MultiIndexInterface.Next(it)
+		if !fn(it, mi.GetByIterator(it)) {
+			return
+		}
+		it = next
+	}
+}
+
+// RangeReverse is Range in descending order.
+func (mi *{{.StructName}}Table) RangeReverse(lo, hi uint64, fn func(it *database.Iterator, v *{{.StructName}}) bool) {
+	if lo > hi {
+		return
+	}
+	first := mi.MultiIndexInterface.Lowerbound(lo)
+	end := mi.MultiIndexInterface.Upperbound(hi)
+	if first.I == end.I {
+		return
+	}
+	for it, _ := mi.MultiIndexInterface.Previous(end); it.IsOk(); {
+		prev, _ := mi.MultiIndexInterface.Previous(it)
+		last := it.I == first.I
+		if !fn(it, mi.GetByIterator(it)) || last {
+			return
+		}
+		it = prev
+	}
+}
+
+// EraseByIterator erases the row and its secondary values, and returns the
+// iterator of the next row.
+func (mi *{{.StructName}}Table) EraseByIterator(it *database.Iterator) *database.Iterator {
+	chain.Check(it.IsOk(), "{{.StructName}}Table.EraseByIterator: invalid iterator")
+	next, _ := mi.MultiIndexInterface.Next(it)
+	mi.MultiIndexInterface.Remove(it)
+	return next
+}
+
+// Modify calls fn to change the row and stores it with its secondary values.
+func (mi *{{.StructName}}Table) Modify(it *database.Iterator, payer chain.Name, fn func(v *{{.StructName}})) {
+	chain.Check(it.IsOk(), "{{.StructName}}Table.Modify: invalid iterator")
+	v := mi.GetByIterator(it)
+	fn(v)
+	mi.MultiIndexInterface.Update(it, v, payer)
+}
 `
 
 const cNewMultiIndexTemplate = `
@@ -55,6 +124,84 @@ func New{{.Name}}Table(code chain.Name, scope chain.Name) *{{.Name}}Table {
 func (mi *{{$.Name}}Table) GetIdxTableBy{{$val.Name}}() *database.{{$val.TableType}} {
 	return mi.GetIdxTableByIndex({{$i}}).(*database.{{$val.TableType}})
 }
+
+func (mi *{{$.Name}}Table) LowerBoundBy{{$val.Name}}(secondary {{$val.GetValueType}}) (*database.SecondaryIterator, *{{$.Name}}) {
+	it, _ := mi.GetIdxTableBy{{$val.Name}}().Lowerbound(secondary)
+	if !it.IsOk() {
+		return it, nil
+	}
+	_, v := mi.GetByKey(it.Primary)
+	return it, v
+}
+
+func (mi *{{$.Name}}Table) UpperBoundBy{{$val.Name}}(secondary {{$val.GetValueType}}) (*database.SecondaryIterator, *{{$.Name}}) {
+	it, _ := mi.GetIdxTableBy{{$val.Name}}().Upperbound(secondary)
+	if !it.IsOk() {
+		return it, nil
+	}
+	_, v := mi.GetByKey(it.Primary)
+	return it, v
+}
+
+// RangeBy{{$val.Name}} calls fn for the rows with {{$val.Name}} values in [lo, hi] in
+// ascending order until fn returns false. fn may erase or modify the row,
+// but a row that moves further into the range is visited again.
+func (mi *{{$.Name}}Table) RangeBy{{$val.Name}}(lo, hi {{$val.GetValueType}}, fn func(it *database.SecondaryIterator, v *{{$.Name}}) bool) {
+	if {{$val.GetGreater "lo" "hi"}} {
+		return
+	}
+	idx := mi.GetIdxTableBy{{$val.Name}}()
+	end, _ := idx.Upperbound(hi)
+	for it, _ := idx.Lowerbound(lo); it.IsOk() && it.I != end.I; {
+		next := idx.Next(it)
+		_, v := mi.GetByKey(it.Primary)
+		if !fn(it, v) {
+			return
+		}
+		it = next
+	}
+}
+
+// RangeReverseBy{{$val.Name}} is RangeBy{{$val.Name}} in descending order.
+func (mi *{{$.Name}}Table) RangeReverseBy{{$val.Name}}(lo, hi {{$val.GetValueType}}, fn func(it *database.SecondaryIterator, v *{{$.Name}}) bool) {
+	if {{$val.GetGreater "lo" "hi"}} {
+		return
+	}
+	idx := mi.GetIdxTableBy{{$val.Name}}()
+	first, _ := idx.Lowerbound(lo)
+	end, _ := idx.Upperbound(hi)
+	if first.I == end.I {
+		return
+	}
+	for it := idx.Previous(end); it.IsOk(); {
+		prev := idx.Previous(it)
+		last := it.I == first.I
+		_, v := mi.GetByKey(it.Primary)
+		if !fn(it, v) || last {
+			return
+		}
+		it = prev
+	}
+}
+
+// EraseBy{{$val.Name}} erases the row and its secondary values, and returns the
+// iterator of the next row in the {{$val.Name}} index.
+func (mi *{{$.Name}}Table) EraseBy{{$val.Name}}(it *database.SecondaryIterator) *database.SecondaryIterator {
+	chain.Check(it.IsOk(), "{{$.Name}}Table.EraseBy{{$val.Name}}: invalid iterator")
+	next := mi.GetIdxTableBy{{$val.Name}}().Next(it)
+	mi.MultiIndexInterface.Remove(mi.MultiIndexInterface.Find(it.Primary))
+	return next
+}
+
+// ModifyBy{{$val.Name}} calls fn to change the row and stores it with its
+// secondary values.
+func (mi *{{$.Name}}Table) ModifyBy{{$val.Name}}(it *database.SecondaryIterator, payer chain.Name, fn func(v *{{$.Name}})) {
+	chain.Check(it.IsOk(), "{{$.Name}}Table.ModifyBy{{$val.Name}}: invalid iterator")
+	itPrimary, v := mi.GetByKey(it.Primary)
+	chain.Check(itPrimary.IsOk(), "{{$.Name}}Table.ModifyBy{{$val.Name}}: row not found")
+	fn(v)
+	mi.MultiIndexInterface.Update(itPrimary, v, payer)
+}
 {{- end}}
 `
 
@@ -125,6 +272,33 @@ import (
 )
 `
 
+// cZeroCopyCode defines the types that unpack strings and byte slices without
+// copying them, for -zero-copy. They alias the data they are unpacked from, so
+// that data must not be changed or reused while the result is in use.
+const cZeroCopyCode = `
+// aliasString is a string that is unpacked without copying it.
+type aliasString string
+
+func (s *aliasString) Unpack(data []byte) int {
+	var b aliasBytes
+	n := b.Unpack(data)
+	*s = *(*aliasString)(unsafe.Pointer(&b))
+	return n
+}
+
+// aliasBytes is a byte slice that is unpacked without copying it.
+type aliasBytes []byte
+
+func (b *aliasBytes) Unpack(data []byte) int {
+	length, n := chain.UnpackVarUint32(data)
+	// int is 32 bits on wasm32, so the length is compared unsigned.
+	chain.Check(uint64(length) <= uint64(len(data)-n), "buffer overflow in Decoder")
+	end := n + int(length)
+	*b = data[n:end:end]
+	return end
+}
+`
+
 const cExtensionTemplate = `
 func (t *%[1]s) Pack() []byte {
 	if !t.HasValue {
@@ -475,7 +649,7 @@ func (t *{{.StructName}}) Unpack(data []byte) int {
 func (t *{{.StructName}}) Size() int {
     size := 1
 	{{- range $i, $member := .Members}}
-	if _, ok := t.value.({{$member.Type}}); ok {
+	if _, ok := t.value.(*{{$member.Type}}); ok {
 		{{$member.GetVariantSize}}
 		return size
 	}
@@ -483,3 +657,84 @@ func (t *{{.StructName}}) Size() int {
     return size
 }
 `
+
+const cBindingTableTemplate = `
+// {{.Name}}Table reads the {{.TableName}} table of a contract.
+type {{.Name}}Table struct {
+	db *database.DBI64
+}
+
+func New{{.Name}}Table(code chain.Name, scope chain.Name) *{{.Name}}Table {
+	table := chain.Name{N: uint64({{.RawName}})} //table name: {{.TableName}}
+	return &{{.Name}}Table{database.NewDBI64(code, scope, table, nil)}
+}
+
+func (t *{{.Name}}Table) Find(id uint64) *database.Iterator {
+	return t.db.Find(id)
+}
+
+// Get returns the row with primary key id, or nil if there is none.
+func (t *{{.Name}}Table) Get(id uint64) *{{.Type}} {
+	it, data := t.db.GetByKey(id)
+	if !it.IsOk() {
+		return nil
+	}
+	v := &{{.Type}}{}
+	v.Unpack(data)
+	return v
+}
+
+func (t *{{.Name}}Table) GetByIterator(it *database.Iterator) *{{.Type}} {
+	v := &{{.Type}}{}
+	v.Unpack(t.db.GetByIterator(it))
+	return v
+}
+
+func (t *{{.Name}}Table) Next(it *database.Iterator) *database.Iterator {
+	next, _ := t.db.Next(it)
+	return next
+}
+
+func (t *{{.Name}}Table) Lowerbound(id uint64) *database.Iterator {
+	return t.db.Lowerbound(id)
+}
+
+func (t *{{.Name}}Table) Upperbound(id uint64) *database.Iterator {
+	return t.db.Upperbound(id)
+}
+
+func (t *{{.Name}}Table) End() *database.Iterator {
+	return t.db.End()
+}
+`
+
+const cActionSenderTemplate = `
+// New{{.Name}}Action returns the {{.ActionName}} action of the current receiver.
+// Set the Account of the returned action to call another instance of the contract.
+func New{{.Name}}Action({{.Permissions}} []*chain.PermissionLevel{{.Params}}) *chain.Action {
+	{{.Data}} := &{{.ActionName}}{ {{- .Values -}} }
+	{{- range .Pointers}}
+	if {{.}} != nil {
+		{{$.Data}}.{{.}} = *{{.}}
+	}
+	{{- end}}
+	return &chain.Action{
+		Account:       chain.CurrentReceiver(),
+		Name:          chain.Name{N: uint64({{.RawName}})}, //{{.ActionName}}
+		Authorization: {{.Permissions}},
+		Data:          {{.Data}}.Pack(),
+	}
+}
+
+// Send{{.Name}}Inline sends the {{.ActionName}} action of the current receiver as an inline action.
+func Send{{.Name}}Inline({{.Permissions}} []*chain.PermissionLevel{{.Params}}) {
+	New{{.Name}}Action({{.Permissions}}{{.Args}}).Send()
+}
+
+// Send{{.Name}}Deferred sends the {{.ActionName}} action of the current receiver in a deferred transaction.
+func Send{{.Name}}Deferred({{.SenderID}} chain.Uint128, {{.Payer}} chain.Name, {{.DelaySec}} int, {{.Permissions}} []*chain.PermissionLevel{{.Params}}) {
+	{{.Tx}} := chain.NewTransaction({{.DelaySec}})
+	{{.Tx}}.Actions = []*chain.Action{New{{.Name}}Action({{.Permissions}}{{.Args}})}
+	{{.Tx}}.Send({{.SenderID}}, false, {{.Payer}})
+}
+`
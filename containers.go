@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+const (
+	CONTAINER_NONE = iota + 1
+	CONTAINER_SLICE
+	CONTAINER_ARRAY
+	CONTAINER_MAP
+)
+
+// containerType describes a struct member of a nested container type like
+// [][]T, [N]T or map[K]V. The code to pack, unpack and size such a member is
+// generated recursively from it.
+//
+// The types map to the ABI as follows:
+//
+//	[]T      T[]
+//	[N]T     T[N], packed as N elements without a length
+//	map[K]V  pair_K_V[], packed in ascending key order
+type containerType struct {
+	kind int
+	// goType is the type name used in generated code.
+	goType string
+	// elem is the element type of slices and arrays and the value type of
+	// maps.
+	elem   *containerType
+	key    *containerType
+	length int64
+	// value describes a type that is not a container (CONTAINER_NONE).
+	value StructMember
+}
+
+// isContainerType reports whether typ needs a containerType to be
+// serialized, as opposed to a value or a slice of values.
+func (t *CodeGenerator) isContainerType(typ types.Type) bool {
+	typ = unalias(typ)
+	if named, ok := typ.(*types.Named); ok && named.Obj().Pkg() == t.pkg {
+		typ = named.Underlying()
+	}
+	switch v := typ.(type) {
+	case *types.Array, *types.Map:
+		return true
+	case *types.Slice:
+		elem := unalias(v.Elem())
+		if named, ok := elem.(*types.Named); ok && named.Obj().Pkg() == t.pkg {
+			elem = named.Underlying()
+		}
+		switch elem.(type) {
+		case *types.Slice, *types.Array, *types.Map:
+			return true
+		}
+	}
+	return false
+}
+
+// parseContainer returns the description of the container type typ. It
+// returns nil if typ can not be serialized.
+func (t *CodeGenerator) parseContainer(typ types.Type, pos token.Pos) *containerType {
+	typ = unalias(typ)
+	c := &containerType{kind: CONTAINER_NONE, goType: t.typeName(typ)}
+	switch v := typ.(type) {
+	case *types.Slice:
+		c.kind = CONTAINER_SLICE
+		c.elem = t.parseContainer(v.Elem(), pos)
+		if c.elem == nil {
+			return nil
+		}
+	case *types.Array:
+		c.kind = CONTAINER_ARRAY
+		c.length = v.Len()
+		c.elem = t.parseContainer(v.Elem(), pos)
+		if c.elem == nil {
+			return nil
+		}
+	case *types.Map:
+		c.kind = CONTAINER_MAP
+		c.key = t.parseContainer(v.Key(), pos)
+		c.elem = t.parseContainer(v.Elem(), pos)
+		if c.key == nil || c.elem == nil || c.key.keyLess("a", "b") == "" {
+			return nil
+		}
+	case *types.Named:
+		c.value = StructMember{Type: c.goType, LeadingType: TYPE_NORMAL, Pos: pos}
+		if v.Obj().Pkg() != t.pkg {
+			break
+		}
+		switch underlying := v.Underlying().(type) {
+		case *types.Basic:
+			// Defined types are packed like their underlying type and
+			// show up under their own name in the ABI types.
+			c.value.Underlying = underlying.Name()
+			c.value.TypeDef = c.goType
+		case *types.Slice, *types.Array, *types.Map:
+			u := t.parseContainer(underlying, pos)
+			if u == nil {
+				return nil
+			}
+			u.goType = c.goType
+			return u
+		}
+	case *types.Basic:
+		c.value = StructMember{Type: c.goType, LeadingType: TYPE_NORMAL, Pos: pos}
+	default:
+		return nil
+	}
+	return c
+}
+
+// isBytes reports whether c is a slice of bytes, which is packed as ABI bytes.
+func (c *containerType) isBytes() bool {
+	return c.kind == CONTAINER_SLICE && c.elem.kind == CONTAINER_NONE && c.elem.value.Type == "byte"
+}
+
+// fixedSize returns the code that adds the packed size of count values of c
+// to size, if all values of c have the same packed size.
+func (c *containerType) fixedSize(count string) (string, bool) {
+	if c.kind != CONTAINER_NONE {
+		return "", false
+	}
+	code, ok := gGetArraySizeMap[c.value.codecType()]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf(code, count), true
+}
+
+// keyLess returns the expression that reports whether map key a sorts
+// before map key b. It returns "" for key types that can not be ordered.
+func (c *containerType) keyLess(a string, b string) string {
+	if c.kind != CONTAINER_NONE {
+		return ""
+	}
+	switch c.value.codecType() {
+	case "chain.Name":
+		return fmt.Sprintf("%s.N < %s.N", a, b)
+	case "byte", "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64", "float32", "float64", "string":
+		return fmt.Sprintf("%s < %s", a, b)
+	}
+	return ""
+}
+
+// indentCode indents every line of code by one tab.
+func indentCode(code string) string {
+	return "\t" + strings.ReplaceAll(code, "\n", "\n\t")
+}
+
+// blockCode returns the block statement that starts with header and contains
+// the statements of body.
+func blockCode(header string, body string) string {
+	if header != "" {
+		header += " "
+	}
+	return header + "{\n" + indentCode(body) + "\n}"
+}
+
+// packCode returns the code that packs the addressable expression expr.
+// depth is used to name the variables of nested loops.
+func (c *containerType) packCode(expr string, depth int) string {
+	i := fmt.Sprintf("i%d", depth)
+	switch c.kind {
+	case CONTAINER_SLICE:
+		if c.isBytes() {
+			return fmt.Sprintf("enc.PackBytes(%s)", expr)
+		}
+		return fmt.Sprintf("enc.PackLength(len(%s))\n", expr) +
+			blockCode(fmt.Sprintf("for %s := range %s", i, expr), c.elem.packCode(expr+"["+i+"]", depth+1))
+	case CONTAINER_ARRAY:
+		return blockCode(fmt.Sprintf("for %s := range %s", i, expr), c.elem.packCode(expr+"["+i+"]", depth+1))
+	case CONTAINER_MAP:
+		// Map iteration order is random, the keys are sorted so that the
+		// packed data is deterministic.
+		keys := fmt.Sprintf("keys%d", depth)
+		j := fmt.Sprintf("j%d", depth)
+		k := fmt.Sprintf("k%d", depth)
+		v := fmt.Sprintf("v%d", depth)
+		code := fmt.Sprintf("enc.PackLength(len(%s))\n", expr)
+		code += fmt.Sprintf("%s := make([]%s, 0, len(%s))\n", keys, c.key.goType, expr)
+		code += blockCode(fmt.Sprintf("for %s := range %s", k, expr), fmt.Sprintf("%[1]s = append(%[1]s, %[2]s)", keys, k)) + "\n"
+		swap := fmt.Sprintf("%[1]s[%[2]s], %[1]s[%[2]s-1] = %[1]s[%[2]s-1], %[1]s[%[2]s]", keys, j)
+		less := c.key.keyLess(keys+"["+j+"]", keys+"["+j+"-1]")
+		code += blockCode(fmt.Sprintf("for %[1]s := 1; %[1]s < len(%[2]s); %[1]s++", i, keys),
+			blockCode(fmt.Sprintf("for %[2]s := %[1]s; %[2]s > 0 && %[3]s; %[2]s--", i, j, less), swap)) + "\n"
+		body := fmt.Sprintf("%s := %s[%s[%s]]\n", v, expr, keys, i)
+		body += c.key.packCode(keys+"["+i+"]", depth+1) + "\n"
+		body += c.elem.packCode(v, depth+1)
+		return code + blockCode(fmt.Sprintf("for %s := range %s", i, keys), body)
+	}
+	expr = c.value.codecVar(expr)
+	if code, ok := PackBasicType(expr, c.value.codecType()); ok {
+		return code
+	}
+	return fmt.Sprintf("enc.Pack(&%s)", expr)
+}
+
+// unpackCode returns the code that unpacks into the addressable expression
+// expr.
+func (c *containerType) unpackCode(expr string, depth int) string {
+	i := fmt.Sprintf("i%d", depth)
+	n := fmt.Sprintf("n%d", depth)
+	switch c.kind {
+	case CONTAINER_SLICE:
+		if c.isBytes() {
+			return fmt.Sprintf("%s = dec.UnpackBytes()", expr)
+		}
+		code := fmt.Sprintf("%s := dec.UnpackLength()\n", n)
+		code += fmt.Sprintf("%s = make(%s, %s)\n", expr, c.goType, n)
+		return code + blockCode(fmt.Sprintf("for %s := range %s", i, expr), c.elem.unpackCode(expr+"["+i+"]", depth+1))
+	case CONTAINER_ARRAY:
+		return blockCode(fmt.Sprintf("for %s := range %s", i, expr), c.elem.unpackCode(expr+"["+i+"]", depth+1))
+	case CONTAINER_MAP:
+		k := fmt.Sprintf("k%d", depth)
+		v := fmt.Sprintf("v%d", depth)
+		code := fmt.Sprintf("%s := dec.UnpackLength()\n", n)
+		code += fmt.Sprintf("%s = make(%s, %s)\n", expr, c.goType, n)
+		body := fmt.Sprintf("var %s %s\n", k, c.key.goType)
+		body += fmt.Sprintf("var %s %s\n", v, c.elem.goType)
+		body += c.key.unpackCode(k, depth+1) + "\n"
+		body += c.elem.unpackCode(v, depth+1) + "\n"
+		body += fmt.Sprintf("%s[%s] = %s", expr, k, v)
+		return code + blockCode(fmt.Sprintf("for %[1]s := 0; %[1]s < %[2]s; %[1]s++", i, n), body)
+	}
+	expr = c.value.codecVar(expr)
+	if code, ok := UnpackBasicType(expr, c.value.codecType()); ok {
+		return code
+	}
+	return fmt.Sprintf("dec.UnpackI(&%s)", expr)
+}
+
+// sizeCode returns the code that adds the packed size of the addressable
+// expression expr to size.
+func (c *containerType) sizeCode(expr string, depth int) string {
+	i := fmt.Sprintf("i%d", depth)
+	switch c.kind {
+	case CONTAINER_SLICE, CONTAINER_ARRAY:
+		code := ""
+		if c.kind == CONTAINER_SLICE {
+			code = fmt.Sprintf("size += chain.PackedVarUint32Length(uint32(len(%s)))\n", expr)
+		}
+		if c.isBytes() {
+			return code + fmt.Sprintf("size += len(%s)", expr)
+		}
+		if fixed, ok := c.elem.fixedSize(expr); ok {
+			return code + fixed
+		}
+		return code + blockCode(fmt.Sprintf("for %s := range %s", i, expr), c.elem.sizeCode(expr+"["+i+"]", depth+1))
+	case CONTAINER_MAP:
+		k := fmt.Sprintf("k%d", depth)
+		v := fmt.Sprintf("v%d", depth)
+		code := fmt.Sprintf("size += chain.PackedVarUint32Length(uint32(len(%s)))\n", expr)
+		if fixed, ok := c.key.fixedSize(expr); ok {
+			code += fixed + "\n"
+		} else {
+			code += blockCode(fmt.Sprintf("for %s := range %s", k, expr), c.key.sizeCode(k, depth+1)) + "\n"
+		}
+		if fixed, ok := c.elem.fixedSize(expr); ok {
+			code += fixed
+		} else {
+			code += blockCode(fmt.Sprintf("for _, %s := range %s", v, expr), c.elem.sizeCode(v, depth+1))
+		}
+		return code
+	}
+	if code, ok := gGetSizeMap[c.value.codecType()]; ok {
+		return code
+	}
+	if c.value.codecType() == "string" {
+		return fmt.Sprintf("size += chain.PackedVarUint32Length(uint32(len(%[1]s))) + len(%[1]s)", expr)
+	}
+	return fmt.Sprintf("size += %s.Size()", expr)
+}
+
+// containerAbiType converts c to an ABI type. The pair structs of maps are
+// added to the ABI structs.
+func (t *CodeGenerator) containerAbiType(c *containerType) (string, error) {
+	switch c.kind {
+	case CONTAINER_SLICE, CONTAINER_ARRAY:
+		if c.isBytes() {
+			return "bytes", nil
+		}
+		elem, err := t.containerAbiType(c.elem)
+		if err != nil {
+			return "", err
+		}
+		if c.kind == CONTAINER_ARRAY {
+			return fmt.Sprintf("%s[%d]", elem, c.length), nil
+		}
+		return elem + "[]", nil
+	case CONTAINER_MAP:
+		key, err := t.containerAbiType(c.key)
+		if err != nil {
+			return "", err
+		}
+		value, err := t.containerAbiType(c.elem)
+		if err != nil {
+			return "", err
+		}
+		name := "pair_" + pairTypeName(key) + "_" + pairTypeName(value)
+		t.pairStructs[name] = ABIStruct{
+			Name: name,
+			Fields: []ABIStructField{
+				{Name: "key", Type: key},
+				{Name: "value", Type: value},
+			},
+		}
+		return name + "[]", nil
+	}
+	return t.convertType(c.value)
+}
+
+// pairTypeName turns an ABI type into a part of the name of a pair struct.
+func pairTypeName(abiType string) string {
+	r := strings.NewReplacer("[]", "_array", "[", "_array", "]", "", "?", "_optional", "$", "_extension")
+	return r.Replace(abiType)
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/wasmfile"
+)
+
+// The size report of -size=actions attributes the code and data of a linked
+// contract to its actions. It is made for the module as deployed, after the
+// post-link pass, with the function names that the pass keeps from the name
+// section it removes. Starting from the functions of each action (the handler,
+// and unpacking its parameters and packing its result), it follows the
+// direct calls and the addresses of data used by the code, which are the
+// i32.const instructions that point into a data segment. Data is split into
+// objects at the referenced addresses, and words in an object that point into
+// a data segment reference other objects. Functions that are only called
+// indirectly, through an interface or a function value, aren't attributed to
+// an action.
+
+// contractEntry is an action or a notification handler of a contract with
+// the functions that run it.
+type contractEntry struct {
+	Name string
+	// Handlers are the names the handler may have, with a pointer or a
+	// value receiver. One of them must be a function name.
+	Handlers []string
+	// Functions are the other functions of the entry, which may have been
+	// inlined into the handler or the dispatcher.
+	Functions []string
+}
+
+// actionSize is the size of the code and data that an action uses.
+type actionSize struct {
+	Action string `json:"action"`
+	// Handler is the function of the action.
+	Handler string `json:"handler"`
+	// Exclusive is the size that is only used by this action, Shared the
+	// size that other actions use as well.
+	Exclusive uint64            `json:"exclusive"`
+	Shared    uint64            `json:"shared"`
+	Packages  map[string]uint64 `json:"packages"`
+}
+
+// packageCodeSize is the size of the functions and data of a Go package.
+type packageCodeSize struct {
+	Code uint64 `json:"code"`
+	Data uint64 `json:"data"`
+}
+
+// contractSize is the size report of a contract.
+type contractSize struct {
+	// Total is the size of all function bodies and data segments.
+	Total uint64 `json:"total"`
+	// Common is the size that isn't used by any action: the dispatcher, the
+	// runtime and what is only used indirectly.
+	Common   uint64                     `json:"common"`
+	Actions  []actionSize               `json:"actions"`
+	Packages map[string]packageCodeSize `json:"packages"`
+}
+
+// contractEntries returns the actions and notification handlers of the
+// contract with the names their functions have in the name section.
+func contractEntries(gen *CodeGenerator) []contractEntry {
+	var entries []contractEntry
+	for _, action := range gen.actions {
+		entry := contractEntry{Name: action.ActionName}
+		if action.IsNotify && action.NotifyCode != "" {
+			entry.Name = "notify " + action.NotifyCode + "::" + action.ActionName
+		} else if action.IsNotify {
+			entry.Name = "notify " + action.ActionName
+		}
+		entry.Handlers = []string{
+			"(*main." + gen.contractStructName + ")." + action.FuncName,
+			"(main." + gen.contractStructName + ")." + action.FuncName,
+		}
+		entry.Functions = []string{"(*main." + action.TypeName() + ").Unpack"}
+		if action.Result != nil {
+			entry.Functions = append(entry.Functions, "(*main."+action.ResultStructName()+").Pack")
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// wasmFuncPackage returns the Go package of a function in the name section,
+// or "C" for functions without a package, like those of libc.
+func wasmFuncPackage(name string) string {
+	if strings.HasPrefix(name, "interface:") {
+		// Type asserts and method calls on interfaces.
+		return "runtime"
+	}
+	name = strings.TrimPrefix(name, "(")
+	name = strings.TrimPrefix(name, "*")
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		// Leave out the type parameters, which contain other packages.
+		name = name[:i]
+	}
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot < 0 {
+		return "C"
+	}
+	return name[:slash+1+dot]
+}
+
+// sizeNode is a function or a data object of the contract.
+type sizeNode struct {
+	size    uint64
+	pkg     string
+	code    bool
+	refs    []int
+	users   int // number of actions that use the node
+	visited int // last action that visited the node, plus one
+}
+
+// contractSizes attributes the code and data of the wasm module in data to
+// the entries. The functions are named by names, or by the name section of
+// the module if names is nil. It fails if the handler of an entry has no name,
+// as its code can't be told apart from the dispatcher then.
+func contractSizes(data []byte, names map[uint32][]string, entries []contractEntry) (*contractSize, error) {
+	m, err := wasmfile.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if names == nil {
+		names = make(map[uint32][]string)
+		for index, name := range m.Names {
+			names[index] = []string{name}
+		}
+	}
+
+	// The data objects start at the beginning of each segment and at each
+	// referenced address.
+	type segment struct{ start, end uint32 }
+	var segments []segment
+	for _, d := range m.Data {
+		if d.Flags == 0 && d.Offset.Op == 0x41 {
+			segments = append(segments, segment{uint32(d.Offset.Value), uint32(d.Offset.Value) + uint32(len(d.Data))})
+		}
+	}
+	inData := func(addr uint32) bool {
+		for _, s := range segments {
+			if addr >= s.start && addr < s.end {
+				return true
+			}
+		}
+		return false
+	}
+	starts := make(map[uint32]bool)
+	for _, s := range segments {
+		starts[s.start] = true
+	}
+	funcRefs := make([][]uint32, len(m.Codes)) // referenced addresses
+	funcCalls := make([][]uint32, len(m.Codes))
+	for i, code := range m.Codes {
+		ir := wasmfile.NewInstructionReader(code.Body)
+		for !ir.Done() {
+			in := ir.Next()
+			switch {
+			case in.Op == 0x10 && int(in.Index) >= m.NumImportedFuncs:
+				funcCalls[i] = append(funcCalls[i], in.Index-uint32(m.NumImportedFuncs))
+			case in.Op == 0x41 && inData(uint32(in.Value)):
+				funcRefs[i] = append(funcRefs[i], uint32(in.Value))
+				starts[uint32(in.Value)] = true
+			}
+		}
+		if ir.Err() != nil {
+			return nil, fmt.Errorf("%s: %w", m.FuncName(uint32(m.NumImportedFuncs+i)), ir.Err())
+		}
+	}
+
+	// The nodes are the functions, followed by the data objects.
+	nodes := make([]sizeNode, len(m.Codes))
+	funcIndex := make(map[string]int)
+	for i, code := range m.Codes {
+		name := m.FuncName(uint32(m.NumImportedFuncs + i))
+		if aliases := names[uint32(m.NumImportedFuncs+i)]; len(aliases) != 0 {
+			name = aliases[0]
+			for _, alias := range aliases {
+				funcIndex[alias] = i
+			}
+		}
+		nodes[i] = sizeNode{size: uint64(code.End - code.Start), pkg: wasmFuncPackage(name), code: true}
+		for _, callee := range funcCalls[i] {
+			nodes[i].refs = append(nodes[i].refs, int(callee))
+		}
+	}
+	objects := make(map[uint32]int) // start address to node
+	for _, d := range m.Data {
+		if d.Flags != 0 || d.Offset.Op != 0x41 {
+			continue
+		}
+		start := uint32(d.Offset.Value)
+		var addrs []uint32
+		for addr := range starts {
+			if addr >= start && addr < start+uint32(len(d.Data)) {
+				addrs = append(addrs, addr)
+			}
+		}
+		sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+		for i, addr := range addrs {
+			end := start + uint32(len(d.Data))
+			if i+1 < len(addrs) {
+				end = addrs[i+1]
+			}
+			objects[addr] = len(nodes)
+			nodes = append(nodes, sizeNode{size: uint64(end - addr)})
+		}
+	}
+	for _, d := range m.Data {
+		if d.Flags != 0 || d.Offset.Op != 0x41 {
+			continue
+		}
+		start := uint32(d.Offset.Value)
+		object := -1
+		for offset := 0; offset < len(d.Data); offset++ {
+			if n, ok := objects[start+uint32(offset)]; ok {
+				object = n
+			}
+			if (start+uint32(offset))%4 == 0 && offset+4 <= len(d.Data) {
+				if ref, ok := objects[binary.LittleEndian.Uint32(d.Data[offset:])]; ok && ref != object {
+					nodes[object].refs = append(nodes[object].refs, ref)
+				}
+			}
+		}
+	}
+	for i, addrs := range funcRefs {
+		for _, addr := range addrs {
+			nodes[i].refs = append(nodes[i].refs, objects[addr])
+		}
+	}
+
+	// Data objects belong to the package of the first function that uses
+	// them.
+	var worklist []int
+	for i := range m.Codes {
+		for _, ref := range nodes[i].refs {
+			if !nodes[ref].code && nodes[ref].pkg == "" {
+				nodes[ref].pkg = nodes[i].pkg
+				worklist = append(worklist, ref)
+			}
+		}
+	}
+	for len(worklist) != 0 {
+		n := worklist[0]
+		worklist = worklist[1:]
+		for _, ref := range nodes[n].refs {
+			if nodes[ref].pkg == "" {
+				nodes[ref].pkg = nodes[n].pkg
+				worklist = append(worklist, ref)
+			}
+		}
+	}
+
+	report := &contractSize{Packages: make(map[string]packageCodeSize)}
+	for i := range nodes {
+		n := &nodes[i]
+		if n.pkg == "" {
+			n.pkg = "(unknown)"
+		}
+		report.Total += n.size
+		size := report.Packages[n.pkg]
+		if n.code {
+			size.Code += n.size
+		} else {
+			size.Data += n.size
+		}
+		report.Packages[n.pkg] = size
+	}
+
+	// Walk the functions of each action.
+	reached := make([][]int, len(entries))
+	for e, entry := range entries {
+		action := actionSize{Action: entry.Name, Packages: make(map[string]uint64)}
+		for _, name := range entry.Handlers {
+			if i, ok := funcIndex[name]; ok {
+				action.Handler = name
+				worklist = append(worklist, i)
+				break
+			}
+		}
+		if action.Handler == "" {
+			return nil, fmt.Errorf("can't attribute the size of %s: its handler %s has no function name, it may have been inlined into the dispatcher", entry.Name, entry.Handlers[0])
+		}
+		for _, name := range entry.Functions {
+			if i, ok := funcIndex[name]; ok {
+				worklist = append(worklist, i)
+			}
+		}
+		for len(worklist) != 0 {
+			n := worklist[len(worklist)-1]
+			worklist = worklist[:len(worklist)-1]
+			if nodes[n].visited == e+1 {
+				continue
+			}
+			nodes[n].visited = e + 1
+			nodes[n].users++
+			reached[e] = append(reached[e], n)
+			worklist = append(worklist, nodes[n].refs...)
+		}
+		report.Actions = append(report.Actions, action)
+	}
+	report.Common = report.Total
+	for i := range nodes {
+		if nodes[i].users != 0 {
+			report.Common -= nodes[i].size
+		}
+	}
+	for e := range report.Actions {
+		action := &report.Actions[e]
+		for _, n := range reached[e] {
+			if nodes[n].users == 1 {
+				action.Exclusive += nodes[n].size
+			} else {
+				action.Shared += nodes[n].size
+			}
+			action.Packages[nodes[n].pkg] += nodes[n].size
+		}
+	}
+	return report, nil
+}
+
+// printContractSizes prints the size report of the contract in the wasm file,
+// as a table or as JSON. names are the function names returned by the
+// post-link pass, or nil if it didn't run.
+func printContractSizes(w io.Writer, file string, names map[uint32][]string, gen *CodeGenerator, asJSON bool) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	report, err := contractSizes(data, names, contractEntries(gen))
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", file, err)
+	}
+	if asJSON {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", b)
+		return nil
+	}
+
+	fmt.Fprintf(w, "exclusive  shared   total | action\n")
+	fmt.Fprintf(w, "------------------------- | ------\n")
+	for _, action := range report.Actions {
+		fmt.Fprintf(w, "%9d %7d %7d | %s (%s)\n", action.Exclusive, action.Shared, action.Exclusive+action.Shared, action.Action, action.Handler)
+	}
+	fmt.Fprintf(w, "------------------------- | ------\n")
+	fmt.Fprintf(w, "%25d | common\n", report.Common)
+	fmt.Fprintf(w, "%25d | total\n", report.Total)
+	fmt.Fprintf(w, "\n")
+
+	var packages []string
+	for name := range report.Packages {
+		packages = append(packages, name)
+	}
+	sort.Strings(packages)
+	fmt.Fprintf(w, "   code    data | package\n")
+	fmt.Fprintf(w, "--------------- | -------\n")
+	for _, name := range packages {
+		size := report.Packages[name]
+		fmt.Fprintf(w, "%7d %7d | %s\n", size.Code, size.Data, name)
+	}
+	return nil
+}
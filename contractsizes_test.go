@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/wasmfile"
+	"github.com/tinygo-org/tinygo/wasmfile/wasmtest"
+)
+
+func TestContractSizes(t *testing.T) {
+	gen := NewCodeGenerator()
+	gen.contractStructName = "Contract"
+	gen.actions = []ActionInfo{
+		{ActionName: "transfer", FuncName: "Transfer"},
+		{ActionName: "issue", FuncName: "Issue"},
+	}
+
+	// Transfer uses the string at 1024, and Issue the object at 1028 which
+	// points to the string. Both allocate.
+	module := wasmtest.Module(
+		wasmtest.Section(wasmfile.SectionType, wasmtest.Vec([]byte{0x60, 0, 0})),
+		wasmtest.Section(wasmfile.SectionFunction, wasmtest.Vec([]byte{0}, []byte{0}, []byte{0}, []byte{0}, []byte{0})),
+		wasmtest.Section(wasmfile.SectionMemory, wasmtest.Vec([]byte{0, 1})),
+		wasmtest.Section(wasmfile.SectionExport, wasmtest.Vec(append(wasmtest.Name("apply"), wasmfile.ExternalFunction, 0))),
+		wasmtest.Section(wasmfile.SectionCode, wasmtest.Vec(
+			wasmtest.Function([]byte{0}, 0x10, 1, 0x10, 3, 0x10, 4, 0x0b),             // main.main
+			wasmtest.Function([]byte{0}, 0x41, 0x80, 0x08, 0x1a, 0x10, 2, 0x0b),       // Transfer
+			wasmtest.Function([]byte{0}, 0x0b),                                        // runtime.alloc
+			wasmtest.Function([]byte{0}, 0x41, 0x84, 0x08, 0x1a, 0x10, 2, 0x01, 0x0b), // Issue
+			wasmtest.Function([]byte{0}, 0x01, 0x01, 0x0b),                            // transfer.Unpack
+		)),
+		wasmtest.Section(wasmfile.SectionData, wasmtest.Vec(append([]byte{0, 0x41, 0x80, 0x08, 0x0b}, wasmtest.Name("abcd\x00\x04\x00\x00xxxx")...))),
+		wasmtest.Section(wasmfile.SectionCustom, wasmtest.Names("main.main", "(*main.Contract).Transfer", "runtime.alloc", "(*main.Contract).Issue", "(*main.transfer).Unpack")),
+	)
+
+	report, err := contractSizes(module, nil, contractEntries(gen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &contractSize{
+		Total:  9 + 9 + 3 + 10 + 5 + 4 + 8,
+		Common: 9,
+		Actions: []actionSize{
+			{
+				Action:    "transfer",
+				Handler:   "(*main.Contract).Transfer",
+				Exclusive: 9 + 5,
+				Shared:    3 + 4,
+				Packages:  map[string]uint64{"main": 9 + 5 + 4, "runtime": 3},
+			},
+			{
+				Action:    "issue",
+				Handler:   "(*main.Contract).Issue",
+				Exclusive: 10 + 8,
+				Shared:    3 + 4,
+				Packages:  map[string]uint64{"main": 10 + 8 + 4, "runtime": 3},
+			},
+		},
+		Packages: map[string]packageCodeSize{
+			"main":    {Code: 9 + 9 + 10 + 5, Data: 4 + 8},
+			"runtime": {Code: 3},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("unexpected report:\n%+v\nexpected:\n%+v", report, expected)
+	}
+
+	// The report of the optimized module, which has no name section, uses
+	// the names kept by the post-link pass.
+	result, _, names, err := optimizeEosioWasm(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = contractSizes(result, names, contractEntries(gen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Actions) != 2 || report.Actions[1].Handler != "(*main.Contract).Issue" || report.Packages["runtime"].Code != 3 {
+		t.Errorf("unexpected report of the optimized module: %+v", report)
+	}
+
+	// A handler that isn't in the name section can't be told apart from
+	// the dispatcher.
+	gen.actions = append(gen.actions, ActionInfo{ActionName: "retire", FuncName: "Retire"})
+	_, err = contractSizes(module, nil, contractEntries(gen))
+	if err == nil || !strings.Contains(err.Error(), "can't attribute the size of retire: its handler (*main.Contract).Retire has no function name") {
+		t.Errorf("expected an error for the missing handler of retire, got %v", err)
+	}
+}
+
+func TestWasmFuncPackage(t *testing.T) {
+	for name, pkg := range map[string]string{
+		"main.main":                                              "main",
+		"(*main.Contract).Transfer":                              "main",
+		"(*github.com/uuosio/chain.Name).String":                 "github.com/uuosio/chain",
+		"github.com/uuosio/chain.NewName":                        "github.com/uuosio/chain",
+		"main.Map[github.com/uuosio/chain.Name]":                 "main",
+		"internal/task.start":                                    "internal/task",
+		"interface:{String:func:{}{basic:string}}.String$invoke": "runtime",
+		"memcpy": "C",
+	} {
+		if got := wasmFuncPackage(name); got != pkg {
+			t.Errorf("package of %s is %q, expected %q", name, got, pkg)
+		}
+	}
+}
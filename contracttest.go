@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/eosiotest"
+	"github.com/tinygo-org/tinygo/goenv"
+)
+
+// testContract runs the tests of a contract package for the eosio target.
+// The contract can't run on its own, so instead of a test binary the
+// contract itself is built, and the Go tests of the package are run on the
+// host with go test. The tests load the contract with the eosiotest package,
+// which finds it through the EOSIO_TEST_CONTRACT environment variable.
+func testContract(pkgName string, stdout, stderr io.Writer, options *compileopts.Options, flags []string, testCompileOnly bool, outpath string) (bool, error) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-contract-test")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	contract := filepath.Join(tmpdir, "contract.wasm")
+	options.TestConfig.CompileTestBinary = false
+	if err := Build(pkgName, contract, options); err != nil {
+		return false, err
+	}
+	if outpath != "" {
+		if err := copyFile(contract, outpath); err != nil {
+			return false, err
+		}
+	}
+	if testCompileOnly {
+		return true, nil
+	}
+
+	args := []string{"test"}
+	if len(options.Tags) != 0 {
+		args = append(args, "-tags="+strings.Join(options.Tags, ","))
+	}
+	args = append(args, pkgName)
+	args = append(args, flags...)
+	cmd := exec.Command(filepath.Join(goenv.Get("GOROOT"), "bin", "go"), args...)
+	cmd.Env = append(os.Environ(), eosiotest.ContractFileEnv+"="+contract)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if options.PrintCommands != nil {
+		options.PrintCommands(cmd.Path, cmd.Args[1:]...)
+	}
+	err = cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		// go test exits with a non-zero exit code if a test failed.
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to run go test: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,328 @@
+// Package eosiotest runs eosio contracts in an in-process wasm interpreter,
+// so contracts can be tested with Go tests without a chain. The intrinsics
+// the contract imports are implemented in Go on top of an in-memory
+// database. Accounts have no keys or permissions: an action is authorized by
+// the authorizations it is pushed with, and an inline action by those of the
+// action that sends it or by the sending contract, as if its permissions
+// include eosio.code.
+//
+// tinygo test -target=eosio builds the contract in the package and runs the
+// Go tests of the package with the path of the contract in the
+// EOSIO_TEST_CONTRACT environment variable:
+//
+//	func TestTransfer(t *testing.T) {
+//		chain := eosiotest.NewChain()
+//		if err := chain.DeployFile("hello", eosiotest.ContractFile()); err != nil {
+//			t.Fatal(err)
+//		}
+//		trace, err := chain.PushAction("hello", "sayhello", data, "alice")
+//		...
+//	}
+package eosiotest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContractFileEnv is the environment variable with the path of the contract
+// built by tinygo test -target=eosio.
+const ContractFileEnv = "EOSIO_TEST_CONTRACT"
+
+// maxInlineActionDepth is the depth of inline actions the chain allows by
+// default.
+const maxInlineActionDepth = 4
+
+// ContractFile returns the path of the contract built by tinygo test, or an
+// empty string if the tests were not started by tinygo test.
+func ContractFile() string {
+	return os.Getenv(ContractFileEnv)
+}
+
+// PermissionLevel is an actor and the permission of it that authorizes an
+// action.
+type PermissionLevel struct {
+	Actor      uint64
+	Permission uint64
+}
+
+// Action is an action as it is sent to a contract.
+type Action struct {
+	Account       uint64
+	Name          uint64
+	Authorization []PermissionLevel
+	Data          []byte
+}
+
+// ActionTrace is the result of the execution of an action by one receiver.
+type ActionTrace struct {
+	Receiver    string
+	Account     string
+	Name        string
+	Data        []byte
+	Console     string
+	ReturnValue []byte
+}
+
+// Trace is the result of a transaction. Actions holds the traces in the
+// order of execution: the pushed action, its notifications and then the
+// inline actions.
+type Trace struct {
+	Actions  []*ActionTrace
+	Deferred []*DeferredTransaction
+}
+
+// Console returns the console output of all actions of the transaction.
+func (t *Trace) Console() string {
+	var s strings.Builder
+	for _, a := range t.Actions {
+		s.WriteString(a.Console)
+	}
+	return s.String()
+}
+
+// DeferredTransaction is a transaction sent with send_deferred. Deferred
+// transactions are recorded, but not executed.
+type DeferredTransaction struct {
+	Sender          string
+	SenderID        [16]byte
+	Payer           string
+	Transaction     []byte
+	ReplaceExisting bool
+}
+
+// AbortError is returned if a transaction is aborted, by an assertion of
+// the contract or by the chain.
+type AbortError struct {
+	Receiver string
+	Action   string
+	Message  string
+	// Code is the error code of eosio_assert_code, or 0.
+	Code uint64
+}
+
+func (e *AbortError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s::%s aborted with code %d", e.Receiver, e.Action, e.Code)
+	}
+	return fmt.Sprintf("%s::%s aborted: %s", e.Receiver, e.Action, e.Message)
+}
+
+// IsAbort reports whether err is an AbortError with a message that contains
+// message.
+func IsAbort(err error, message string) bool {
+	var abort *AbortError
+	return errors.As(err, &abort) && strings.Contains(abort.Message, message)
+}
+
+// Chain is an in-memory chain that executes actions of deployed contracts.
+type Chain struct {
+	accounts  map[uint64]bool
+	contracts map[uint64]*contract
+	db        *database
+	now       time.Time
+}
+
+// NewChain returns an empty chain. The time of the chain starts at the
+// current time, rounded down to milliseconds.
+func NewChain() *Chain {
+	return &Chain{
+		accounts:  make(map[uint64]bool),
+		contracts: make(map[uint64]*contract),
+		db:        newDatabase(),
+		now:       time.Now().Truncate(time.Millisecond),
+	}
+}
+
+// Time returns the current time of the chain.
+func (c *Chain) Time() time.Time {
+	return c.now
+}
+
+// SetTime sets the current time of the chain, which is returned by the
+// current_time intrinsic.
+func (c *Chain) SetTime(t time.Time) {
+	c.now = t
+}
+
+// CreateAccount creates an account without a contract.
+func (c *Chain) CreateAccount(account string) {
+	c.accounts[N(account)] = true
+}
+
+// Deploy creates account if it does not exist and sets its contract to the
+// wasm module code.
+func (c *Chain) Deploy(account string, code []byte) error {
+	contract, err := loadContract(code)
+	if err != nil {
+		return fmt.Errorf("failed to load contract of %s: %w", account, err)
+	}
+	c.accounts[N(account)] = true
+	c.contracts[N(account)] = contract
+	return nil
+}
+
+// DeployFile deploys the contract in the wasm file to account.
+func (c *Chain) DeployFile(account string, file string) error {
+	if file == "" {
+		return fmt.Errorf("no contract file, set %s or run the tests with tinygo test -target=eosio", ContractFileEnv)
+	}
+	code, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return c.Deploy(account, code)
+}
+
+// parseAuth parses an authorization in the form actor or actor@permission.
+// The permission defaults to active.
+func parseAuth(auth string) PermissionLevel {
+	actor, permission := auth, "active"
+	if i := strings.IndexByte(auth, '@'); i >= 0 {
+		actor, permission = auth[:i], auth[i+1:]
+	}
+	return PermissionLevel{N(actor), N(permission)}
+}
+
+// PushAction executes the action name of the contract of account with the
+// packed arguments in data, authorized by auths. Each authorization is an
+// actor or actor@permission. All changes to the database are reverted if
+// the transaction is aborted.
+func (c *Chain) PushAction(account string, name string, data []byte, auths ...string) (*Trace, error) {
+	action := &Action{Account: N(account), Name: N(name), Data: data}
+	for _, auth := range auths {
+		action.Authorization = append(action.Authorization, parseAuth(auth))
+	}
+	return c.PushActions(action)
+}
+
+// PushActions executes the actions in a single transaction.
+func (c *Chain) PushActions(actions ...*Action) (*Trace, error) {
+	trace := &Trace{}
+	snapshot := c.db.clone()
+	for _, action := range actions {
+		if _, ok := c.contracts[action.Account]; !ok {
+			c.db = snapshot
+			return trace, fmt.Errorf("account %s has no contract", NameString(action.Account))
+		}
+		for _, auth := range action.Authorization {
+			if !c.accounts[auth.Actor] {
+				c.db = snapshot
+				return trace, fmt.Errorf("authorizing account %s does not exist", NameString(auth.Actor))
+			}
+		}
+		if err := c.applyAction(trace, action, 0, 0); err != nil {
+			c.db = snapshot
+			return trace, err
+		}
+	}
+	return trace, nil
+}
+
+// applyAction executes action on its account and the accounts notified by
+// it, and then the inline actions they sent.
+func (c *Chain) applyAction(trace *Trace, action *Action, sender uint64, depth int) error {
+	if depth > maxInlineActionDepth {
+		return &AbortError{
+			Receiver: NameString(action.Account),
+			Action:   NameString(action.Name),
+			Message:  "max inline action depth per transaction reached",
+		}
+	}
+	receivers := []uint64{action.Account}
+	var inline []*Action
+	for i := 0; i < len(receivers); i++ {
+		ctx := &applyContext{
+			chain:    c,
+			action:   action,
+			receiver: receivers[i],
+			sender:   sender,
+			trace: &ActionTrace{
+				Receiver: NameString(receivers[i]),
+				Account:  NameString(action.Account),
+				Name:     NameString(action.Name),
+				Data:     action.Data,
+			},
+			deferred: &trace.Deferred,
+		}
+		trace.Actions = append(trace.Actions, ctx.trace)
+		if contract, ok := c.contracts[receivers[i]]; ok {
+			if err := contract.apply(ctx); err != nil {
+				return err
+			}
+		}
+		for _, recipient := range ctx.recipients {
+			found := false
+			for _, r := range receivers {
+				found = found || r == recipient
+			}
+			if !found {
+				receivers = append(receivers, recipient)
+			}
+		}
+		inline = append(inline, ctx.inline...)
+	}
+	for _, a := range inline {
+		if err := c.applyAction(trace, a, action.Account, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Row is a row of a table.
+type Row struct {
+	Primary uint64
+	Payer   string
+	Data    []byte
+}
+
+// Rows returns the rows of a table of the contract code in scope, ordered by
+// their primary keys.
+func (c *Chain) Rows(code string, scope string, table string) []Row {
+	t, ok := c.db.tables[tableID{N(code), N(scope), N(table)}]
+	if !ok {
+		return nil
+	}
+	var rows []Row
+	for _, k := range t.sortedKeys() {
+		r := t.rows[k]
+		rows = append(rows, Row{r.primary, NameString(r.payer), append([]byte(nil), r.data...)})
+	}
+	return rows
+}
+
+// Get returns the data of the row with the primary key in a table of the
+// contract code in scope.
+func (c *Chain) Get(code string, scope string, table string, primary uint64) ([]byte, bool) {
+	t, ok := c.db.tables[tableID{N(code), N(scope), N(table)}]
+	if !ok {
+		return nil, false
+	}
+	r, ok := t.rows[primary]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), r.data...), true
+}
+
+// Scopes returns the scopes of a table of the contract code that have rows.
+func (c *Chain) Scopes(code string, table string) []string {
+	var scopes []uint64
+	for id := range c.db.tables {
+		if id.code == N(code) && id.table == N(table) {
+			scopes = append(scopes, id.scope)
+		}
+	}
+	sort.Slice(scopes, func(i, j int) bool { return scopes[i] < scopes[j] })
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = NameString(scope)
+	}
+	return names
+}
@@ -0,0 +1,261 @@
+package eosiotest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/wasmfile"
+	"github.com/tinygo-org/tinygo/wasmfile/wasmtest"
+)
+
+func TestName(t *testing.T) {
+	for _, name := range []string{"eosio", "eosio.token", "hello", "a", "zzzzzzzzzzzzj", "1.2.3.4.5"} {
+		if s := NameString(N(name)); s != name {
+			t.Errorf("expected %s, got %s", name, s)
+		}
+	}
+	if n := N("eosio"); n != 6138663577826885632 {
+		t.Errorf("unexpected value of eosio: %d", n)
+	}
+}
+
+// The test contract is assembled by hand, so that the test does not need a
+// compiler for the eosio target.
+
+const (
+	i32 = wasmfile.I32
+	i64 = wasmfile.I64
+)
+
+func code(parts ...interface{}) []byte {
+	var b []byte
+	for _, p := range parts {
+		switch p := p.(type) {
+		case int:
+			b = append(b, byte(p))
+		case []byte:
+			b = append(b, p...)
+		}
+	}
+	return b
+}
+
+func i64Const(v uint64) []byte {
+	return append([]byte{0x42}, wasmtest.Sleb(int64(v))...)
+}
+
+func i32Const(v int32) []byte {
+	return append([]byte{0x41}, wasmtest.Sleb(int64(v))...)
+}
+
+// loadData loads the uint64 at the start of the action data.
+var loadData = code(i32Const(0), 0x29, 3, 0)
+
+// testContract returns a contract that implements the actions:
+//   - store(account, value): stores value in the data table with the primary
+//     key account, authorized by account.
+//   - fail(): aborts with "boom".
+//   - notify(account): notifies account and prints the receiver.
+//   - forward(action): sends the packed action as an inline action.
+//   - producers(): calls an intrinsic that is not supported.
+func testContract() []byte {
+	types := wasmtest.Vec(
+		wasmtest.FuncType([]byte{i32, i32}, []byte{i32}),                     // 0: read_action_data
+		wasmtest.FuncType(nil, []byte{i32}),                                  // 1: action_data_size
+		wasmtest.FuncType([]byte{i64}, nil),                                  // 2: require_auth
+		wasmtest.FuncType([]byte{i32, i32}, nil),                             // 3: prints_l
+		wasmtest.FuncType([]byte{i32, i32, i32}, nil),                        // 4: eosio_assert_message
+		wasmtest.FuncType([]byte{i64, i64, i64, i64, i32, i32}, []byte{i32}), // 5: db_store_i64
+		wasmtest.FuncType([]byte{i64, i64, i64, i64}, []byte{i32}),           // 6: db_find_i64
+		wasmtest.FuncType([]byte{i32, i64, i32, i32}, nil),                   // 7: db_update_i64
+		wasmtest.FuncType([]byte{i64, i64, i64}, nil),                        // 8: apply
+	)
+	imports := [][]byte{}
+	for _, imp := range []struct {
+		name string
+		typ  byte
+	}{
+		{"read_action_data", 0},
+		{"action_data_size", 1},
+		{"require_auth", 2},
+		{"prints_l", 3},
+		{"eosio_assert_message", 4},
+		{"db_store_i64", 5},
+		{"db_find_i64", 6},
+		{"db_update_i64", 7},
+		{"printui", 2},
+		{"send_inline", 3},
+		{"require_recipient", 2},
+		{"get_active_producers", 0},
+	} {
+		imports = append(imports, wasmtest.ImportFunc("env", imp.name, uint32(imp.typ)))
+	}
+	const (
+		readActionData = iota
+		actionDataSize
+		requireAuth
+		printsL
+		assertMessage
+		dbStore
+		dbFind
+		dbUpdate
+		printui
+		sendInline
+		requireRecipient
+		getActiveProducers
+		apply
+	)
+
+	ifAction := func(name string, body ...interface{}) []byte {
+		return code(0x20, 2, i64Const(N(name)), 0x51, 0x04, 0x40, code(body...), 0x0b)
+	}
+	body := code(
+		0x10, actionDataSize, 0x21, 3,
+		i32Const(0), 0x20, 3, 0x10, readActionData, 0x1a,
+		ifAction("store",
+			loadData, 0x10, requireAuth,
+			0x20, 0, 0x20, 0, i64Const(N("data")), loadData, 0x10, dbFind, 0x22, 3,
+			i32Const(0), 0x48, 0x04, 0x40,
+			0x20, 0, i64Const(N("data")), loadData, loadData, i32Const(8), i32Const(8), 0x10, dbStore, 0x1a,
+			0x05,
+			0x20, 3, loadData, i32Const(8), i32Const(8), 0x10, dbUpdate,
+			0x0b,
+			i32Const(100), i32Const(6), 0x10, printsL,
+		),
+		ifAction("fail",
+			i32Const(0), i32Const(106), i32Const(4), 0x10, assertMessage,
+		),
+		ifAction("notify",
+			0x20, 0, 0x20, 1, 0x51, 0x04, 0x40,
+			loadData, 0x10, requireRecipient,
+			0x0b,
+			0x20, 0, 0x10, printui,
+		),
+		ifAction("forward",
+			i32Const(0), 0x20, 3, 0x10, sendInline,
+		),
+		ifAction("producers",
+			i32Const(0), i32Const(0), 0x10, getActiveProducers, 0x1a,
+		),
+		0x0b,
+	)
+	locals := wasmtest.Vec(code(1, i32))
+
+	return wasmtest.Module(
+		wasmtest.Section(wasmfile.SectionType, types),
+		wasmtest.Section(wasmfile.SectionImport, wasmtest.Vec(imports...)),
+		wasmtest.Section(wasmfile.SectionFunction, wasmtest.Vec([]byte{8})),
+		wasmtest.Section(wasmfile.SectionMemory, wasmtest.Vec([]byte{0, 1})),
+		wasmtest.Section(wasmfile.SectionExport, wasmtest.Vec(code(wasmtest.Name("apply"), wasmfile.ExternalFunction, apply))),
+		wasmtest.Section(wasmfile.SectionCode, wasmtest.Vec(wasmtest.Function(locals, body...))),
+		wasmtest.Section(wasmfile.SectionData, wasmtest.Vec(code(0, i32Const(100), 0x0b, wasmtest.Name("storedboom")))),
+	)
+}
+
+func pack(values ...uint64) []byte {
+	b := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(b[8*i:], v)
+	}
+	return b
+}
+
+func TestChain(t *testing.T) {
+	chain := NewChain()
+	for _, account := range []string{"hello", "bob"} {
+		if err := chain.Deploy(account, testContract()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chain.CreateAccount("alice")
+
+	trace, err := chain.PushAction("hello", "store", pack(N("alice"), 42), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Console() != "stored" {
+		t.Errorf("unexpected console output: %q", trace.Console())
+	}
+	if _, err := chain.PushAction("hello", "store", pack(N("alice"), 43), "alice"); err != nil {
+		t.Fatal(err)
+	}
+	rows := chain.Rows("hello", "hello", "data")
+	if len(rows) != 1 || rows[0].Primary != N("alice") || rows[0].Payer != "alice" || !bytes.Equal(rows[0].Data, pack(43)) {
+		t.Errorf("unexpected rows: %v", rows)
+	}
+
+	// Aborted transactions do not change the database.
+	_, err = chain.PushAction("hello", "store", pack(N("alice"), 44), "bob")
+	if !IsAbort(err, "missing authority of alice") {
+		t.Errorf("expected missing authority, got %v", err)
+	}
+	_, err = chain.PushActions(
+		&Action{N("hello"), N("store"), []PermissionLevel{parseAuth("alice")}, pack(N("alice"), 45)},
+		&Action{N("hello"), N("fail"), nil, nil},
+	)
+	if !IsAbort(err, "boom") {
+		t.Errorf("expected abort with boom, got %v", err)
+	}
+	if data, ok := chain.Get("hello", "hello", "data", N("alice")); !ok || !bytes.Equal(data, pack(43)) {
+		t.Errorf("database changed by aborted transactions: %v", data)
+	}
+
+	trace, err = chain.PushAction("hello", "notify", pack(N("bob")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Actions) != 2 || trace.Actions[1].Receiver != "bob" || trace.Actions[1].Console != fmt.Sprint(N("bob")) {
+		t.Errorf("unexpected notification traces: %+v", trace.Actions)
+	}
+
+	// forward sends the packed store action as an inline action.
+	inline := pack(N("hello"), N("store"))
+	inline = append(inline, 1)
+	inline = append(inline, pack(N("alice"), N("active"))...)
+	inline = append(inline, 16)
+	inline = append(inline, pack(N("alice"), 46)...)
+	// The inline store needs the authorization of alice, which hello can't
+	// give with eosio.code.
+	_, err = chain.PushAction("hello", "forward", inline, "hello")
+	if !IsAbort(err, "inline action declares authority alice@active") {
+		t.Errorf("expected unsatisfied inline authorization, got %v", err)
+	}
+	trace, err = chain.PushAction("hello", "forward", inline, "hello", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Actions) != 2 || trace.Actions[1].Name != "store" || trace.Actions[1].Console != "stored" {
+		t.Errorf("unexpected inline traces: %+v", trace.Actions)
+	}
+	if data, _ := chain.Get("hello", "hello", "data", N("alice")); !bytes.Equal(data, pack(46)) {
+		t.Errorf("inline action did not update the row: %v", data)
+	}
+
+	_, err = chain.PushAction("hello", "producers", nil)
+	if !IsAbort(err, "intrinsic get_active_producers is not supported") {
+		t.Errorf("expected unsupported intrinsic, got %v", err)
+	}
+}
+
+func TestPrimaryTableKeys(t *testing.T) {
+	table := newPrimaryTable()
+	for _, k := range []uint64{5, 1, 9, 3, 7} {
+		table.insert(&row{primary: k})
+	}
+	table.remove(3)
+	table.remove(9)
+	keys := table.sortedKeys()
+	if fmt.Sprint(keys) != "[1 5 7]" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+	for primary, expected := range map[uint64]int{0: 0, 1: 0, 4: 1, 7: 2, 8: 3} {
+		if i := table.search(primary); i != expected {
+			t.Errorf("search(%d) = %d, expected %d", primary, i, expected)
+		}
+	}
+	if len(table.rows) != len(keys) {
+		t.Errorf("%d rows for %d keys", len(table.rows), len(keys))
+	}
+}
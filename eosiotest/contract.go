@@ -0,0 +1,193 @@
+package eosiotest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-interpreter/wagon/exec"
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// contract is a deployed contract. The host functions of its module call
+// the intrinsics of the action that is executed by the contract.
+type contract struct {
+	module     *wasm.Module
+	applyIndex int64
+	ctx        *applyContext
+}
+
+// exitSignal is raised by eosio_exit to end the action without an error.
+type exitSignal struct{}
+
+func (exitSignal) Error() string {
+	return "eosio_exit"
+}
+
+// loadContract reads the wasm module code and resolves its imports to the
+// intrinsics.
+func loadContract(code []byte) (*contract, error) {
+	decoded, err := wasm.DecodeModule(bytes.NewReader(code))
+	if err != nil {
+		return nil, err
+	}
+	c := &contract{}
+	c.module, err = wasm.ReadModule(bytes.NewReader(code), func(name string) (*wasm.Module, error) {
+		if name != "env" {
+			return nil, fmt.Errorf("unsupported import module %q", name)
+		}
+		return c.envModule(decoded)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.module.Export == nil {
+		return nil, errors.New("the contract does not export apply")
+	}
+	apply, ok := c.module.Export.Entries["apply"]
+	if !ok || apply.Kind != wasm.ExternalFunction {
+		return nil, errors.New("the contract does not export apply")
+	}
+	sig := c.module.GetFunction(int(apply.Index)).Sig
+	if len(sig.ParamTypes) != 3 || len(sig.ReturnTypes) != 0 {
+		return nil, errors.New("apply must have three parameters and no results")
+	}
+	c.applyIndex = int64(apply.Index)
+	return c, nil
+}
+
+// envModule returns the module with the intrinsics imported by m. Imports
+// that are not implemented abort the action when they are called, so that
+// contracts can be tested as long as they do not call them.
+func (c *contract) envModule(m *wasm.Module) (*wasm.Module, error) {
+	env := wasm.NewModule()
+	env.Export.Entries = make(map[string]wasm.ExportEntry)
+	for _, entry := range m.Import.Entries {
+		if entry.ModuleName != "env" {
+			continue
+		}
+		imp, ok := entry.Type.(wasm.FuncImport)
+		if !ok {
+			return nil, fmt.Errorf("unsupported import %s: only functions can be imported", entry.FieldName)
+		}
+		sig := m.Types.Entries[imp.Type]
+		host, err := c.hostFunction(entry.FieldName, sig)
+		if err != nil {
+			return nil, err
+		}
+		env.Types.Entries = append(env.Types.Entries, sig)
+		env.FunctionIndexSpace = append(env.FunctionIndexSpace, wasm.Function{
+			Host: host,
+			Body: &wasm.FunctionBody{},
+		})
+		env.Export.Entries[entry.FieldName] = wasm.ExportEntry{
+			FieldStr: entry.FieldName,
+			Kind:     wasm.ExternalFunction,
+			Index:    uint32(len(env.FunctionIndexSpace) - 1),
+		}
+	}
+	// The signatures point into the types, which is only complete now.
+	for i := range env.FunctionIndexSpace {
+		env.FunctionIndexSpace[i].Sig = &env.Types.Entries[i]
+	}
+	return env, nil
+}
+
+// hostFunction returns the host function for the intrinsic name with the
+// wasm signature sig. It calls the intrinsic with the context of the action
+// that is executed.
+func (c *contract) hostFunction(name string, sig wasm.FunctionSig) (reflect.Value, error) {
+	intrinsic, ok := intrinsics[name]
+	if !ok {
+		return c.unsupportedFunction(name, sig), nil
+	}
+	fn := reflect.ValueOf(intrinsic)
+	typ := fn.Type()
+	if typ.NumIn()-1 != len(sig.ParamTypes) || typ.NumOut() != len(sig.ReturnTypes) {
+		return reflect.Value{}, fmt.Errorf("intrinsic %s is imported with an unexpected signature %s", name, sig)
+	}
+	in := []reflect.Type{reflect.TypeOf(&exec.Process{})}
+	for i, t := range sig.ParamTypes {
+		if !matchesValueType(typ.In(i+1), t) {
+			return reflect.Value{}, fmt.Errorf("intrinsic %s is imported with an unexpected signature %s", name, sig)
+		}
+		in = append(in, typ.In(i+1))
+	}
+	var out []reflect.Type
+	for i, t := range sig.ReturnTypes {
+		if !matchesValueType(typ.Out(i), t) {
+			return reflect.Value{}, fmt.Errorf("intrinsic %s is imported with an unexpected signature %s", name, sig)
+		}
+		out = append(out, typ.Out(i))
+	}
+	return reflect.MakeFunc(reflect.FuncOf(in, out, false), func(args []reflect.Value) []reflect.Value {
+		c.ctx.proc = args[0].Interface().(*exec.Process)
+		args[0] = reflect.ValueOf(c.ctx)
+		return fn.Call(args)
+	}), nil
+}
+
+func (c *contract) unsupportedFunction(name string, sig wasm.FunctionSig) reflect.Value {
+	in := []reflect.Type{reflect.TypeOf(&exec.Process{})}
+	for _, t := range sig.ParamTypes {
+		in = append(in, goValueType(t))
+	}
+	var out []reflect.Type
+	for _, t := range sig.ReturnTypes {
+		out = append(out, goValueType(t))
+	}
+	return reflect.MakeFunc(reflect.FuncOf(in, out, false), func(args []reflect.Value) []reflect.Value {
+		c.ctx.abort("intrinsic %s is not supported by the test chain", name)
+		return nil
+	})
+}
+
+// goValueType returns the Go type host functions use for a wasm value type.
+// The interpreter passes float32 values as their bits.
+func goValueType(t wasm.ValueType) reflect.Type {
+	switch t {
+	case wasm.ValueTypeI32, wasm.ValueTypeF32:
+		return reflect.TypeOf(uint32(0))
+	case wasm.ValueTypeF64:
+		return reflect.TypeOf(float64(0))
+	default:
+		return reflect.TypeOf(uint64(0))
+	}
+}
+
+func matchesValueType(typ reflect.Type, t wasm.ValueType) bool {
+	switch t {
+	case wasm.ValueTypeI32:
+		return typ.Kind() == reflect.Int32 || typ.Kind() == reflect.Uint32
+	case wasm.ValueTypeI64:
+		return typ.Kind() == reflect.Int64 || typ.Kind() == reflect.Uint64
+	case wasm.ValueTypeF32:
+		return typ.Kind() == reflect.Uint32
+	case wasm.ValueTypeF64:
+		return typ.Kind() == reflect.Float64
+	}
+	return false
+}
+
+// apply executes the action of ctx with a new instance of the contract.
+func (c *contract) apply(ctx *applyContext) (err error) {
+	c.ctx = ctx
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				e = fmt.Errorf("%v", r)
+			}
+			err = ctx.result(e)
+		}
+		c.ctx = nil
+	}()
+	vm, err := exec.NewVM(c.module)
+	if err != nil {
+		return ctx.result(err)
+	}
+	vm.RecoverPanic = true
+	_, err = vm.ExecCode(c.applyIndex, ctx.receiver, ctx.action.Account, ctx.action.Name)
+	return ctx.result(err)
+}
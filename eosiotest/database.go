@@ -0,0 +1,591 @@
+package eosiotest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// tableID identifies a table of a contract, or a secondary index of it.
+type tableID struct {
+	code, scope, table uint64
+}
+
+type row struct {
+	primary uint64
+	payer   uint64
+	data    []byte
+}
+
+// primaryTable is a table of rows ordered by their primary key.
+type primaryTable struct {
+	rows map[uint64]*row
+	keys []uint64 // the primary keys in ascending order
+}
+
+func newPrimaryTable() *primaryTable {
+	return &primaryTable{rows: make(map[uint64]*row)}
+}
+
+// sortedKeys returns the primary keys of the table in ascending order. The
+// slice must not be modified.
+func (t *primaryTable) sortedKeys() []uint64 {
+	return t.keys
+}
+
+// search returns the position of the first key that is not less than
+// primary.
+func (t *primaryTable) search(primary uint64) int {
+	return sort.Search(len(t.keys), func(i int) bool { return t.keys[i] >= primary })
+}
+
+func (t *primaryTable) insert(r *row) {
+	i := t.search(r.primary)
+	t.keys = append(t.keys, 0)
+	copy(t.keys[i+1:], t.keys[i:])
+	t.keys[i] = r.primary
+	t.rows[r.primary] = r
+}
+
+func (t *primaryTable) remove(primary uint64) {
+	i := t.search(primary)
+	t.keys = append(t.keys[:i], t.keys[i+1:]...)
+	delete(t.rows, primary)
+}
+
+// The kinds of secondary indexes, in the order of the intrinsics of the chain.
+const (
+	idx64 = iota
+	idx128
+	idx256
+	idxDouble
+	idxLongDouble
+	numIndexKinds
+)
+
+// indexKind describes the keys of one kind of secondary index.
+type indexKind struct {
+	name    string
+	keySize int
+	less    func(a, b []byte) bool
+}
+
+var indexKinds = [numIndexKinds]indexKind{
+	idx64: {"idx64", 8, func(a, b []byte) bool {
+		return binary.LittleEndian.Uint64(a) < binary.LittleEndian.Uint64(b)
+	}},
+	idx128: {"idx128", 16, lessUint128},
+	idx256: {"idx256", 32, func(a, b []byte) bool {
+		// The key is an array of two uint128 values, compared in order.
+		if !bytes.Equal(a[:16], b[:16]) {
+			return lessUint128(a[:16], b[:16])
+		}
+		return lessUint128(a[16:], b[16:])
+	}},
+	idxDouble: {"idx_double", 8, func(a, b []byte) bool {
+		return math.Float64frombits(binary.LittleEndian.Uint64(a)) < math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}},
+	idxLongDouble: {"idx_long_double", 16, func(a, b []byte) bool {
+		return float128ToFloat(a).Cmp(float128ToFloat(b)) < 0
+	}},
+}
+
+func lessUint128(a, b []byte) bool {
+	hiA, hiB := binary.LittleEndian.Uint64(a[8:]), binary.LittleEndian.Uint64(b[8:])
+	if hiA != hiB {
+		return hiA < hiB
+	}
+	return binary.LittleEndian.Uint64(a) < binary.LittleEndian.Uint64(b)
+}
+
+// float128ToFloat converts an IEEE 754 quadruple precision number in little
+// endian byte order to a big.Float.
+func float128ToFloat(b []byte) *big.Float {
+	lo := binary.LittleEndian.Uint64(b)
+	hi := binary.LittleEndian.Uint64(b[8:])
+	sign := hi >> 63
+	exp := int((hi >> 48) & 0x7fff)
+	mantissa := new(big.Int).SetUint64(hi & (1<<48 - 1))
+	mantissa.Lsh(mantissa, 64).Or(mantissa, new(big.Int).SetUint64(lo))
+	if exp == 0x7fff {
+		// Infinities and NaNs compare like infinities.
+		return new(big.Float).SetInf(sign == 1)
+	}
+	if exp == 0 {
+		exp = 1
+	} else {
+		mantissa.SetBit(mantissa, 112, 1)
+	}
+	f := new(big.Float).SetPrec(113).SetInt(mantissa)
+	f.SetMantExp(f, exp-16383-112)
+	if sign == 1 {
+		f.Neg(f)
+	}
+	return f
+}
+
+type secondaryEntry struct {
+	primary uint64
+	payer   uint64
+	key     []byte
+	removed bool
+}
+
+// secondaryTable is a secondary index of a table, ordered by the secondary
+// key and then by the primary key.
+type secondaryTable struct {
+	kind    *indexKind
+	entries []*secondaryEntry
+}
+
+func (t *secondaryTable) less(a *secondaryEntry, key []byte, primary uint64) bool {
+	if t.kind.less(a.key, key) {
+		return true
+	}
+	if t.kind.less(key, a.key) {
+		return false
+	}
+	return a.primary < primary
+}
+
+// search returns the position of the first entry that is not less than the
+// given key and primary key.
+func (t *secondaryTable) search(key []byte, primary uint64) int {
+	return sort.Search(len(t.entries), func(i int) bool {
+		return !t.less(t.entries[i], key, primary)
+	})
+}
+
+// position returns the position of e in the table.
+func (t *secondaryTable) position(e *secondaryEntry) int {
+	return t.search(e.key, e.primary)
+}
+
+func (t *secondaryTable) insert(e *secondaryEntry) {
+	i := t.search(e.key, e.primary)
+	t.entries = append(t.entries, nil)
+	copy(t.entries[i+1:], t.entries[i:])
+	t.entries[i] = e
+}
+
+func (t *secondaryTable) remove(e *secondaryEntry) {
+	for i, v := range t.entries {
+		if v == e {
+			t.entries = append(t.entries[:i], t.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *secondaryTable) findPrimary(primary uint64) *secondaryEntry {
+	for _, e := range t.entries {
+		if e.primary == primary {
+			return e
+		}
+	}
+	return nil
+}
+
+// database holds the tables of all contracts on the chain.
+type database struct {
+	tables  map[tableID]*primaryTable
+	indexes [numIndexKinds]map[tableID]*secondaryTable
+}
+
+func newDatabase() *database {
+	db := &database{tables: make(map[tableID]*primaryTable)}
+	for i := range db.indexes {
+		db.indexes[i] = make(map[tableID]*secondaryTable)
+	}
+	return db
+}
+
+// clone returns a deep copy of db, to restore the state if a transaction
+// fails.
+func (db *database) clone() *database {
+	c := newDatabase()
+	for id, t := range db.tables {
+		rows := make(map[uint64]*row, len(t.rows))
+		for k, r := range t.rows {
+			copied := *r
+			rows[k] = &copied
+		}
+		c.tables[id] = &primaryTable{rows: rows, keys: append([]uint64(nil), t.keys...)}
+	}
+	for kind := range db.indexes {
+		for id, t := range db.indexes[kind] {
+			entries := make([]*secondaryEntry, len(t.entries))
+			for i, e := range t.entries {
+				copied := *e
+				entries[i] = &copied
+			}
+			c.indexes[kind][id] = &secondaryTable{kind: t.kind, entries: entries}
+		}
+	}
+	return c
+}
+
+// primaryIterators maps the iterators of a contract execution to rows, like
+// the chain does. Valid iterators are indexes into rows; the end iterator of
+// a table is -2 minus the index of the table in tables, and -1 is an
+// invalid iterator.
+type primaryIterators struct {
+	tables     []tableID
+	tableIndex map[tableID]int
+	rows       []iteratorRow
+	rowIndex   map[iteratorRow]int32
+}
+
+type iteratorRow struct {
+	table   tableID
+	primary uint64
+}
+
+func (it *primaryIterators) endIterator(id tableID) int32 {
+	if it.tableIndex == nil {
+		it.tableIndex = make(map[tableID]int)
+	}
+	i, ok := it.tableIndex[id]
+	if !ok {
+		i = len(it.tables)
+		it.tables = append(it.tables, id)
+		it.tableIndex[id] = i
+	}
+	return int32(-2 - i)
+}
+
+func (it *primaryIterators) add(id tableID, primary uint64) int32 {
+	it.endIterator(id)
+	if it.rowIndex == nil {
+		it.rowIndex = make(map[iteratorRow]int32)
+	}
+	r := iteratorRow{id, primary}
+	if i, ok := it.rowIndex[r]; ok {
+		return i
+	}
+	it.rows = append(it.rows, r)
+	it.rowIndex[r] = int32(len(it.rows) - 1)
+	return int32(len(it.rows) - 1)
+}
+
+// secondaryIterators maps the iterators of a contract execution to the
+// entries of secondary indexes.
+type secondaryIterators struct {
+	tables     []tableID
+	tableIndex map[tableID]int
+	entries    []iteratorEntry
+}
+
+type iteratorEntry struct {
+	table tableID
+	entry *secondaryEntry
+}
+
+func (it *secondaryIterators) endIterator(id tableID) int32 {
+	if it.tableIndex == nil {
+		it.tableIndex = make(map[tableID]int)
+	}
+	i, ok := it.tableIndex[id]
+	if !ok {
+		i = len(it.tables)
+		it.tables = append(it.tables, id)
+		it.tableIndex[id] = i
+	}
+	return int32(-2 - i)
+}
+
+func (it *secondaryIterators) add(id tableID, e *secondaryEntry) int32 {
+	it.endIterator(id)
+	for i, v := range it.entries {
+		if v.entry == e {
+			return int32(i)
+		}
+	}
+	it.entries = append(it.entries, iteratorEntry{id, e})
+	return int32(len(it.entries) - 1)
+}
+
+func (ctx *applyContext) dbStore(scope, table, payer, primary uint64, data []byte) int32 {
+	if payer == 0 {
+		ctx.abort("must specify a valid account to pay for new record")
+	}
+	id := tableID{ctx.receiver, scope, table}
+	t, ok := ctx.chain.db.tables[id]
+	if !ok {
+		t = newPrimaryTable()
+		ctx.chain.db.tables[id] = t
+	}
+	if _, ok := t.rows[primary]; ok {
+		ctx.abort("could not insert object, most likely a uniqueness constraint was violated")
+	}
+	t.insert(&row{primary, payer, data})
+	return ctx.primary.add(id, primary)
+}
+
+// dbRow returns the row of a valid iterator.
+func (ctx *applyContext) dbRow(iterator int32) (tableID, *row) {
+	if iterator == -1 {
+		ctx.abort("invalid iterator")
+	}
+	if iterator < 0 {
+		ctx.abort("dereference of end iterator")
+	}
+	if int(iterator) >= len(ctx.primary.rows) {
+		ctx.abort("iterator out of range")
+	}
+	it := ctx.primary.rows[iterator]
+	var r *row
+	if t, ok := ctx.chain.db.tables[it.table]; ok {
+		r = t.rows[it.primary]
+	}
+	if r == nil {
+		ctx.abort("dereference of deleted object")
+	}
+	return it.table, r
+}
+
+// checkWrite aborts if the contract writes to a table of another contract.
+func (ctx *applyContext) checkWrite(id tableID) {
+	if id.code != ctx.receiver {
+		ctx.abort("db access violation")
+	}
+}
+
+func (ctx *applyContext) dbUpdate(iterator int32, payer uint64, data []byte) {
+	id, r := ctx.dbRow(iterator)
+	ctx.checkWrite(id)
+	r.data = data
+	if payer != 0 {
+		r.payer = payer
+	}
+}
+
+func (ctx *applyContext) dbRemove(iterator int32) {
+	id, r := ctx.dbRow(iterator)
+	ctx.checkWrite(id)
+	t := ctx.chain.db.tables[id]
+	t.remove(r.primary)
+	if len(t.rows) == 0 {
+		delete(ctx.chain.db.tables, id)
+	}
+}
+
+func (ctx *applyContext) dbNext(iterator int32, primary uint32) int32 {
+	if iterator < -1 {
+		return -1
+	}
+	id, r := ctx.dbRow(iterator)
+	t := ctx.chain.db.tables[id]
+	i := t.search(r.primary) + 1
+	if i == len(t.keys) {
+		return ctx.primary.endIterator(id)
+	}
+	ctx.setUint64(primary, t.keys[i])
+	return ctx.primary.add(id, t.keys[i])
+}
+
+func (ctx *applyContext) dbPrevious(iterator int32, primary uint32) int32 {
+	if iterator < -1 {
+		index := int(-2 - iterator)
+		if index >= len(ctx.primary.tables) {
+			ctx.abort("invalid iterator")
+		}
+		id := ctx.primary.tables[index]
+		t, ok := ctx.chain.db.tables[id]
+		if !ok {
+			return -1
+		}
+		k := t.keys[len(t.keys)-1]
+		ctx.setUint64(primary, k)
+		return ctx.primary.add(id, k)
+	}
+	id, r := ctx.dbRow(iterator)
+	t := ctx.chain.db.tables[id]
+	i := t.search(r.primary) - 1
+	if i < 0 {
+		return -1
+	}
+	ctx.setUint64(primary, t.keys[i])
+	return ctx.primary.add(id, t.keys[i])
+}
+
+// dbFind returns the iterator of the row at the position pick returns in
+// the sorted primary keys of the table, or the end iterator if the position
+// is past the last key.
+func (ctx *applyContext) dbFind(id tableID, pick func(keys []uint64) int) int32 {
+	t, ok := ctx.chain.db.tables[id]
+	if !ok {
+		return -1
+	}
+	keys := t.sortedKeys()
+	i := pick(keys)
+	if i == len(keys) {
+		return ctx.primary.endIterator(id)
+	}
+	return ctx.primary.add(id, keys[i])
+}
+
+func (ctx *applyContext) idxTable(kind int, id tableID) *secondaryTable {
+	return ctx.chain.db.indexes[kind][id]
+}
+
+// idxKey returns an idx256 key, whose size is given in uint128 words.
+func (ctx *applyContext) idxKey(kind int, ptr, size uint32) []byte {
+	if int(size)*16 != indexKinds[kind].keySize {
+		ctx.abort("invalid size of secondary key")
+	}
+	return ctx.memory(ptr, uint32(indexKinds[kind].keySize))
+}
+
+func (ctx *applyContext) idxStore(kind int, scope, table, payer, primary uint64, key []byte) int32 {
+	if payer == 0 {
+		ctx.abort("must specify a valid account to pay for new record")
+	}
+	id := tableID{ctx.receiver, scope, table}
+	t := ctx.idxTable(kind, id)
+	if t == nil {
+		t = &secondaryTable{kind: &indexKinds[kind]}
+		ctx.chain.db.indexes[kind][id] = t
+	}
+	if t.findPrimary(primary) != nil {
+		ctx.abort("could not insert object, most likely a uniqueness constraint was violated")
+	}
+	e := &secondaryEntry{primary: primary, payer: payer, key: key}
+	t.insert(e)
+	return ctx.secondary[kind].add(id, e)
+}
+
+// idxEntry returns the entry of a valid iterator of a secondary index.
+func (ctx *applyContext) idxEntry(kind int, iterator int32) (tableID, *secondaryEntry) {
+	if iterator == -1 {
+		ctx.abort("invalid iterator")
+	}
+	if iterator < 0 {
+		ctx.abort("dereference of end iterator")
+	}
+	if int(iterator) >= len(ctx.secondary[kind].entries) {
+		ctx.abort("iterator out of range")
+	}
+	it := ctx.secondary[kind].entries[iterator]
+	if it.entry.removed {
+		ctx.abort("dereference of deleted object")
+	}
+	return it.table, it.entry
+}
+
+func (ctx *applyContext) idxUpdate(kind int, iterator int32, payer uint64, key []byte) {
+	id, e := ctx.idxEntry(kind, iterator)
+	ctx.checkWrite(id)
+	t := ctx.idxTable(kind, id)
+	t.remove(e)
+	e.key = key
+	if payer != 0 {
+		e.payer = payer
+	}
+	t.insert(e)
+}
+
+func (ctx *applyContext) idxRemove(kind int, iterator int32) {
+	id, e := ctx.idxEntry(kind, iterator)
+	ctx.checkWrite(id)
+	t := ctx.idxTable(kind, id)
+	t.remove(e)
+	e.removed = true
+	if len(t.entries) == 0 {
+		delete(ctx.chain.db.indexes[kind], id)
+	}
+}
+
+func (ctx *applyContext) idxNext(kind int, iterator int32, primary uint32) int32 {
+	if iterator < -1 {
+		return -1
+	}
+	id, e := ctx.idxEntry(kind, iterator)
+	t := ctx.idxTable(kind, id)
+	i := t.position(e) + 1
+	if i == len(t.entries) {
+		return ctx.secondary[kind].endIterator(id)
+	}
+	ctx.setUint64(primary, t.entries[i].primary)
+	return ctx.secondary[kind].add(id, t.entries[i])
+}
+
+func (ctx *applyContext) idxPrevious(kind int, iterator int32, primary uint32) int32 {
+	if iterator < -1 {
+		index := int(-2 - iterator)
+		if index >= len(ctx.secondary[kind].tables) {
+			ctx.abort("invalid iterator")
+		}
+		id := ctx.secondary[kind].tables[index]
+		t := ctx.idxTable(kind, id)
+		if t == nil {
+			return -1
+		}
+		e := t.entries[len(t.entries)-1]
+		ctx.setUint64(primary, e.primary)
+		return ctx.secondary[kind].add(id, e)
+	}
+	id, e := ctx.idxEntry(kind, iterator)
+	t := ctx.idxTable(kind, id)
+	i := t.position(e) - 1
+	if i < 0 {
+		return -1
+	}
+	ctx.setUint64(primary, t.entries[i].primary)
+	return ctx.secondary[kind].add(id, t.entries[i])
+}
+
+func (ctx *applyContext) idxEnd(kind int, id tableID) int32 {
+	if ctx.idxTable(kind, id) == nil {
+		return -1
+	}
+	return ctx.secondary[kind].endIterator(id)
+}
+
+// idxFindPrimary finds the entry of a primary key and writes its secondary
+// key to keyPtr.
+func (ctx *applyContext) idxFindPrimary(kind int, id tableID, keyPtr uint32, primary uint64) int32 {
+	t := ctx.idxTable(kind, id)
+	if t == nil {
+		return -1
+	}
+	e := t.findPrimary(primary)
+	if e == nil {
+		return ctx.secondary[kind].endIterator(id)
+	}
+	ctx.setMemory(keyPtr, e.key)
+	return ctx.secondary[kind].add(id, e)
+}
+
+const (
+	findExact = iota
+	findLowerbound
+	findUpperbound
+)
+
+// idxFind finds the first entry with a secondary key that is equal to, not
+// less than or greater than key and writes its primary key to primaryPtr.
+// The bounds also write the secondary key of the entry to keyPtr.
+func (ctx *applyContext) idxFind(kind int, id tableID, key []byte, keyPtr, primaryPtr uint32, mode int) int32 {
+	t := ctx.idxTable(kind, id)
+	if t == nil {
+		return -1
+	}
+	var i int
+	if mode == findUpperbound {
+		i = sort.Search(len(t.entries), func(i int) bool { return t.kind.less(key, t.entries[i].key) })
+	} else {
+		i = t.search(key, 0)
+	}
+	if i == len(t.entries) || (mode == findExact && t.kind.less(key, t.entries[i].key)) {
+		return ctx.secondary[kind].endIterator(id)
+	}
+	e := t.entries[i]
+	ctx.setUint64(primaryPtr, e.primary)
+	if mode != findExact {
+		ctx.setMemory(keyPtr, e.key)
+	}
+	return ctx.secondary[kind].add(id, e)
+}
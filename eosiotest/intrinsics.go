@@ -0,0 +1,525 @@
+package eosiotest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/go-interpreter/wagon/exec"
+)
+
+// applyContext is the state of the execution of an action by one receiver.
+type applyContext struct {
+	chain      *Chain
+	action     *Action
+	receiver   uint64
+	sender     uint64
+	trace      *ActionTrace
+	deferred   *[]*DeferredTransaction
+	recipients []uint64
+	inline     []*Action
+	proc       *exec.Process
+	primary    primaryIterators
+	secondary  [numIndexKinds]secondaryIterators
+}
+
+// abort aborts the action with a message, like a failed eosio_assert.
+func (ctx *applyContext) abort(format string, args ...interface{}) {
+	panic(&AbortError{Message: fmt.Sprintf(format, args...)})
+}
+
+// result returns the error of the action for the error err returned by the
+// interpreter.
+func (ctx *applyContext) result(err error) error {
+	if err == nil || errors.As(err, new(exitSignal)) {
+		return nil
+	}
+	var abort *AbortError
+	if !errors.As(err, &abort) {
+		abort = &AbortError{Message: err.Error()}
+	}
+	abort.Receiver = NameString(ctx.receiver)
+	abort.Action = NameString(ctx.action.Name)
+	return abort
+}
+
+// memory returns a copy of size bytes of the memory of the contract at ptr.
+func (ctx *applyContext) memory(ptr, size uint32) []byte {
+	if uint64(ptr)+uint64(size) > uint64(ctx.proc.MemSize()) {
+		ctx.abort("access violation")
+	}
+	data := make([]byte, size)
+	ctx.proc.ReadAt(data, int64(ptr))
+	return data
+}
+
+// setMemory writes data to the memory of the contract at ptr.
+func (ctx *applyContext) setMemory(ptr uint32, data []byte) {
+	if uint64(ptr)+uint64(len(data)) > uint64(ctx.proc.MemSize()) {
+		ctx.abort("access violation")
+	}
+	ctx.proc.WriteAt(data, int64(ptr))
+}
+
+func (ctx *applyContext) setUint64(ptr uint32, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	ctx.setMemory(ptr, b[:])
+}
+
+// cString returns the zero terminated string at ptr.
+func (ctx *applyContext) cString(ptr uint32) string {
+	size := uint32(ctx.proc.MemSize())
+	var s []byte
+	for p := ptr; ; p++ {
+		if p >= size {
+			ctx.abort("access violation")
+		}
+		b := ctx.memory(p, 1)[0]
+		if b == 0 {
+			return string(s)
+		}
+		s = append(s, b)
+	}
+}
+
+func (ctx *applyContext) print(s string) {
+	ctx.trace.Console += s
+}
+
+// intrinsics are the host functions of the chain that are implemented. The
+// first parameter of each function is the context of the action, the other
+// parameters and the results are those of the wasm import.
+var intrinsics = map[string]interface{}{
+	// action
+	"read_action_data": func(ctx *applyContext, ptr, size uint32) uint32 {
+		if size == 0 {
+			return uint32(len(ctx.action.Data))
+		}
+		n := len(ctx.action.Data)
+		if int(size) < n {
+			n = int(size)
+		}
+		ctx.setMemory(ptr, ctx.action.Data[:n])
+		return uint32(n)
+	},
+	"action_data_size": func(ctx *applyContext) uint32 {
+		return uint32(len(ctx.action.Data))
+	},
+	"current_receiver": func(ctx *applyContext) uint64 {
+		return ctx.receiver
+	},
+	"get_sender": func(ctx *applyContext) uint64 {
+		return ctx.sender
+	},
+	"publication_time": func(ctx *applyContext) uint64 {
+		return uint64(ctx.chain.now.UnixNano() / 1000)
+	},
+	"require_auth": func(ctx *applyContext, name uint64) {
+		if !ctx.hasAuth(name, 0) {
+			ctx.abort("missing authority of %s", NameString(name))
+		}
+	},
+	"require_auth2": func(ctx *applyContext, name, permission uint64) {
+		if !ctx.hasAuth(name, permission) {
+			ctx.abort("missing authority of %s@%s", NameString(name), NameString(permission))
+		}
+	},
+	"has_auth": func(ctx *applyContext, name uint64) uint32 {
+		return boolToUint32(ctx.hasAuth(name, 0))
+	},
+	"is_account": func(ctx *applyContext, name uint64) uint32 {
+		return boolToUint32(ctx.chain.accounts[name])
+	},
+	"require_recipient": func(ctx *applyContext, name uint64) {
+		if !ctx.chain.accounts[name] {
+			ctx.abort("can not notify %s: the account does not exist", NameString(name))
+		}
+		if name == ctx.receiver {
+			return
+		}
+		for _, r := range ctx.recipients {
+			if r == name {
+				return
+			}
+		}
+		ctx.recipients = append(ctx.recipients, name)
+	},
+	"send_inline": func(ctx *applyContext, ptr, size uint32) {
+		ctx.sendInline(ptr, size)
+	},
+	"send_context_free_inline": func(ctx *applyContext, ptr, size uint32) {
+		ctx.sendInline(ptr, size)
+	},
+	"set_action_return_value": func(ctx *applyContext, ptr, size uint32) {
+		ctx.trace.ReturnValue = ctx.memory(ptr, size)
+	},
+
+	// console
+	"prints": func(ctx *applyContext, ptr uint32) {
+		ctx.print(ctx.cString(ptr))
+	},
+	"prints_l": func(ctx *applyContext, ptr, size uint32) {
+		ctx.print(string(ctx.memory(ptr, size)))
+	},
+	"printi": func(ctx *applyContext, v int64) {
+		ctx.print(strconv.FormatInt(v, 10))
+	},
+	"printui": func(ctx *applyContext, v uint64) {
+		ctx.print(strconv.FormatUint(v, 10))
+	},
+	"printi128": func(ctx *applyContext, ptr uint32) {
+		v := uint128ToInt(ctx.memory(ptr, 16))
+		if v.Bit(127) == 1 {
+			v.Sub(v, new(big.Int).Lsh(big.NewInt(1), 128))
+		}
+		ctx.print(v.String())
+	},
+	"printui128": func(ctx *applyContext, ptr uint32) {
+		ctx.print(uint128ToInt(ctx.memory(ptr, 16)).String())
+	},
+	"printsf": func(ctx *applyContext, bits uint32) {
+		ctx.print(strconv.FormatFloat(float64(math.Float32frombits(bits)), 'e', 6, 32))
+	},
+	"printdf": func(ctx *applyContext, v float64) {
+		ctx.print(strconv.FormatFloat(v, 'e', 15, 64))
+	},
+	"printqf": func(ctx *applyContext, ptr uint32) {
+		ctx.print(float128ToFloat(ctx.memory(ptr, 16)).Text('e', 18))
+	},
+	"printn": func(ctx *applyContext, name uint64) {
+		ctx.print(NameString(name))
+	},
+	"printhex": func(ctx *applyContext, ptr, size uint32) {
+		ctx.print(hex.EncodeToString(ctx.memory(ptr, size)))
+	},
+
+	// system
+	"eosio_assert": func(ctx *applyContext, test, msg uint32) {
+		if test == 0 {
+			ctx.abort("assertion failure with message: %s", ctx.cString(msg))
+		}
+	},
+	"eosio_assert_message": func(ctx *applyContext, test, msg, size uint32) {
+		if test == 0 {
+			ctx.abort("assertion failure with message: %s", ctx.memory(msg, size))
+		}
+	},
+	"eosio_assert_code": func(ctx *applyContext, test uint32, code uint64) {
+		if test == 0 {
+			panic(&AbortError{Message: fmt.Sprintf("assertion failure with error code: %d", code), Code: code})
+		}
+	},
+	"eosio_exit": func(ctx *applyContext, code int32) {
+		panic(exitSignal{})
+	},
+	"abort": func(ctx *applyContext) {
+		ctx.abort("abort() called")
+	},
+	"current_time": func(ctx *applyContext) uint64 {
+		return uint64(ctx.chain.now.UnixNano() / 1000)
+	},
+	"is_feature_activated": func(ctx *applyContext, digest uint32) uint32 {
+		return 1
+	},
+
+	// transaction
+	"send_deferred": func(ctx *applyContext, senderID uint32, payer uint64, ptr, size, replaceExisting uint32) {
+		d := &DeferredTransaction{
+			Sender:          NameString(ctx.receiver),
+			Payer:           NameString(payer),
+			Transaction:     ctx.memory(ptr, size),
+			ReplaceExisting: replaceExisting != 0,
+		}
+		copy(d.SenderID[:], ctx.memory(senderID, 16))
+		*ctx.deferred = append(*ctx.deferred, d)
+	},
+	"cancel_deferred": func(ctx *applyContext, senderID uint32) int32 {
+		id := ctx.memory(senderID, 16)
+		for i, d := range *ctx.deferred {
+			if d.Sender == NameString(ctx.receiver) && bytes.Equal(d.SenderID[:], id) {
+				*ctx.deferred = append((*ctx.deferred)[:i], (*ctx.deferred)[i+1:]...)
+				return 1
+			}
+		}
+		return 0
+	},
+	"tapos_block_num": func(ctx *applyContext) uint32 {
+		return 1
+	},
+	"tapos_block_prefix": func(ctx *applyContext) uint32 {
+		return 0
+	},
+	"expiration": func(ctx *applyContext) uint32 {
+		return uint32(ctx.chain.now.Unix()) + 60*60
+	},
+
+	// memory
+	"memcpy": func(ctx *applyContext, dest, src, size uint32) uint32 {
+		if (dest < src && dest+size > src) || (src <= dest && src+size > dest) {
+			ctx.abort("memcpy can only accept non-aliasing pointers")
+		}
+		ctx.setMemory(dest, ctx.memory(src, size))
+		return dest
+	},
+	"memmove": func(ctx *applyContext, dest, src, size uint32) uint32 {
+		ctx.setMemory(dest, ctx.memory(src, size))
+		return dest
+	},
+	"memcmp": func(ctx *applyContext, a, b, size uint32) int32 {
+		return int32(bytes.Compare(ctx.memory(a, size), ctx.memory(b, size)))
+	},
+	"memset": func(ctx *applyContext, dest, value, size uint32) uint32 {
+		ctx.setMemory(dest, bytes.Repeat([]byte{byte(value)}, int(size)))
+		return dest
+	},
+
+	// crypto
+	"sha1": func(ctx *applyContext, ptr, size, hash uint32) {
+		sum := sha1.Sum(ctx.memory(ptr, size))
+		ctx.setMemory(hash, sum[:])
+	},
+	"sha256": func(ctx *applyContext, ptr, size, hash uint32) {
+		sum := sha256.Sum256(ctx.memory(ptr, size))
+		ctx.setMemory(hash, sum[:])
+	},
+	"sha512": func(ctx *applyContext, ptr, size, hash uint32) {
+		sum := sha512.Sum512(ctx.memory(ptr, size))
+		ctx.setMemory(hash, sum[:])
+	},
+	"assert_sha1": func(ctx *applyContext, ptr, size, hash uint32) {
+		sum := sha1.Sum(ctx.memory(ptr, size))
+		if !bytes.Equal(sum[:], ctx.memory(hash, uint32(len(sum)))) {
+			ctx.abort("hash mismatch")
+		}
+	},
+	"assert_sha256": func(ctx *applyContext, ptr, size, hash uint32) {
+		sum := sha256.Sum256(ctx.memory(ptr, size))
+		if !bytes.Equal(sum[:], ctx.memory(hash, uint32(len(sum)))) {
+			ctx.abort("hash mismatch")
+		}
+	},
+	"assert_sha512": func(ctx *applyContext, ptr, size, hash uint32) {
+		sum := sha512.Sum512(ctx.memory(ptr, size))
+		if !bytes.Equal(sum[:], ctx.memory(hash, uint32(len(sum)))) {
+			ctx.abort("hash mismatch")
+		}
+	},
+
+	// primary index
+	"db_store_i64": func(ctx *applyContext, scope, table, payer, id uint64, ptr, size uint32) int32 {
+		return ctx.dbStore(scope, table, payer, id, ctx.memory(ptr, size))
+	},
+	"db_update_i64": func(ctx *applyContext, iterator int32, payer uint64, ptr, size uint32) {
+		ctx.dbUpdate(iterator, payer, ctx.memory(ptr, size))
+	},
+	"db_remove_i64": func(ctx *applyContext, iterator int32) {
+		ctx.dbRemove(iterator)
+	},
+	"db_get_i64": func(ctx *applyContext, iterator int32, ptr, size uint32) int32 {
+		_, r := ctx.dbRow(iterator)
+		if size == 0 {
+			return int32(len(r.data))
+		}
+		n := len(r.data)
+		if int(size) < n {
+			n = int(size)
+		}
+		ctx.setMemory(ptr, r.data[:n])
+		return int32(n)
+	},
+	"db_next_i64": func(ctx *applyContext, iterator int32, primary uint32) int32 {
+		return ctx.dbNext(iterator, primary)
+	},
+	"db_previous_i64": func(ctx *applyContext, iterator int32, primary uint32) int32 {
+		return ctx.dbPrevious(iterator, primary)
+	},
+	"db_find_i64": func(ctx *applyContext, code, scope, table, id uint64) int32 {
+		return ctx.dbFind(tableID{code, scope, table}, func(keys []uint64) int {
+			i := sort.Search(len(keys), func(i int) bool { return keys[i] >= id })
+			if i < len(keys) && keys[i] != id {
+				return len(keys)
+			}
+			return i
+		})
+	},
+	"db_lowerbound_i64": func(ctx *applyContext, code, scope, table, id uint64) int32 {
+		return ctx.dbFind(tableID{code, scope, table}, func(keys []uint64) int {
+			return sort.Search(len(keys), func(i int) bool { return keys[i] >= id })
+		})
+	},
+	"db_upperbound_i64": func(ctx *applyContext, code, scope, table, id uint64) int32 {
+		return ctx.dbFind(tableID{code, scope, table}, func(keys []uint64) int {
+			return sort.Search(len(keys), func(i int) bool { return keys[i] > id })
+		})
+	},
+	"db_end_i64": func(ctx *applyContext, code, scope, table uint64) int32 {
+		return ctx.dbFind(tableID{code, scope, table}, func(keys []uint64) int {
+			return len(keys)
+		})
+	},
+}
+
+func init() {
+	// The secondary indexes share their implementation. Only the keys of
+	// idx256 have a length, in uint128 words.
+	for kind := 0; kind < numIndexKinds; kind++ {
+		kind := kind
+		prefix := "db_" + indexKinds[kind].name + "_"
+		intrinsics[prefix+"remove"] = func(ctx *applyContext, iterator int32) {
+			ctx.idxRemove(kind, iterator)
+		}
+		intrinsics[prefix+"next"] = func(ctx *applyContext, iterator int32, primary uint32) int32 {
+			return ctx.idxNext(kind, iterator, primary)
+		}
+		intrinsics[prefix+"previous"] = func(ctx *applyContext, iterator int32, primary uint32) int32 {
+			return ctx.idxPrevious(kind, iterator, primary)
+		}
+		intrinsics[prefix+"end"] = func(ctx *applyContext, code, scope, table uint64) int32 {
+			return ctx.idxEnd(kind, tableID{code, scope, table})
+		}
+		if kind == idx256 {
+			intrinsics[prefix+"store"] = func(ctx *applyContext, scope, table, payer, id uint64, key, size uint32) int32 {
+				return ctx.idxStore(kind, scope, table, payer, id, ctx.idxKey(kind, key, size))
+			}
+			intrinsics[prefix+"update"] = func(ctx *applyContext, iterator int32, payer uint64, key, size uint32) {
+				ctx.idxUpdate(kind, iterator, payer, ctx.idxKey(kind, key, size))
+			}
+			intrinsics[prefix+"find_primary"] = func(ctx *applyContext, code, scope, table uint64, key, size uint32, primary uint64) int32 {
+				ctx.idxKey(kind, key, size)
+				return ctx.idxFindPrimary(kind, tableID{code, scope, table}, key, primary)
+			}
+			intrinsics[prefix+"find_secondary"] = func(ctx *applyContext, code, scope, table uint64, key, size, primary uint32) int32 {
+				return ctx.idxFind(kind, tableID{code, scope, table}, ctx.idxKey(kind, key, size), key, primary, findExact)
+			}
+			intrinsics[prefix+"lowerbound"] = func(ctx *applyContext, code, scope, table uint64, key, size, primary uint32) int32 {
+				return ctx.idxFind(kind, tableID{code, scope, table}, ctx.idxKey(kind, key, size), key, primary, findLowerbound)
+			}
+			intrinsics[prefix+"upperbound"] = func(ctx *applyContext, code, scope, table uint64, key, size, primary uint32) int32 {
+				return ctx.idxFind(kind, tableID{code, scope, table}, ctx.idxKey(kind, key, size), key, primary, findUpperbound)
+			}
+			continue
+		}
+		keySize := uint32(indexKinds[kind].keySize)
+		intrinsics[prefix+"store"] = func(ctx *applyContext, scope, table, payer, id uint64, key uint32) int32 {
+			return ctx.idxStore(kind, scope, table, payer, id, ctx.memory(key, keySize))
+		}
+		intrinsics[prefix+"update"] = func(ctx *applyContext, iterator int32, payer uint64, key uint32) {
+			ctx.idxUpdate(kind, iterator, payer, ctx.memory(key, keySize))
+		}
+		intrinsics[prefix+"find_primary"] = func(ctx *applyContext, code, scope, table uint64, key uint32, primary uint64) int32 {
+			return ctx.idxFindPrimary(kind, tableID{code, scope, table}, key, primary)
+		}
+		intrinsics[prefix+"find_secondary"] = func(ctx *applyContext, code, scope, table uint64, key, primary uint32) int32 {
+			return ctx.idxFind(kind, tableID{code, scope, table}, ctx.memory(key, keySize), key, primary, findExact)
+		}
+		intrinsics[prefix+"lowerbound"] = func(ctx *applyContext, code, scope, table uint64, key, primary uint32) int32 {
+			return ctx.idxFind(kind, tableID{code, scope, table}, ctx.memory(key, keySize), key, primary, findLowerbound)
+		}
+		intrinsics[prefix+"upperbound"] = func(ctx *applyContext, code, scope, table uint64, key, primary uint32) int32 {
+			return ctx.idxFind(kind, tableID{code, scope, table}, ctx.memory(key, keySize), key, primary, findUpperbound)
+		}
+	}
+}
+
+func boolToUint32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// uint128ToInt converts a little endian uint128 to a big.Int.
+func uint128ToInt(b []byte) *big.Int {
+	v := new(big.Int).SetUint64(binary.LittleEndian.Uint64(b[8:]))
+	v.Lsh(v, 64)
+	return v.Or(v, new(big.Int).SetUint64(binary.LittleEndian.Uint64(b)))
+}
+
+func (ctx *applyContext) hasAuth(actor, permission uint64) bool {
+	for _, auth := range ctx.action.Authorization {
+		if auth.Actor == actor && (permission == 0 || auth.Permission == permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// satisfiesInlineAuth reports whether an authorization of an inline action
+// sent by the receiver is satisfied, like the chain checks it: by the same
+// authorization of the sending action, or by the eosio.code permission of
+// the receiver. The chain only has the latter if the permission of the
+// receiver includes receiver@eosio.code, which is assumed for every
+// account here, so the receiver can authorize its inline actions itself.
+func (ctx *applyContext) satisfiesInlineAuth(auth PermissionLevel) bool {
+	if auth.Actor == ctx.receiver {
+		return true
+	}
+	for _, a := range ctx.action.Authorization {
+		if a == auth {
+			return true
+		}
+	}
+	return false
+}
+
+// sendInline schedules the packed action at ptr to be executed after the
+// current action.
+func (ctx *applyContext) sendInline(ptr, size uint32) {
+	action, err := unpackAction(ctx.memory(ptr, size))
+	if err != nil {
+		ctx.abort("invalid inline action: %v", err)
+	}
+	if _, ok := ctx.chain.contracts[action.Account]; !ok && !ctx.chain.accounts[action.Account] {
+		ctx.abort("inline action's code account %s does not exist", NameString(action.Account))
+	}
+	for _, auth := range action.Authorization {
+		if !ctx.satisfiesInlineAuth(auth) {
+			ctx.abort("inline action declares authority %s@%s, which is neither an authorization of the sending action nor satisfied by %s@eosio.code",
+				NameString(auth.Actor), NameString(auth.Permission), NameString(ctx.receiver))
+		}
+	}
+	ctx.inline = append(ctx.inline, action)
+}
+
+// unpackAction unpacks an action in the serialization format of the chain.
+func unpackAction(data []byte) (*Action, error) {
+	r := bytes.NewReader(data)
+	action := &Action{}
+	if err := binary.Read(r, binary.LittleEndian, &action.Account); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &action.Name); err != nil {
+		return nil, err
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var auth PermissionLevel
+		if err := binary.Read(r, binary.LittleEndian, &auth); err != nil {
+			return nil, err
+		}
+		action.Authorization = append(action.Authorization, auth)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(r.Len()) {
+		return nil, errors.New("action data is too short")
+	}
+	action.Data = make([]byte, size)
+	r.Read(action.Data)
+	return action, nil
+}
@@ -0,0 +1,41 @@
+package eosiotest
+
+import "strings"
+
+const nameCharset = ".12345abcdefghijklmnopqrstuvwxyz"
+
+// N converts an account, action or table name to its uint64 value. Invalid
+// characters are encoded as '.', like the chain does for names.
+func N(s string) uint64 {
+	var value uint64
+	for i := 0; i < len(s) && i < 13; i++ {
+		c := uint64(0)
+		if pos := strings.IndexByte(nameCharset, s[i]); pos > 0 {
+			c = uint64(pos)
+		}
+		if i < 12 {
+			value |= (c & 0x1f) << (64 - 5*(i+1))
+		} else {
+			value |= c & 0x0f
+		}
+	}
+	return value
+}
+
+// NameString converts the uint64 value of a name to its string form.
+func NameString(value uint64) string {
+	var s [13]byte
+	tmp := value
+	for i := 0; i <= 12; i++ {
+		var c byte
+		if i == 0 {
+			c = nameCharset[tmp&0x0f]
+			tmp >>= 4
+		} else {
+			c = nameCharset[tmp&0x1f]
+			tmp >>= 5
+		}
+		s[12-i] = c
+	}
+	return strings.TrimRight(string(s[:]), ".")
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checkGenerated regenerates the Go code and the ABI of the contract in
+// memory and compares them with the files in the contract directory. It
+// returns an error with a diff of every file that is missing or out of
+// date.
+func (t *CodeGenerator) checkGenerated(generatedFile string) error {
+	abi, err := t.genAbiJSON()
+	if err != nil {
+		return err
+	}
+	code, err := t.genCode()
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	for _, file := range []struct {
+		path     string
+		expected []byte
+	}{
+		{filepath.Join(t.dirName, generatedFile), code},
+		{t.abiFile(), abi},
+	} {
+		actual, err := ioutil.ReadFile(file.path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			stale = append(stale, fmt.Sprintf("%s does not exist", file.path))
+			continue
+		}
+		if !bytes.Equal(actual, file.expected) {
+			stale = append(stale, fmt.Sprintf("%s is out of date:\n%s", file.path, unifiedDiff(file.path, string(actual), string(file.expected))))
+		}
+	}
+	if len(stale) != 0 {
+		return fmt.Errorf("%s\nrun tinygo gencode to update the generated files", strings.Join(stale, "\n"))
+	}
+	return nil
+}
+
+// unifiedDiff returns the differences between the lines of a and b in the
+// unified diff format, with three lines of context.
+func unifiedDiff(name string, a string, b string) string {
+	const context = 3
+	linesA := splitLines(a)
+	linesB := splitLines(b)
+
+	// Get the edit script, with deletions before insertions, and give every
+	// edit the line numbers it belongs to.
+	var edits []diffEdit
+	diffLines(linesA, linesB, &edits)
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			k++
+			continue
+		}
+		end := k
+		for end < len(edits) && edits[end].op != ' ' {
+			end++
+		}
+		sort.SliceStable(edits[k:end], func(x, y int) bool {
+			return edits[k+x].op == '-' && edits[k+y].op == '+'
+		})
+		k = end
+	}
+	i, j := 0, 0
+	for k := range edits {
+		edits[k].a, edits[k].b = i, j
+		if edits[k].op != '+' {
+			i++
+		}
+		if edits[k].op != '-' {
+			j++
+		}
+	}
+
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "--- %s\n+++ %s (generated)\n", name, name)
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+		// Extend the hunk until there are more than 2*context unchanged
+		// lines in a row.
+		first := start - context
+		if first < 0 {
+			first = 0
+		}
+		end := start
+		for unchanged := 0; end < len(edits) && unchanged <= 2*context; end++ {
+			if edits[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		last := end
+		for last > start && edits[last-1].op == ' ' {
+			last--
+		}
+		last += context
+		if last > len(edits) {
+			last = len(edits)
+		}
+
+		countA, countB := 0, 0
+		for _, e := range edits[first:last] {
+			if e.op != '+' {
+				countA++
+			}
+			if e.op != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", edits[first].a+1, countA, edits[first].b+1, countB)
+		for _, e := range edits[first:last] {
+			line := e.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			out.WriteByte(e.op)
+			out.WriteString(line)
+		}
+		start = last
+	}
+	return out.String()
+}
+
+// diffEdit is a line of a unified diff: op is ' ' for a line of both files, '-'
+// for a line of the first and '+' for a line of the second. a and b are the
+// line numbers in the files.
+type diffEdit struct {
+	op   byte
+	line string
+	a, b int
+}
+
+// diffLines appends the edits that turn a into b to edits, keeping the longest
+// common subsequence of lines. It uses the algorithm of Hirschberg, which
+// needs memory linear in the number of lines: it splits a in half, finds where
+// the longest common subsequence crosses that split in b and recurses into
+// both halves.
+func diffLines(a, b []string, edits *[]diffEdit) {
+	// The common prefix and suffix are kept as they are, which is most of
+	// a file that is only slightly out of date.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		*edits = append(*edits, diffEdit{op: ' ', line: a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			*edits = append(*edits, diffEdit{op: '+', line: line})
+		}
+	case len(b) == 0:
+		for _, line := range a {
+			*edits = append(*edits, diffEdit{op: '-', line: line})
+		}
+	case len(a) == 1:
+		// a[0] isn't the first or the last line of b, or it would be
+		// part of the prefix or the suffix.
+		k := 0
+		for k < len(b) && b[k] != a[0] {
+			k++
+		}
+		if k == len(b) {
+			*edits = append(*edits, diffEdit{op: '-', line: a[0]})
+			k = 0
+		}
+		for _, line := range b[:k] {
+			*edits = append(*edits, diffEdit{op: '+', line: line})
+		}
+		if k < len(b) && b[k] == a[0] {
+			*edits = append(*edits, diffEdit{op: ' ', line: a[0]})
+			k++
+		}
+		for _, line := range b[k:] {
+			*edits = append(*edits, diffEdit{op: '+', line: line})
+		}
+	default:
+		mid := len(a) / 2
+		forward := lcsLengths(a[:mid], b, false)
+		backward := lcsLengths(a[mid:], b, true)
+		split, best := 0, -1
+		for k := 0; k <= len(b); k++ {
+			if n := forward[k] + backward[len(b)-k]; n > best {
+				split, best = k, n
+			}
+		}
+		diffLines(a[:mid], b[:split], edits)
+		diffLines(a[mid:], b[split:], edits)
+	}
+
+	for _, line := range common {
+		*edits = append(*edits, diffEdit{op: ' ', line: line})
+	}
+}
+
+// lcsLengths returns the lengths of the longest common subsequences of a and
+// every prefix of b, indexed by the length of the prefix. If reverse is set,
+// the lengths are of the suffixes instead.
+func lcsLengths(a, b []string, reverse bool) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		lineA := a[i]
+		if reverse {
+			lineA = a[len(a)-1-i]
+		}
+		for j := 1; j <= len(b); j++ {
+			lineB := b[j-1]
+			if reverse {
+				lineB = b[len(b)-j]
+			}
+			switch {
+			case lineA == lineB:
+				cur[j] = prev[j-1] + 1
+			case prev[j] >= cur[j-1]:
+				cur[j] = prev[j]
+			default:
+				cur[j] = cur[j-1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// splitLines splits s after every newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
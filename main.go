@@ -171,16 +171,31 @@ func Build(pkgName, outpath string, options *compileopts.Options) error {
 		return err
 	}
 
+	// Without -gen-code, the contract is only loaded for the size report of
+	// -size=actions, and the read-only actions are read from the ABI file.
+	var contract *CodeGenerator
+	var readOnlyActions []readOnlyAction
+	sizePerAction := options.PrintSizes == "actions" || options.PrintSizes == "actions-json"
 	if IsEosioPlatform(config.Target.BuildTags) {
+		allTags := make([]string, 0, len(options.Tags)+len(config.Target.BuildTags))
+		allTags = append(allTags, options.Tags...)
+		allTags = append(allTags, config.Target.BuildTags...)
 		if options.GenCode {
-			allTags := make([]string, 0, len(options.Tags)+len(config.Target.BuildTags))
-			allTags = append(allTags, options.Tags...)
-			allTags = append(allTags, config.Target.BuildTags...)
-			if err := GenerateCode(pkgName, "", allTags); err != nil {
-				return err
-			}
+			contract, err = generateCode(pkgName, "", allTags, options)
+		} else if sizePerAction {
+			contract, err = loadContract(pkgName, "generated.go", allTags, options)
+		}
+		if err != nil {
+			return err
+		}
+		if contract != nil {
+			readOnlyActions = contractReadOnlyActions(contract)
+		} else if readOnlyActions, err = packageReadOnlyActions(pkgName); err != nil {
+			return err
 		}
 		//		HandleActionAndTable(pkgName)
+	} else if sizePerAction {
+		return fmt.Errorf("-size=%s is only supported for eosio contracts", options.PrintSizes)
 	}
 
 	if options.PrintJSON {
@@ -192,7 +207,7 @@ func Build(pkgName, outpath string, options *compileopts.Options) error {
 		return nil
 	}
 
-	return builder.Build(pkgName, outpath, config, func(result builder.BuildResult) error {
+	err = builder.Build(pkgName, outpath, config, func(result builder.BuildResult) error {
 		if outpath == "" {
 			if strings.HasSuffix(pkgName, ".go") {
 				// A Go file was specified directly on the command line.
@@ -230,8 +245,39 @@ func Build(pkgName, outpath string, options *compileopts.Options) error {
 		}
 	})
 
-	if IsEosioPlatform(config.Target.BuildTags) && options.Strip {
-		return wasmCheckSection(outpath, outpath)
+	if err != nil {
+		return err
+	}
+
+	if IsEosioPlatform(config.Target.BuildTags) {
+		// Validate the linked module, and again after the post-link pass
+		// (see wasmoptimizer.go) as splitting the data segments may exceed
+		// the limits of the VM.
+		if err := checkEosioWasmFile(outpath, options.NoFloat); err != nil {
+			return err
+		}
+		if err := checkReadOnlyActions(outpath, readOnlyActions); err != nil {
+			return err
+		}
+		// The size report is made for the optimized module, with the
+		// function names of the name section that the pass removes.
+		var names map[uint32][]string
+		if options.Strip {
+			var report io.Writer
+			if options.PrintSizes == "short" || options.PrintSizes == "full" {
+				report = os.Stdout
+			}
+			names, err = optimizeEosioWasmFile(outpath, report)
+			if err != nil {
+				return err
+			}
+			if err := checkEosioWasmFile(outpath, options.NoFloat); err != nil {
+				return err
+			}
+		}
+		if sizePerAction {
+			return printContractSizes(os.Stdout, outpath, names, contract, options.PrintSizes == "actions-json")
+		}
 	}
 	return nil
 }
@@ -266,6 +312,10 @@ func Test(pkgName string, stdout, stderr io.Writer, options *compileopts.Options
 		flags = append(flags, "-test.benchmem")
 	}
 
+	if IsEosioPlatform(config.Target.BuildTags) {
+		return testContract(pkgName, stdout, stderr, options, flags, testCompileOnly, outpath)
+	}
+
 	passed := false
 	err = buildAndRun(pkgName, config, os.Stdout, flags, nil, 0, func(cmd *exec.Cmd, result builder.BuildResult) error {
 		if testCompileOnly || outpath != "" {
@@ -1170,6 +1220,8 @@ func usage(command string) {
 		fmt.Fprintln(os.Stderr, "  version: show version")
 		fmt.Fprintln(os.Stderr, "  help:    print this help text")
 		fmt.Fprintln(os.Stderr, "  gencode: generate contract code and abi")
+		fmt.Fprintln(os.Stderr, "  abigen:  generate Go bindings for the abi of another contract")
+		fmt.Fprintln(os.Stderr, "  wasmcheck: check that wasm files can be deployed to an eosio chain")
 		fmt.Fprintln(os.Stderr, "  init [contract name]: initialize contract project")
 		if flag.Parsed() {
 			fmt.Fprintln(os.Stderr, "\nflags:")
@@ -1383,8 +1435,9 @@ func main() {
 	command := os.Args[1]
 
 	opt := flag.String("opt", "z", "optimization level: 0, 1, 2, s, z")
-	gc := flag.String("gc", "", "garbage collector to use (none, leaking, conservative)")
-	panicStrategy := flag.String("panic", "print", "panic strategy (print, trap)")
+	gc := flag.String("gc", "", "garbage collector to use (none, leaking, conservative, arena)")
+	panicStrategy := flag.String("panic", "print", "panic strategy (print, trap, location)")
+	allocSites := flag.Bool("alloc-sites", false, "count the allocations of eosio contracts per call site, with -gc=arena")
 	scheduler := flag.String("scheduler", "", "which scheduler to use (none, tasks, asyncify)")
 	serial := flag.String("serial", "", "which serial output to use (none, uart, usb)")
 	work := flag.Bool("work", false, "print the name of the temporary build directory and do not delete this directory on exit")
@@ -1401,7 +1454,7 @@ func main() {
 		stackSize = uint64(size)
 		return err
 	})
-	printSize := flag.String("size", "", "print sizes (none, short, full)")
+	printSize := flag.String("size", "", "print sizes (none, short, full, actions, actions-json)")
 	printStacks := flag.Bool("print-stacks", false, "print stack sizes of goroutines")
 	printAllocsString := flag.String("print-allocs", "", "regular expression of functions for which heap allocations should be printed")
 	printCommands := flag.Bool("x", false, "Print commands")
@@ -1418,7 +1471,10 @@ func main() {
 	monitor := flag.Bool("monitor", false, "enable serial monitor")
 	baudrate := flag.Int("baudrate", 115200, "baudrate of serial monitor")
 	genCode := flag.Bool("gen-code", true, "Generate extra code for Smart Contracts")
-	strip := flag.Bool("strip", true, "Strip Custom Section of Wasm File")
+	strip := flag.Bool("strip", true, "Strip custom sections of eosio contracts and shrink them after linking")
+	noFloat := flag.Bool("no-float", false, "Reject floating-point instructions in eosio contracts, for chains that require softfloat")
+	strictRicardian := flag.Bool("strict-ricardian", false, "Fail code generation if an action has no ricardian contract")
+	zeroCopy := flag.Bool("zero-copy", false, "Unpack strings and byte slices without copying them, in the Unpack methods of all structs that aren't stored in tables; they must not be unpacked from reused buffers")
 	template := flag.String("template", "", "template for generating code")
 
 	var flagJSON, flagDeps, flagTest bool
@@ -1430,9 +1486,19 @@ func main() {
 		flag.BoolVar(&flagTest, "test", false, "supply -test flag to go list")
 	}
 	var outpath string
-	if command == "help" || command == "build" || command == "build-library" || command == "test" || command == "gencode" {
+	if command == "help" || command == "build" || command == "build-library" || command == "test" || command == "gencode" || command == "abigen" {
 		flag.StringVar(&outpath, "o", "", "output filename")
 	}
+	var genCheckFlag *bool
+	if command == "help" || command == "gencode" {
+		genCheckFlag = flag.Bool("check", false, "gencode: fail with a diff if the generated files are out of date instead of writing them")
+	}
+	var abigenAbiFlag, abigenPackageFlag, abigenAccountFlag *string
+	if command == "help" || command == "abigen" {
+		abigenAbiFlag = flag.String("abi", "", "abigen: abi file of the contract")
+		abigenPackageFlag = flag.String("package", "", "abigen: package name of the generated bindings")
+		abigenAccountFlag = flag.String("account", "", "abigen: account of the contract, if it is known")
+	}
 	var testCompileOnlyFlag, testVerboseFlag, testShortFlag *bool
 	var testBenchRegexp *string
 	var testBenchTime *string
@@ -1490,6 +1556,7 @@ func main() {
 		Opt:             *opt,
 		GC:              *gc,
 		PanicStrategy:   *panicStrategy,
+		AllocSites:      *allocSites,
 		Scheduler:       *scheduler,
 		Serial:          *serial,
 		Work:            *work,
@@ -1510,6 +1577,9 @@ func main() {
 		LLVMFeatures:    *llvmFeatures,
 		GenCode:         *genCode,
 		Strip:           *strip,
+		StrictRicardian: *strictRicardian,
+		ZeroCopy:        *zeroCopy,
+		NoFloat:         *noFloat,
 		PrintJSON:       flagJSON,
 		Monitor:         *monitor,
 		BaudRate:        *baudrate,
@@ -1598,8 +1668,38 @@ func main() {
 
 		tags = append(tags, "eosio")
 		tags = append(tags, "tinygo.wasm")
-		err := GenerateCode(pkgName, outpath, options.Tags)
+		options.CheckGenerated = *genCheckFlag
+		err := GenerateCode(pkgName, outpath, tags, options)
+		handleCompilerError(err)
+	case "abigen":
+		if *abigenAbiFlag == "" {
+			fmt.Fprintln(os.Stderr, "No abi file supplied (-abi).")
+			usage(command)
+			os.Exit(1)
+		}
+		if flag.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, "abigen does not accept positional arguments")
+			usage(command)
+			os.Exit(1)
+		}
+		err := GenerateBindings(*abigenAbiFlag, *abigenPackageFlag, *abigenAccountFlag, outpath)
 		handleCompilerError(err)
+	case "wasmcheck":
+		if flag.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "No wasm file supplied.")
+			usage(command)
+			os.Exit(1)
+		}
+		failed := false
+		for _, file := range flag.Args() {
+			if err := checkEosioWasmFile(file, options.NoFloat); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
 	case "build-library":
 		// Note: this command is only meant to be used while making a release!
 		if outpath == "" {
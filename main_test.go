@@ -12,6 +12,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
@@ -22,6 +23,7 @@ import (
 
 	"github.com/tinygo-org/tinygo/builder"
 	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/eosiotest"
 	"github.com/tinygo-org/tinygo/goenv"
 )
 
@@ -275,6 +277,50 @@ func emuCheck(t *testing.T, options compileopts.Options) {
 	}
 }
 
+// TestEosioTableIteration builds the contract in testdata/eosio/iteration with
+// its generated code and runs it in the eosiotest chain, to check the rows
+// that the generated iteration methods visit.
+func TestEosioTableIteration(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("skipping eosio contract build in short mode")
+	}
+	if _, err := os.Stat(filepath.Join(goenv.Get("TINYGOROOT"), "lib", "eosio", "sysroot")); err != nil {
+		t.Skip("eosio sysroot not built:", err)
+	}
+
+	options := optionsFromTarget("eosio", sema)
+	options.GenCode = true
+	outpath := filepath.Join(t.TempDir(), "iteration.wasm")
+	if err := Build("./"+TESTDATA+"/eosio/iteration", outpath, &options); err != nil {
+		printCompilerError(t.Log, err)
+		t.Fatal("failed to build contract")
+	}
+
+	chain := eosiotest.NewChain()
+	if err := chain.DeployFile("hello", outpath); err != nil {
+		t.Fatal(err)
+	}
+	trace, err := chain.PushAction("hello", "test", nil, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `range 2 3 4
+reverse 4 3 2
+stop 1 2
+empty
+value 4 3 2
+value reverse 2 3 4
+erase 1 3 5
+erase value 1 5
+lowerbound true 5
+upperbound false true
+`
+	if console := trace.Console(); console != expected {
+		t.Errorf("expected output:\n%s\ngot:\n%s", expected, console)
+	}
+}
+
 func optionsFromTarget(target string, sema chan struct{}) compileopts.Options {
 	return compileopts.Options{
 		// GOOS/GOARCH are only used if target == ""
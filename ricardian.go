@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ABIRicardianClause is an entry of the ricardian_clauses list of an ABI.
+type ABIRicardianClause struct {
+	ID   string `json:"id"`
+	Body string `json:"body"`
+}
+
+type ricardianSection struct {
+	Name string
+	Body string
+}
+
+var ricardianHeaderRegexp = regexp.MustCompile(`<h1\s+class\s*=\s*"(contract|clause)"\s*>(.*?)</h1>`)
+
+// parseRicardianSections splits a ricardian markdown file in the format used
+// by eosio.cdt into sections. Every section starts with a header like
+// <h1 class="contract">transfer</h1> and ends at the next header. Only
+// sections with the given class are returned, in the order of the file.
+func parseRicardianSections(text string, class string) []ricardianSection {
+	var sections []ricardianSection
+	headers := ricardianHeaderRegexp.FindAllStringSubmatchIndex(text, -1)
+	for i, header := range headers {
+		end := len(text)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		if text[header[2]:header[3]] != class {
+			continue
+		}
+		sections = append(sections, ricardianSection{
+			Name: strings.TrimSpace(text[header[4]:header[5]]),
+			Body: strings.TrimSpace(text[header[1]:end]),
+		})
+	}
+	return sections
+}
+
+// readRicardianFile returns the sections of the given class in file. A
+// missing file is not an error.
+func readRicardianFile(file string, class string) ([]ricardianSection, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseRicardianSections(string(data), class), nil
+}
+
+// ricardianFromDoc returns the doc comment of an action function without the
+// //action or //notify line, to be used as its ricardian contract.
+func ricardianFromDoc(doc *ast.CommentGroup) string {
+	lines := make([]string, 0, len(doc.List))
+	for _, comment := range doc.List {
+		text := comment.Text
+		if fields := strings.Fields(text); len(fields) != 0 && (fields[0] == "//action" || fields[0] == "//notify") {
+			continue
+		}
+		if strings.HasPrefix(text, "//") {
+			// The indentation after the space is kept for markdown.
+			lines = append(lines, strings.TrimRight(strings.TrimPrefix(text[2:], " "), " \t"))
+			continue
+		}
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// LoadRicardian reads <contract>.contracts.md and <contract>.clauses.md from
+// the contract directory. Sections in <contract>.contracts.md take precedence
+// over the doc comments of the action functions.
+func (t *CodeGenerator) LoadRicardian() error {
+	if t.contractName == "" {
+		return nil
+	}
+
+	contracts, err := readRicardianFile(filepath.Join(t.dirName, t.contractName+".contracts.md"), "contract")
+	if err != nil {
+		return err
+	}
+	for _, section := range contracts {
+		found := false
+		for i := range t.actions {
+			if t.actions[i].ActionName == section.Name && t.actions[i].inABI() {
+				t.actions[i].Ricardian = section.Body
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s.contracts.md: ricardian contract for unknown action %s", t.contractName, section.Name)
+		}
+	}
+
+	clauses, err := readRicardianFile(filepath.Join(t.dirName, t.contractName+".clauses.md"), "clause")
+	if err != nil {
+		return err
+	}
+	for _, section := range clauses {
+		t.ricardianClauses = append(t.ricardianClauses, ABIRicardianClause{ID: section.Name, Body: section.Body})
+	}
+	return nil
+}
+
+// checkRicardian returns an error for the first action without a ricardian
+// contract.
+func (t *CodeGenerator) checkRicardian() error {
+	for _, action := range t.actions {
+		if action.IsNotify {
+			continue
+		}
+		if action.Ricardian == "" {
+			return t.newError(action.Pos, "action %s has no ricardian contract", action.ActionName)
+		}
+	}
+	return nil
+}
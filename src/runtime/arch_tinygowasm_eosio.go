@@ -44,17 +44,20 @@ func getCurrentStackPointer() uintptr
 // otherwise.
 func growHeap() bool {
 	// Grow memory by the available size, which means the heap size is doubled.
+	// The chain limits the memory of a contract (33MiB by default), so when
+	// doubling fails, try to grow by whatever is left below that limit.
 	memorySize := wasm_memory_size(0)
-	result := wasm_memory_grow(0, memorySize)
-	if result == -1 {
-		// Grow failed.
-		return false
-	}
+	for delta := memorySize; delta > 0; delta /= 2 {
+		if wasm_memory_grow(0, delta) != -1 {
+			setHeapEnd(uintptr(wasm_memory_size(0) * wasmPageSize))
 
-	setHeapEnd(uintptr(wasm_memory_size(0) * wasmPageSize))
+			// Heap has grown successfully.
+			return true
+		}
+	}
 
-	// Heap has grown successfully.
-	return true
+	// Grow failed.
+	return false
 }
 
 // The below functions override the default allocator of wasi-libc.
@@ -65,12 +68,12 @@ func growHeap() bool {
 
 //export malloc
 func libc_malloc(size uintptr) unsafe.Pointer {
-	return alloc(size, nil)
+	return libcAlloc(size)
 }
 
 //export free
 func libc_free(ptr unsafe.Pointer) {
-	free(ptr)
+	libcFree(ptr)
 }
 
 //export calloc
@@ -78,29 +81,29 @@ func libc_calloc(nmemb, size uintptr) unsafe.Pointer {
 	// Note: we could be even more correct here and check that nmemb * size
 	// doesn't overflow. However the current implementation should normally work
 	// fine.
-	return alloc(nmemb*size, nil)
+	return libcAlloc(nmemb * size)
 }
 
 //export realloc
 func libc_realloc(ptr unsafe.Pointer, size uintptr) unsafe.Pointer {
-	runtimePanic("unimplemented: realloc")
+	runtimeFatal("unimplemented: realloc")
 	return nil
 }
 
 //export posix_memalign
 func libc_posix_memalign(memptr *unsafe.Pointer, alignment, size uintptr) int {
-	runtimePanic("unimplemented: posix_memalign")
+	runtimeFatal("unimplemented: posix_memalign")
 	return 0
 }
 
 //export aligned_alloc
 func libc_aligned_alloc(alignment, bytes uintptr) unsafe.Pointer {
-	runtimePanic("unimplemented: aligned_alloc")
+	runtimeFatal("unimplemented: aligned_alloc")
 	return nil
 }
 
 //export malloc_usable_size
 func libc_malloc_usable_size(ptr unsafe.Pointer) uintptr {
-	runtimePanic("unimplemented: malloc_usable_size")
+	runtimeFatal("unimplemented: malloc_usable_size")
 	return 0
 }
@@ -0,0 +1,208 @@
+//go:build eosio && gc.arena
+// +build eosio,gc.arena
+
+package runtime
+
+/*
+#include <stdint.h>
+void  eosio_assert_message( uint32_t test, const char* msg, uint32_t msg_len );
+*/
+import "C"
+
+// This is the arena allocator of eosio contracts. The chain runs every action
+// in a fresh instance of the contract, so all memory of an action is released
+// at once when the action ends: the heap is an arena that is never collected.
+// Memory above the high-water mark was never handed out during the action and
+// is still zero, so only reused memory (after freeing the last allocation)
+// has to be cleared.
+
+import (
+	"unsafe"
+)
+
+// Next free byte of the arena.
+var heapptr = heapStart
+
+// End of the memory that was ever allocated during this action. The memory
+// above it is zero.
+var heapHighWater = heapStart
+
+// Start of the last allocation, which is the only one that free() releases.
+var lastAlloc uintptr
+
+// Total amount allocated for runtime.MemStats
+var gcTotalAlloc uint64
+
+// Total number of calls to alloc()
+var gcMallocs uint64
+
+// Total number of objects freed, which are only released last allocations
+var gcFrees uint64
+
+// allocSite counts the allocations of a call site.
+type allocSite struct {
+	mallocs uint64
+	bytes   uint64
+}
+
+// Source positions of the allocations, which are only recorded with
+// -alloc-sites. The compiler fills in the table and stores the position of
+// each allocation in allocLocation (1 + the index in the table) right before
+// it. Allocations in the runtime, like appending to a slice, have the
+// position of the call outside of the runtime.
+var (
+	allocLocations []string
+	allocLocation  uint32
+)
+
+// Allocations per call site, indexed like allocLocation.
+var allocSites []allocSite
+
+func alloc(size uintptr, layout unsafe.Pointer) unsafe.Pointer {
+	size = align(size)
+	ptr := arenaAlloc(size)
+	gcTotalAlloc += uint64(size)
+	gcMallocs++
+	if len(allocLocations) != 0 {
+		if allocSites == nil {
+			// The table is allocated from the arena itself, so it isn't
+			// counted as an allocation.
+			n := uintptr(len(allocLocations) + 1)
+			allocSites = (*[1 << 24]allocSite)(arenaAlloc(align(n * unsafe.Sizeof(allocSite{}))))[:n:n]
+		}
+		site := &allocSites[allocLocation]
+		site.mallocs++
+		site.bytes += uint64(size)
+	}
+	return ptr
+}
+
+// arenaAlloc returns size bytes of zeroed memory from the arena.
+func arenaAlloc(size uintptr) unsafe.Pointer {
+	addr := heapptr
+	heapptr += size
+	for heapptr >= heapEnd {
+		// Try to increase the heap and check again.
+		if growHeap() {
+			continue
+		}
+		// Failed to make the heap bigger, so we must really be out of memory.
+		arenaOutOfMemory(size)
+	}
+	if addr < heapHighWater {
+		// This memory was used before, by an allocation that was freed.
+		end := heapptr
+		if end > heapHighWater {
+			end = heapHighWater
+		}
+		memzero(unsafe.Pointer(addr), end-addr)
+	}
+	if heapptr > heapHighWater {
+		heapHighWater = heapptr
+	}
+	lastAlloc = addr
+	return unsafe.Pointer(addr)
+}
+
+// Buffer of the out of memory message, which can't be allocated.
+var arenaMessage [256]byte
+
+// arenaOutOfMemory aborts the action with the heap usage, and the position of
+// the allocation and the call site that allocated most memory if the
+// positions are recorded.
+func arenaOutOfMemory(size uintptr) {
+	msg := appendString(arenaMessage[:0], "panic: runtime error: out of memory: allocating ")
+	msg = appendUint(msg, uint64(size))
+	msg = appendString(msg, " bytes")
+	if allocLocation != 0 {
+		msg = appendString(msg, " at ")
+		msg = appendString(msg, allocLocations[allocLocation-1])
+	}
+	msg = appendString(msg, " with ")
+	msg = appendUint(msg, gcTotalAlloc)
+	msg = appendString(msg, " bytes in ")
+	msg = appendUint(msg, gcMallocs)
+	msg = appendString(msg, " allocations")
+	max := 0
+	for i := range allocSites {
+		if allocSites[i].bytes > allocSites[max].bytes {
+			max = i
+		}
+	}
+	if max != 0 {
+		msg = appendString(msg, ", most by ")
+		msg = appendString(msg, allocLocations[max-1])
+		msg = appendString(msg, ": ")
+		msg = appendUint(msg, allocSites[max].bytes)
+		msg = appendString(msg, " bytes")
+	}
+	// Assert would allocate to add the position.
+	C.eosio_assert_message(0, (*C.char)(unsafe.Pointer(&msg[0])), C.uint32_t(len(msg)))
+}
+
+// appendString appends s to buf as far as it fits, without allocating.
+func appendString(buf []byte, s string) []byte {
+	for i := 0; i < len(s) && len(buf) < cap(buf); i++ {
+		buf = append(buf, s[i])
+	}
+	return buf
+}
+
+// appendUint appends the decimal representation of n to buf as far as it
+// fits, without allocating.
+func appendUint(buf []byte, n uint64) []byte {
+	var digits [20]byte
+	i := len(digits)
+	for {
+		i--
+		digits[i] = byte('0' + n%10)
+		n /= 10
+		if n == 0 {
+			break
+		}
+	}
+	for _, c := range digits[i:] {
+		if len(buf) == cap(buf) {
+			break
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+func free(ptr unsafe.Pointer) {
+	// Only the last allocation can be released, which is common for
+	// temporary buffers of C code.
+	if uintptr(ptr) == lastAlloc && lastAlloc != 0 {
+		heapptr = lastAlloc
+		lastAlloc = 0
+		gcFrees++
+	}
+}
+
+func GC() {
+	// No-op: the arena is released when the action ends.
+}
+
+func KeepAlive(x interface{}) {
+	// Unimplemented. Only required with SetFinalizer().
+}
+
+func SetFinalizer(obj interface{}, finalizer interface{}) {
+	// Unimplemented.
+}
+
+func initHeap() {
+	// preinit() may have moved heapStart; reset heapptr
+	heapptr = align(heapStart)
+	heapHighWater = heapptr
+}
+
+// setHeapEnd sets a new (larger) heapEnd pointer.
+func setHeapEnd(newHeapEnd uintptr) {
+	heapEnd = newHeapEnd
+}
+
+func markRoots(start, end uintptr) {
+	// dummy, so that markGlobals will compile
+}
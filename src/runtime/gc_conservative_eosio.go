@@ -0,0 +1,48 @@
+//go:build eosio && gc.conservative
+// +build eosio,gc.conservative
+
+package runtime
+
+// The conservative GC on eosio. Contracts don't run on WASI: the heap starts
+// at __heap_base (set again by apply for every action), the globals are the
+// range from __global_base to __heap_base (see markGlobals) and the stack is
+// scanned using the stack objects the compiler inserts (see markStack).
+// What remains is memory allocated by C code, which the GC can't see.
+
+import (
+	"unsafe"
+)
+
+// Memory allocated by malloc and calloc of C code, until it is freed. C code
+// may keep the only pointer to it in a local variable or in other C memory,
+// both of which aren't scanned by the GC. It is created by the first
+// allocation, so that actions without C allocations don't pay for it.
+var libcAllocs map[uintptr][]byte
+
+// libcAlloc allocates memory for malloc and calloc of C code, which is kept
+// alive until libcFree.
+func libcAlloc(size uintptr) unsafe.Pointer {
+	if size == 0 {
+		// Like alloc, but the pointer must be unique to be freed.
+		size = 1
+	}
+	if libcAllocs == nil {
+		libcAllocs = make(map[uintptr][]byte)
+	}
+	buf := make([]byte, size)
+	ptr := unsafe.Pointer(&buf[0])
+	libcAllocs[uintptr(ptr)] = buf
+	return ptr
+}
+
+// libcFree releases memory for free of C code, so that the next GC cycle can
+// reclaim it.
+func libcFree(ptr unsafe.Pointer) {
+	if ptr == nil {
+		return
+	}
+	if _, ok := libcAllocs[uintptr(ptr)]; !ok {
+		runtimeFatal("free: invalid pointer")
+	}
+	delete(libcAllocs, uintptr(ptr))
+}
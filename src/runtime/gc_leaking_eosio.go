@@ -36,7 +36,7 @@ func alloc(size uintptr, layout unsafe.Pointer) unsafe.Pointer {
 			continue
 		}
 		// Failed to make the heap bigger, so we must really be out of memory.
-		runtimePanic("out of memory")
+		runtimeFatal("out of memory")
 	}
 
 	C.memset(unsafe.Pointer(addr), 0, C.size_t(size))
@@ -0,0 +1,19 @@
+//go:build eosio && !gc.conservative
+// +build eosio,!gc.conservative
+
+package runtime
+
+import (
+	"unsafe"
+)
+
+// libcAlloc allocates memory for malloc and calloc of C code. Memory is never
+// collected by these allocators, so it can be handed out directly.
+func libcAlloc(size uintptr) unsafe.Pointer {
+	return alloc(size, nil)
+}
+
+// libcFree releases memory for free of C code.
+func libcFree(ptr unsafe.Pointer) {
+	free(ptr)
+}
@@ -0,0 +1,53 @@
+//go:build eosio && gc.arena
+// +build eosio,gc.arena
+
+package runtime
+
+// ReadMemStats populates m with memory statistics.
+//
+// The returned memory statistics are up to date as of the
+// call to ReadMemStats. As every action runs in a fresh instance of the
+// contract, they are the statistics of the current action.
+func ReadMemStats(m *MemStats) {
+	m.HeapIdle = uint64(heapEnd - heapptr)
+	m.HeapInuse = uint64(heapptr - heapStart)
+	m.HeapReleased = 0 // always 0, the arena is released when the action ends.
+
+	m.HeapSys = m.HeapInuse + m.HeapIdle
+	m.GCSys = 0
+	m.TotalAlloc = gcTotalAlloc
+	m.Mallocs = gcMallocs
+	m.Frees = gcFrees
+	m.Sys = uint64(heapEnd) // all of the linear memory, including the stack and globals
+}
+
+// AllocSite holds the allocations of a call site, as returned by
+// ReadAllocSites.
+type AllocSite struct {
+	Location string // function and file:line of the call, empty if unknown
+	Mallocs  uint64
+	Bytes    uint64
+}
+
+// ReadAllocSites returns the allocations of the current action per call site.
+// The call sites are only known when the contract is built with -gc=arena and
+// -alloc-sites, otherwise nil is returned.
+func ReadAllocSites() []AllocSite {
+	if len(allocLocations) == 0 {
+		return nil
+	}
+	sites := make([]AllocSite, len(allocSites))
+	n := 0
+	for i, site := range allocSites {
+		if site.mallocs == 0 {
+			continue
+		}
+		if i != 0 {
+			sites[n].Location = allocLocations[i-1]
+		}
+		sites[n].Mallocs = site.mallocs
+		sites[n].Bytes = site.bytes
+		n++
+	}
+	return sites[:n]
+}
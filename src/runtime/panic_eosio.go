@@ -30,8 +30,20 @@ func GetRevertOnPanicFn() RevertFunction {
 	return gRevertFn
 }
 
+// Source positions of the calls that may abort the action, which are only
+// recorded with -panic=location. The compiler fills in the table and stores
+// the position of each call in panicLocation (1 + the index in the table)
+// right before it.
+var (
+	panicLocations []string
+	panicLocation  uint32
+)
+
 //Aborts processing of this action and unwinds all pending changes if the test condition is true
 func Assert(test bool, msg string) {
+	if !test && panicLocation != 0 {
+		msg += " at " + panicLocations[panicLocation-1]
+	}
 	if !test && gRevertFn != nil {
 		gRevertFn(msg)
 		return
@@ -49,9 +61,52 @@ func Assert(test bool, msg string) {
 //export llvm.trap
 func trap()
 
+// Contracts can't jump back to a function with deferred calls, because the
+// chain VM supports neither setjmp/longjmp nor wasm exceptions. Instead, a
+// panic sets the unwinding flag and returns. The compiler checks the flag
+// after every call that may panic: functions without deferred calls then
+// return right away, and a function with a defer frame continues at its
+// landing pad, which runs the deferred calls like on other targets.
+
+// deferFrame is a stack allocated object that stores information for the
+// current "defer frame", which is used in functions that use the `defer`
+// keyword.
+type deferFrame struct {
+	Previous   *deferFrame // previous defer frame
+	Panicking  bool        // true iff this defer frame is panicking
+	PanicValue interface{} // panic value, might be nil for panic(nil) for example
+}
+
+// The innermost defer frame, contracts have a single goroutine.
+var currentDeferFrame *deferFrame
+
+// Set while a panic returns from the functions between the call to panic and
+// the landing pad of currentDeferFrame.
+var unwinding bool
+
+// runtimeError is the panic value of runtime panics, so that they can be
+// recovered as a runtime.Error like in Go.
+type runtimeError string
+
+func (e runtimeError) RuntimeError() {}
+
+func (e runtimeError) Error() string {
+	return "runtime error: " + string(e)
+}
+
 // Builtin function panic(msg), used as a compiler intrinsic.
 func _panic(message interface{}) {
+	if frame := currentDeferFrame; frame != nil {
+		frame.PanicValue = message
+		frame.Panicking = true
+		unwinding = true
+		return
+	}
+	// No deferred call can recover the panic, so abort the action with the
+	// panic message.
 	switch v := message.(type) {
+	case runtimeError:
+		Assert(false, "panic: "+v.Error())
 	case string:
 		msg := "panic: " + v
 		Assert(false, msg)
@@ -61,24 +116,73 @@ func _panic(message interface{}) {
 	default:
 		Assert(false, "panic")
 	}
-	// printstring("panic: ")
-	// printitf(message)
-	// printnl()
-	// eosio_assert(false, msg)
 }
 
 // Cause a runtime panic, which is (currently) always a string.
 func runtimePanic(msg string) {
+	_panic(runtimeError(msg))
+}
+
+// runtimeFatal aborts the action with a runtime error that can't be recovered.
+// It is used for errors that are fatal in Go, and in functions called from C,
+// which doesn't check the unwinding flag.
+func runtimeFatal(msg string) {
 	Assert(false, "panic: runtime error: "+msg)
-	// printstring("panic: runtime error: ")
-	// println(msg)
-	// abort()
 }
 
-// Try to recover a panicking goroutine.
+// Called by the compiler after a call that may have panicked.
+func isUnwinding() bool {
+	return unwinding
+}
+
+// Called at the start of the landing pad, before the deferred calls run.
+func stopUnwinding() {
+	unwinding = false
+}
+
+// Called at the start of a function that includes a deferred call.
+// It gets passed in the stack-allocated defer frame and configures it. The
+// stack pointer is only needed on targets that jump to the landing pad.
+// Note that the frame is not zeroed yet, so we need to initialize all values
+// that will be used.
+func setupDeferFrame(frame *deferFrame, jumpSP unsafe.Pointer) {
+	frame.Previous = currentDeferFrame
+	frame.Panicking = false
+	currentDeferFrame = frame
+}
+
+// Called right before the return instruction. It pops the defer frame from the
+// linked list of defer frames. It also re-raises a panic if the contract is
+// still panicking, which continues unwinding in the caller.
+//
+//go:nobounds
+func destroyDeferFrame(frame *deferFrame) {
+	currentDeferFrame = frame.Previous
+	if frame.Panicking {
+		// We're still panicking!
+		// Re-raise the panic now.
+		_panic(frame.PanicValue)
+	}
+}
+
+// _recover is the built-in recover() function. It tries to recover a currently
+// panicking contract.
+// useParentFrame is set when the caller of runtime._recover has a defer frame
+// itself. In that case, recover() shouldn't check that frame but one frame up.
 func _recover(useParentFrame bool) interface{} {
-	// Deferred functions are currently not executed during panic, so there is
-	// no way this can return anything besides nil.
+	frame := currentDeferFrame
+	if useParentFrame {
+		// Don't recover panic from the current frame (which can't be panicking
+		// already), but instead from the previous frame.
+		frame = frame.Previous
+	}
+	if frame != nil && frame.Panicking {
+		// Only the first call to recover returns the panic value. It also stops
+		// the panicking sequence, hence setting panicking to false.
+		frame.Panicking = false
+		return frame.PanicValue
+	}
+	// Not panicking, so return a nil interface.
 	return nil
 }
 
@@ -7,6 +7,7 @@ package runtime
 #include <stdint.h>
 void prints_l( const char* cstr, uint32_t len);
 uint64_t  current_time( void );
+void eosio_exit( int32_t code );
 */
 import "C"
 
@@ -14,37 +15,14 @@ import (
 	"unsafe"
 )
 
-// Implements __wasi_iovec_t.
-type __wasi_iovec_t struct {
-	buf    unsafe.Pointer
-	bufLen uint
-}
-
-//go:wasm-module wasi_snapshot_preview1
-//export fd_write
-func fd_write(id uint32, iovs *__wasi_iovec_t, iovs_len uint, nwritten *uint) (errno uint)
-
-// See:
-// https://github.com/WebAssembly/WASI/blob/main/phases/snapshot/docs.md#-proc_exitrval-exitcode
-//go:wasm-module wasi_snapshot_preview1
-//export proc_exit
-func proc_exit(exitcode uint32)
-
 func postinit() {}
 
-const (
-	putcharBufferSize = 120
-	stdout            = 1
-)
+const putcharBufferSize = 120
 
 // Using global variables to avoid heap allocation.
 var (
 	putcharBuffer        = [putcharBufferSize]byte{}
 	putcharPosition uint = 0
-	putcharIOVec         = __wasi_iovec_t{
-		buf: unsafe.Pointer(&putcharBuffer[0]),
-	}
-	putcharNWritten uint
 )
 
 func putchar(c byte) {
@@ -52,16 +30,22 @@ func putchar(c byte) {
 	putcharPosition++
 
 	if c == '\n' || putcharPosition >= putcharBufferSize {
-		putcharIOVec.bufLen = putcharPosition
 		C.prints_l((*C.char)(unsafe.Pointer(&putcharBuffer)), uint32(putcharPosition))
-		//		fd_write(stdout, &putcharIOVec, 1, &putcharNWritten)
 		putcharPosition = 0
 	}
 }
 
+// currentTime returns the time of the block in microseconds since the epoch.
+func currentTime() uint64 {
+	return uint64(C.current_time())
+}
+
+// now returns the time of the block, which is the same for all actions of a
+// block.
+//
 //go:linkname now time.now
 func now() (sec int64, nsec int32, mono int64) {
-	mono = int64(C.current_time()) * 1000
+	mono = nanotime()
 	sec = mono / (1000 * 1000 * 1000)
 	nsec = int32(mono - sec*(1000*1000*1000))
 	return
@@ -74,7 +58,7 @@ func abort() {
 
 //go:linkname syscall_Exit syscall.Exit
 func syscall_Exit(code int) {
-	proc_exit(uint32(code))
+	C.eosio_exit(C.int32_t(code))
 }
 
 // TinyGo does not yet support any form of parallelism on WebAssembly, so these
@@ -1,3 +1,6 @@
+//go:build !eosio
+// +build !eosio
+
 package runtime
 
 // timerNode is an element in a linked list of timers.
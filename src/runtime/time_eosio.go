@@ -0,0 +1,35 @@
+//go:build eosio
+// +build eosio
+
+package runtime
+
+// Timers never fire in a contract: an action runs to completion without
+// waiting, so starting a timer aborts the action.
+
+// timerNode is an element in a linked list of timers.
+type timerNode struct {
+	next     *timerNode
+	timer    *timer
+	callback func(*timerNode)
+}
+
+// whenTicks returns the (absolute) time when this timer should trigger next.
+func (t *timerNode) whenTicks() timeUnit {
+	return nanosecondsToTicks(t.timer.when)
+}
+
+//go:linkname startTimer time.startTimer
+func startTimer(tim *timer) {
+	Assert(false, "timers are not supported in contracts: an action can't wait")
+}
+
+//go:linkname stopTimer time.stopTimer
+func stopTimer(tim *timer) bool {
+	return false
+}
+
+//go:linkname resetTimer time.resetTimer
+func resetTimer(tim *timer, when int64) bool {
+	startTimer(tim)
+	return false
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract attributes
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//action transfer auth=from
+func (c *Contract) Transfer(from chain.Name, to chain.Name, quantity chain.Asset, memo string) {
+}
+
+//action approve auth=owner auth=spender
+func (c *Contract) Approve(owner chain.Name, spender chain.Name) {
+}
+
+//action getbalance read-only
+func (c *Contract) GetBalance(owner chain.Name) uint64 {
+	return 0
+}
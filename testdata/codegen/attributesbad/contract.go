@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract attributesbad
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//action transfer auth=memo
+func (c *Contract) Transfer(from chain.Name, memo string) {
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+type Balance uint64
+
+type Ledger map[chain.Name]Balance
+
+//contract containers
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//packer
+type Point struct {
+	x int32
+	y int32
+}
+
+//optional
+type OptionalIds struct {
+	chain.Optional
+	value []uint64
+}
+
+//binary_extension
+type ExtensionMatrix struct {
+	chain.BinaryExtension
+	value [][]uint32
+}
+
+//packer
+type Data struct {
+	matrix   [][]uint64
+	names    [][]string
+	blobs    [][]byte
+	hash     [4]uint64
+	points   [2]Point
+	scores   map[string]uint64
+	ledger   Ledger
+	paths    map[uint32][]Point
+	ids      OptionalIds
+	extra    []OptionalIds
+	extended ExtensionMatrix
+}
+
+//action setdata
+func (c *Contract) SetData(data Data, grid [][]Point) {
+}
+
+//action getscores
+func (c *Contract) GetScores() map[string]uint64 {
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract embedded
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//packer
+type Header struct {
+	version uint32
+	owner   chain.Name
+}
+
+//packer
+type Message struct {
+	Header
+	text string
+}
+
+//table records
+type Record struct {
+	Header
+	id uint64 //primary
+}
+
+//action post
+func (c *Contract) Post(msg Message) {
+}
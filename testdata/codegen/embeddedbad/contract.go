@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract embeddedbad
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//packer
+type Header struct {
+	version uint32
+}
+
+//packer
+type Message struct {
+	text string
+	Header
+}
+
+//action post
+func (c *Contract) Post(msg Message) {
+}
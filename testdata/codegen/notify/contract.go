@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract notify
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//action transfer
+func (c *Contract) Transfer(from chain.Name, to chain.Name, quantity chain.Asset, memo string) {
+}
+
+//notify eosio.token::transfer
+func (c *Contract) OnTransfer(from chain.Name, to chain.Name, quantity chain.Asset, memo string) {
+}
+
+//notify fake.token::transfer
+func (c *Contract) OnFakeTransfer(from chain.Name, to chain.Name, quantity chain.Asset, memo string) {
+}
+
+//notify *::issue
+func (c *Contract) OnIssue(to chain.Name, quantity chain.Asset, memo string) {
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract notifybad
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//notify eosio.token::transfer
+func (c *Contract) OnTransfer(from chain.Name, to chain.Name, quantity chain.Asset, memo string) {
+}
+
+//notify *::transfer
+func (c *Contract) OnAnyTransfer(from chain.Name, to chain.Name, quantity chain.Asset, memo string) {
+}
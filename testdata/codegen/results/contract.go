@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract results
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//packer
+type Balance struct {
+	owner    chain.Name
+	quantity chain.Asset
+}
+
+//action getbalance
+func (c *Contract) GetBalance(owner chain.Name) Balance {
+	return Balance{owner: owner}
+}
+
+//action getids
+func (c *Contract) GetIds() []uint64 {
+	return nil
+}
+
+//action noresult
+func (c *Contract) NoResult() {
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract hello
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+// Say hello to {{name}}.
+//action sayhello
+func (c *Contract) SayHello(name string) {
+}
+
+// This text is replaced by hello.contracts.md.
+//action saybye
+func (c *Contract) SayBye(name string) {
+}
+
+//action nodoc
+func (c *Contract) NoDoc() {
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract senders
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//optional
+type OptionalMemo struct {
+	chain.Optional
+	value string
+}
+
+//action transfer
+func (c *Contract) Transfer(from chain.Name, to chain.Name, quantity chain.Asset, memo *OptionalMemo) {
+}
+
+//action setperms
+func (c *Contract) SetPerms(permissions []chain.Name, payer chain.Name) {
+}
+
+//notify issue
+func (c *Contract) OnIssue(to chain.Name, quantity chain.Asset, memo string) {
+}
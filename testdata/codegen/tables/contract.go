@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract tables
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//table mydata
+type MyData struct {
+	id uint64         //primary
+	a1 uint64         //IDX64:bya1:t.a1:t.a1
+	a2 chain.Uint128  //IDX128:bya2:t.a2:t.a2
+	a3 chain.Uint256  //IDX256:bya3:t.a3:t.a3
+	a4 float64        //IDXFloat64:bya4:t.a4:t.a4
+	a5 chain.Float128 //IDXFloat128:bya5:t.a5:t.a5
+}
+
+//table accounts
+type Account struct {
+	balance chain.Asset //primary:t.balance.Symbol.Code()
+	owner   uint64      //secondary
+}
+
+//table config singleton
+type Config struct {
+	value uint64
+}
+
+//action test
+func (c *Contract) Test() {
+}
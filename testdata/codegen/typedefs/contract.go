@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+type AccountName = chain.Name
+
+type Balance uint64
+
+type Memo string
+
+type Balances []Balance
+
+//contract typedefs
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//packer
+type Account struct {
+	owner    AccountName
+	balance  Balance
+	history  []Balance
+	balances Balances
+	memo     Memo
+}
+
+//action transfer
+func (c *Contract) Transfer(from AccountName, to AccountName, amount Balance, memo Memo) {
+}
+
+//action getbalance
+func (c *Contract) GetBalance(owner AccountName) Balance {
+	return 0
+}
+
+//action setaccount
+func (c *Contract) SetAccount(account Account) {
+}
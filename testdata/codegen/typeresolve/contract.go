@@ -0,0 +1,20 @@
+package main
+
+import (
+	c "github.com/uuosio/chain"
+)
+
+//contract typeresolve
+type Contract struct {
+	receiver, firstReceiver, action c.Name
+}
+
+func NewContract(receiver, firstReceiver, action c.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+type AccountName = c.Name
+
+//action transfer
+func (t *Contract) Transfer(from AccountName, to c.Name, quantity c.Asset, memo string, info Info) {
+}
@@ -0,0 +1,8 @@
+//go:build !eosio
+// +build !eosio
+
+package main
+
+//action ignored
+func (t *Contract) Ignored(a uint64) {
+}
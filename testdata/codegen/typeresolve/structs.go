@@ -0,0 +1,9 @@
+package main
+
+import chain "github.com/uuosio/chain"
+
+//packer
+type Info struct {
+	owner  chain.Name
+	values []chain.Uint128
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/uuosio/chain"
+)
+
+//contract zerocopy
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//packer
+type Payload struct {
+	tags []string
+	blob []byte
+}
+
+type Profile struct {
+	nickname string
+}
+
+//table records
+type Record struct {
+	id      uint64 //primary
+	memo    string
+	profile Profile
+}
+
+//action post
+func (c *Contract) Post(from chain.Name, memo string, data []byte, payload Payload) {
+}
+
+//action save
+func (c *Contract) Save(record Record) {
+}
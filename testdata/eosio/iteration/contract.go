@@ -0,0 +1,107 @@
+package main
+
+// This contract runs the generated iteration methods of a table and its
+// secondary index, and prints the primary keys of the rows they visit.
+
+import (
+	"github.com/uuosio/chain"
+	"github.com/uuosio/chain/database"
+)
+
+//contract iteration
+type Contract struct {
+	receiver, firstReceiver, action chain.Name
+}
+
+func NewContract(receiver, firstReceiver, action chain.Name) *Contract {
+	return &Contract{receiver, firstReceiver, action}
+}
+
+//table rows
+type Row struct {
+	id    uint64 //primary
+	value uint64 //IDX64:value:t.value:t.value
+}
+
+func printIDs(name string, ids []uint64) {
+	chain.Print(name)
+	for _, id := range ids {
+		chain.Print(" ")
+		chain.Print(id)
+	}
+	chain.Print("\n")
+}
+
+//action test
+func (c *Contract) Test() {
+	rows := NewRowTable(c.receiver, c.receiver)
+	for _, id := range []uint64{5, 1, 4, 2, 3} {
+		rows.Store(&Row{id: id, value: 10 * (6 - id)}, c.receiver)
+	}
+
+	var ids []uint64
+	collect := func(it *database.Iterator, v *Row) bool {
+		ids = append(ids, v.id)
+		return true
+	}
+	collectByValue := func(it *database.SecondaryIterator, v *Row) bool {
+		ids = append(ids, v.id)
+		return true
+	}
+
+	ids = nil
+	rows.Range(2, 4, collect)
+	printIDs("range", ids)
+	ids = nil
+	rows.RangeReverse(2, 4, collect)
+	printIDs("reverse", ids)
+	ids = nil
+	rows.Range(0, ^uint64(0), func(it *database.Iterator, v *Row) bool {
+		ids = append(ids, v.id)
+		return len(ids) < 2
+	})
+	printIDs("stop", ids)
+	ids = nil
+	rows.Range(6, 9, collect)
+	rows.Range(4, 2, collect)
+	rows.RangeReverse(4, 2, collect)
+	rows.RangeReverse(6, 9, collect)
+	rows.RangeByvalue(45, 15, collectByValue)
+	rows.RangeReverseByvalue(45, 15, collectByValue)
+	printIDs("empty", ids)
+
+	// id 4 has the value 20, id 3 30 and id 2 40.
+	ids = nil
+	rows.RangeByvalue(15, 45, collectByValue)
+	printIDs("value", ids)
+	ids = nil
+	rows.RangeReverseByvalue(15, 45, collectByValue)
+	printIDs("value reverse", ids)
+
+	// Erase the even rows while iterating over all of them.
+	rows.Range(0, ^uint64(0), func(it *database.Iterator, v *Row) bool {
+		if v.id%2 == 0 {
+			rows.EraseByIterator(it)
+		}
+		return true
+	})
+	ids = nil
+	rows.Range(0, ^uint64(0), collect)
+	printIDs("erase", ids)
+
+	// Erase the row with the value 30 through the secondary index.
+	rows.RangeByvalue(0, ^uint64(0), func(it *database.SecondaryIterator, v *Row) bool {
+		if v.value == 30 {
+			rows.EraseByvalue(it)
+		}
+		return true
+	})
+	ids = nil
+	rows.Range(0, ^uint64(0), collect)
+	printIDs("erase value", ids)
+
+	it, v := rows.LowerBound(2)
+	chain.Println("lowerbound", it.IsOk(), v.id)
+	it, v = rows.UpperBound(5)
+	chain.Println("upperbound", it.IsOk(), v == nil)
+}
@@ -75,6 +75,15 @@ func Optimize(mod llvm.Module, config *compileopts.Config, optLevel, sizeLevel i
 	if config.PanicStrategy() == "trap" {
 		ReplacePanicsWithTrap(mod) // -panic=trap
 	}
+	if config.PanicStrategy() == "location" {
+		RecordPanicLocations(mod) // -panic=location
+	}
+	if config.AllocSites() {
+		RecordAllocSites(mod) // -alloc-sites
+	}
+	if config.PanicFlag() {
+		OptimizeUnwindChecks(mod)
+	}
 
 	// run a check of all of our code
 	if config.VerifyIR() {
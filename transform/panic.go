@@ -1,6 +1,10 @@
 package transform
 
 import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
 	"tinygo.org/x/go-llvm"
 )
 
@@ -31,3 +35,209 @@ func ReplacePanicsWithTrap(mod llvm.Module) {
 		}
 	}
 }
+
+// RecordPanicLocations stores the source position of each call that may abort
+// the program in runtime.panicLocation, right before the call. The positions
+// are collected in the runtime.panicLocations table, so that the runtime can
+// add them to the abort message. This is the -panic=location command-line
+// option, which is implemented by the eosio runtime.
+func RecordPanicLocations(mod llvm.Module) {
+	location := mod.NamedGlobal("runtime.panicLocation")
+	table := mod.NamedGlobal("runtime.panicLocations")
+	if location.IsNil() || table.IsNil() {
+		return
+	}
+
+	// The functions that abort the program, directly or by calling each
+	// other. Calls between them keep the position of the original call.
+	var panicFuncs []llvm.Value
+	isPanicFunc := map[llvm.Value]bool{}
+	for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		name := fn.Name()
+		if name == "runtime._panic" || name == "runtime.Assert" || name == "runtime.runtimeFatal" || strings.HasPrefix(name, "runtime.") && strings.HasSuffix(name, "Panic") {
+			panicFuncs = append(panicFuncs, fn)
+			isPanicFunc[fn] = true
+		}
+	}
+	isPanicFunc[mod.NamedFunction("runtime.destroyDeferFrame")] = true // re-raises a panic
+
+	recordCallPositions(mod, location, table, panicFuncs, isPanicFunc)
+}
+
+// RecordAllocSites stores the source position of each heap allocation in
+// runtime.allocLocation, right before the call, and collects the positions in
+// the runtime.allocLocations table. The arena allocator of eosio counts its
+// allocations per position. This is the -alloc-sites command-line option.
+func RecordAllocSites(mod llvm.Module) {
+	location := mod.NamedGlobal("runtime.allocLocation")
+	table := mod.NamedGlobal("runtime.allocLocations")
+	alloc := mod.NamedFunction("runtime.alloc")
+	if location.IsNil() || table.IsNil() || alloc.IsNil() {
+		return
+	}
+
+	// runtime.alloc and the runtime functions that reach it, like appending
+	// to a slice, concatenating strings or growing a map. Calls between them
+	// keep the position of the call outside of the runtime.
+	allocFuncs := []llvm.Value{alloc}
+	isAllocFunc := map[llvm.Value]bool{alloc: true}
+	for i := 0; i < len(allocFuncs); i++ {
+		for _, call := range getUses(allocFuncs[i]) {
+			if call.IsACallInst().IsNil() || call.CalledValue() != allocFuncs[i] {
+				continue
+			}
+			caller := call.InstructionParent().Parent()
+			if !isAllocFunc[caller] && strings.HasPrefix(caller.Name(), "runtime.") {
+				isAllocFunc[caller] = true
+				allocFuncs = append(allocFuncs, caller)
+			}
+		}
+	}
+
+	recordCallPositions(mod, location, table, allocFuncs, isAllocFunc)
+}
+
+// recordCallPositions stores the position of each call to one of funcs in the
+// location global, right before the call, unless the call is made by one of
+// the functions in skip. The positions are the function and file:line of the
+// call, table is the []string with the positions and location is set to 1 +
+// the index in the table.
+func recordCallPositions(mod llvm.Module, location, table llvm.Value, funcs []llvm.Value, skip map[llvm.Value]bool) {
+	ctx := mod.Context()
+	builder := ctx.NewBuilder()
+	defer builder.Dispose()
+
+	var locations []string
+	indices := map[string]int{}
+	for _, fn := range funcs {
+		for _, call := range getUses(fn) {
+			if call.IsACallInst().IsNil() || call.CalledValue() != fn {
+				continue
+			}
+			caller := call.InstructionParent().Parent()
+			if skip[caller] {
+				continue
+			}
+			index := 0 // no position, so that an older one isn't reported
+			if pos := getPosition(call); pos.IsValid() {
+				loc := caller.Name() + " (" + filepath.Base(pos.Filename) + ":" + strconv.Itoa(pos.Line) + ")"
+				if _, ok := indices[loc]; !ok {
+					locations = append(locations, loc)
+					indices[loc] = len(locations)
+				}
+				index = indices[loc]
+			}
+			builder.SetInsertPointBefore(call)
+			builder.CreateStore(llvm.ConstInt(location.Type().ElementType(), uint64(index), false), location)
+		}
+	}
+
+	// Fill in the table, which is a []string.
+	sliceType := table.Type().ElementType()
+	stringType := sliceType.StructElementTypes()[0].ElementType()
+	lengthType := sliceType.StructElementTypes()[1]
+	zero := llvm.ConstInt(ctx.Int32Type(), 0, false)
+	var values []llvm.Value
+	for i, loc := range locations {
+		buf := makeGlobalArray(mod, []byte(loc), table.Name()+"$"+strconv.Itoa(i), ctx.Int8Type())
+		buf.SetLinkage(llvm.PrivateLinkage)
+		buf.SetGlobalConstant(true)
+		buf.SetUnnamedAddr(true)
+		values = append(values, llvm.ConstNamedStruct(stringType, []llvm.Value{
+			llvm.ConstGEP(buf, []llvm.Value{zero, zero}),
+			llvm.ConstInt(stringType.StructElementTypes()[1], uint64(len(loc)), false),
+		}))
+	}
+	array := llvm.AddGlobal(mod, llvm.ArrayType(stringType, len(values)), table.Name()+"$table")
+	array.SetInitializer(llvm.ConstArray(stringType, values))
+	array.SetLinkage(llvm.PrivateLinkage)
+	array.SetGlobalConstant(true)
+	length := llvm.ConstInt(lengthType, uint64(len(values)), false)
+	table.SetInitializer(ctx.ConstStruct([]llvm.Value{
+		llvm.ConstGEP(array, []llvm.Value{zero, zero}),
+		length,
+		length,
+	}, false))
+}
+
+// OptimizeUnwindChecks removes the checks of the panic flag that the compiler
+// inserts after calls when panics unwind by returning from every function
+// (compileopts.Config.PanicFlag). A check is only needed after calls to
+// functions that can reach runtime._panic. When the program has no deferred
+// calls, runtime._panic aborts right away and no check is needed at all.
+func OptimizeUnwindChecks(mod llvm.Module) {
+	isUnwinding := mod.NamedFunction("runtime.isUnwinding")
+	if isUnwinding.IsNil() {
+		return
+	}
+	hasDeferFrames := hasUses(mod.NamedFunction("runtime.setupDeferFrame"))
+
+	// Find the functions that may panic: runtime._panic and all functions
+	// that (indirectly) call it. Indirect calls may call any function.
+	mayPanic := map[llvm.Value]bool{}
+	callers := map[llvm.Value][]llvm.Value{}
+	var worklist []llvm.Value
+	for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		for bb := fn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+			for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+				if inst.IsACallInst().IsNil() {
+					continue
+				}
+				callee := calledFunction(inst)
+				if callee.IsNil() {
+					if inst.CalledValue().IsAInlineAsm().IsNil() && !mayPanic[fn] {
+						mayPanic[fn] = true
+						worklist = append(worklist, fn)
+					}
+					continue
+				}
+				callers[callee] = append(callers[callee], fn)
+			}
+		}
+	}
+	if panicFn := mod.NamedFunction("runtime._panic"); !panicFn.IsNil() {
+		mayPanic[panicFn] = true
+		worklist = append(worklist, panicFn)
+	}
+	for len(worklist) != 0 {
+		fn := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		for _, caller := range callers[fn] {
+			if !mayPanic[caller] {
+				mayPanic[caller] = true
+				worklist = append(worklist, caller)
+			}
+		}
+	}
+
+	// The compiler emits each check right after the call that may panic.
+	for _, check := range getUses(isUnwinding) {
+		if check.IsACallInst().IsNil() {
+			continue
+		}
+		if hasDeferFrames {
+			call := llvm.PrevInstruction(check)
+			if call.IsNil() || call.IsACallInst().IsNil() {
+				continue
+			}
+			if callee := calledFunction(call); callee.IsNil() || mayPanic[callee] {
+				continue
+			}
+		}
+		check.ReplaceAllUsesWith(llvm.ConstInt(check.Type(), 0, false))
+		check.EraseFromParentAsInstruction()
+	}
+}
+
+// calledFunction returns the function called by the call instruction, or nil
+// for an indirect call.
+func calledFunction(call llvm.Value) llvm.Value {
+	callee := call.CalledValue()
+	if !callee.IsAConstantExpr().IsNil() && callee.Opcode() == llvm.BitCast {
+		callee = callee.Operand(0)
+	}
+	if callee.IsAFunction().IsNil() {
+		return llvm.Value{}
+	}
+	return callee
+}
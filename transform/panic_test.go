@@ -10,3 +10,19 @@ func TestReplacePanicsWithTrap(t *testing.T) {
 	t.Parallel()
 	testTransform(t, "testdata/panic", transform.ReplacePanicsWithTrap)
 }
+
+func TestRecordPanicLocations(t *testing.T) {
+	t.Parallel()
+	testTransform(t, "testdata/panic-location", transform.RecordPanicLocations)
+}
+
+func TestRecordAllocSites(t *testing.T) {
+	t.Parallel()
+	testTransform(t, "testdata/alloc-sites", transform.RecordAllocSites)
+}
+
+func TestOptimizeUnwindChecks(t *testing.T) {
+	t.Parallel()
+	testTransform(t, "testdata/unwind", transform.OptimizeUnwindChecks)
+	testTransform(t, "testdata/unwind-nodefer", transform.OptimizeUnwindChecks)
+}
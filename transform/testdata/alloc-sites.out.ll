@@ -0,0 +1,60 @@
+target datalayout = "e-m:e-p:32:32-i64:64-n32:64-S128"
+target triple = "wasm32-unknown-wasi"
+
+%runtime._string = type { i8*, i32 }
+
+@runtime.allocLocations = internal global { %runtime._string*, i32, i32 } { %runtime._string* getelementptr inbounds ([2 x %runtime._string], [2 x %runtime._string]* @"runtime.allocLocations$table", i32 0, i32 0), i32 2, i32 2 }
+@runtime.allocLocation = internal global i32 0
+@"runtime.allocLocations$0" = private unnamed_addr constant [30 x i8] c"main.allocate (contract.go:11)"
+@"runtime.allocLocations$1" = private unnamed_addr constant [30 x i8] c"main.allocate (contract.go:12)"
+@"runtime.allocLocations$table" = private constant [2 x %runtime._string] [%runtime._string { i8* getelementptr inbounds ([30 x i8], [30 x i8]* @"runtime.allocLocations$0", i32 0, i32 0), i32 30 }, %runtime._string { i8* getelementptr inbounds ([30 x i8], [30 x i8]* @"runtime.allocLocations$1", i32 0, i32 0), i32 30 }]
+
+declare i8* @runtime.alloc(i32, i8*, i8*)
+
+declare void @runtime.Assert(i1, i8*, i32, i8*)
+
+define i8* @runtime.growSlice(i32 %size, i8* %context) {
+  %buf = call i8* @runtime.alloc(i32 %size, i8* null, i8* undef)
+  ret i8* %buf
+}
+
+define i8* @runtime.sliceAppend(i32 %size, i8* %context) {
+  %buf = call i8* @runtime.growSlice(i32 %size, i8* undef)
+  ret i8* %buf
+}
+
+define void @runtime.printnl(i8* %context) {
+  ret void
+}
+
+define void @main.allocate(i1 %ok, i8* %context) !dbg !3 {
+entry:
+  store i32 1, i32* @runtime.allocLocation, align 4, !dbg !6
+  %buf = call i8* @runtime.alloc(i32 16, i8* null, i8* undef), !dbg !6
+  store i32 2, i32* @runtime.allocLocation, align 4, !dbg !7
+  %appended = call i8* @runtime.sliceAppend(i32 32, i8* undef), !dbg !7
+  store i32 2, i32* @runtime.allocLocation, align 4, !dbg !7
+  %again = call i8* @runtime.sliceAppend(i32 32, i8* undef), !dbg !7
+  call void @runtime.printnl(i8* undef), !dbg !8
+  call void @runtime.Assert(i1 %ok, i8* null, i32 0, i8* undef), !dbg !8
+  ret void
+}
+
+define i8* @main.nodebug(i8* %context) {
+  store i32 0, i32* @runtime.allocLocation, align 4
+  %buf = call i8* @runtime.growSlice(i32 8, i8* undef)
+  ret i8* %buf
+}
+
+!llvm.module.flags = !{!0}
+!llvm.dbg.cu = !{!1}
+
+!0 = !{i32 2, !"Debug Info Version", i32 3}
+!1 = distinct !DICompileUnit(language: DW_LANG_Go, file: !2, producer: "TinyGo", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug)
+!2 = !DIFile(filename: "contract.go", directory: "/src/hello")
+!3 = distinct !DISubprogram(name: "main.allocate", scope: !2, file: !2, line: 10, type: !4, scopeLine: 10, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !1)
+!4 = !DISubroutineType(types: !5)
+!5 = !{}
+!6 = !DILocation(line: 11, column: 9, scope: !3)
+!7 = !DILocation(line: 12, column: 7, scope: !3)
+!8 = !DILocation(line: 13, column: 2, scope: !3)
@@ -0,0 +1,56 @@
+target datalayout = "e-m:e-p:32:32-i64:64-n32:64-S128"
+target triple = "wasm32-unknown-wasi"
+
+%runtime._string = type { i8*, i32 }
+
+@runtime.panicLocations = internal global { %runtime._string*, i32, i32 } zeroinitializer
+@runtime.panicLocation = internal global i32 0
+
+declare void @runtime.Assert(i1, i8*, i32, i8*)
+
+declare void @runtime.runtimePanic(i8*, i32, i8*)
+
+declare i8* @runtime.alloc(i32, i8*, i8*)
+
+; Calls between the panic functions keep the position of the original call.
+; Allocations aren't recorded.
+define void @runtime.lookupPanic(i8* %context) {
+  %err = call i8* @runtime.alloc(i32 8, i8* null, i8* undef)
+  call void @runtime.runtimePanic(i8* null, i32 0, i8* undef)
+  ret void
+}
+
+define void @main.check(i1 %ok, i32 %index, i8* %context) !dbg !3 {
+entry:
+  call void @runtime.Assert(i1 %ok, i8* null, i32 0, i8* undef), !dbg !6
+  call void @runtime.Assert(i1 %ok, i8* null, i32 0, i8* undef), !dbg !6
+  %buf = call i8* @runtime.alloc(i32 16, i8* null, i8* undef), !dbg !8
+  %inbounds = icmp ult i32 %index, 4
+  br i1 %inbounds, label %lookup.next, label %lookup.throw
+
+lookup.next:
+  ret void
+
+lookup.throw:
+  call void @runtime.lookupPanic(i8* undef), !dbg !7
+  unreachable
+}
+
+; Calls without a position reset it.
+define void @main.nodebug(i8* %context) {
+  call void @runtime.lookupPanic(i8* undef)
+  unreachable
+}
+
+!llvm.module.flags = !{!0}
+!llvm.dbg.cu = !{!1}
+
+!0 = !{i32 2, !"Debug Info Version", i32 3}
+!1 = distinct !DICompileUnit(language: DW_LANG_Go, file: !2, producer: "TinyGo", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug)
+!2 = !DIFile(filename: "contract.go", directory: "/src/hello")
+!3 = distinct !DISubprogram(name: "main.check", scope: !2, file: !2, line: 10, type: !4, scopeLine: 10, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !1)
+!4 = !DISubroutineType(types: !5)
+!5 = !{}
+!6 = !DILocation(line: 11, column: 8, scope: !3)
+!7 = !DILocation(line: 13, column: 9, scope: !3)
+!8 = !DILocation(line: 12, column: 9, scope: !3)
@@ -0,0 +1,22 @@
+target datalayout = "e-m:e-p:32:32-i64:64-n32:64-S128"
+target triple = "wasm32-unknown-wasi"
+
+declare void @runtime._panic(i32, i8*, i8*)
+
+declare i1 @runtime.isUnwinding(i8*)
+
+declare void @runtime.setupDeferFrame(i8*, i8*, i8*)
+
+; Without defer frames, runtime._panic aborts, so the check is removed.
+define i32 @fail(i8* %context) {
+entry:
+  call void @runtime._panic(i32 0, i8* null, i8* undef)
+  %0 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %0, label %unwind, label %unwind.next
+
+unwind.next:
+  unreachable
+
+unwind:
+  ret i32 0
+}
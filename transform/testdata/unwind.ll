@@ -0,0 +1,127 @@
+target datalayout = "e-m:e-p:32:32-i64:64-n32:64-S128"
+target triple = "wasm32-unknown-wasi"
+
+%runtime.deferFrame = type { %runtime.deferFrame*, i1, %runtime._interface }
+%runtime._interface = type { i32, i8* }
+
+declare void @runtime._panic(i32, i8*, i8*)
+
+declare i1 @runtime.isUnwinding(i8*)
+
+declare void @runtime.stopUnwinding(i8*)
+
+declare void @runtime.setupDeferFrame(%runtime.deferFrame*, i8*, i8*)
+
+declare void @runtime.destroyDeferFrame(%runtime.deferFrame*, i8*)
+
+declare void @printui(i64)
+
+define i32 @add(i32 %a, i32 %b, i8* %context) {
+  %result = add i32 %a, %b
+  ret i32 %result
+}
+
+; The check after the panic is kept.
+define i32 @fail(i8* %context) {
+entry:
+  call void @runtime._panic(i32 0, i8* null, i8* undef)
+  %0 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %0, label %unwind, label %unwind.next
+
+unwind.next:
+  unreachable
+
+unwind:
+  ret i32 0
+}
+
+; The checks after add and printui are removed, the checks after fail and the
+; indirect call are kept.
+define i32 @caller(i32 ()* %fn, i8* %context) {
+entry:
+  %x = call i32 @add(i32 1, i32 2, i8* undef)
+  %0 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %0, label %unwind, label %unwind.next
+
+unwind.next:
+  call void @printui(i64 3)
+  %1 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %1, label %unwind, label %unwind.next1
+
+unwind.next1:
+  %y = call i32 @fail(i8* undef)
+  %2 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %2, label %unwind, label %unwind.next2
+
+unwind.next2:
+  %z = call i32 %fn()
+  %3 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %3, label %unwind, label %unwind.next3
+
+unwind.next3:
+  %sum = add i32 %y, %z
+  ret i32 %sum
+
+unwind:
+  ret i32 0
+}
+
+; A function with a deferred call continues at the landing pad.
+define void @deferring(i8* %context) {
+entry:
+  %deferframe.buf = alloca %runtime.deferFrame, align 8
+  call void @runtime.setupDeferFrame(%runtime.deferFrame* %deferframe.buf, i8* undef, i8* undef)
+  %0 = call i32 @caller(i32 ()* null, i8* undef)
+  %1 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %1, label %lpad, label %unwind.next
+
+unwind.next:
+  call void @runtime.destroyDeferFrame(%runtime.deferFrame* %deferframe.buf, i8* undef)
+  ret void
+
+lpad:
+  call void @runtime.stopUnwinding(i8* undef)
+  call void @printui(i64 1)
+  %2 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %2, label %lpad, label %unwind.next
+
+}
+
+; A panic in a deferred closure continues at the landing pad, so that the
+; remaining deferred calls run. The check after the closure is kept.
+define internal void @"deferringClosure$1"(i8* %context) {
+entry:
+  %0 = call i32 @fail(i8* undef)
+  %1 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %1, label %unwind, label %unwind.next
+
+unwind.next:
+  ret void
+
+unwind:
+  ret void
+}
+
+define void @deferringClosure(i8* %context) {
+entry:
+  %deferframe.buf = alloca %runtime.deferFrame, align 8
+  call void @runtime.setupDeferFrame(%runtime.deferFrame* %deferframe.buf, i8* undef, i8* undef)
+  %0 = call i32 @fail(i8* undef)
+  %1 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %1, label %lpad, label %unwind.next
+
+unwind.next:
+  call void @runtime.destroyDeferFrame(%runtime.deferFrame* %deferframe.buf, i8* undef)
+  ret void
+
+lpad:
+  call void @runtime.stopUnwinding(i8* undef)
+  call void @"deferringClosure$1"(i8* undef)
+  %2 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %2, label %lpad, label %rundefers.next
+
+rundefers.next:
+  call void @printui(i64 2)
+  %3 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %3, label %lpad, label %unwind.next
+}
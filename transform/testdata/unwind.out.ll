@@ -0,0 +1,116 @@
+target datalayout = "e-m:e-p:32:32-i64:64-n32:64-S128"
+target triple = "wasm32-unknown-wasi"
+
+%runtime.deferFrame = type { %runtime.deferFrame*, i1, %runtime._interface }
+%runtime._interface = type { i32, i8* }
+
+declare void @runtime._panic(i32, i8*, i8*)
+
+declare i1 @runtime.isUnwinding(i8*)
+
+declare void @runtime.stopUnwinding(i8*)
+
+declare void @runtime.setupDeferFrame(%runtime.deferFrame*, i8*, i8*)
+
+declare void @runtime.destroyDeferFrame(%runtime.deferFrame*, i8*)
+
+declare void @printui(i64)
+
+define i32 @add(i32 %a, i32 %b, i8* %context) {
+  %result = add i32 %a, %b
+  ret i32 %result
+}
+
+define i32 @fail(i8* %context) {
+entry:
+  call void @runtime._panic(i32 0, i8* null, i8* undef)
+  %0 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %0, label %unwind, label %unwind.next
+
+unwind.next:                                      ; preds = %entry
+  unreachable
+
+unwind:                                           ; preds = %entry
+  ret i32 0
+}
+
+define i32 @caller(i32 ()* %fn, i8* %context) {
+entry:
+  %x = call i32 @add(i32 1, i32 2, i8* undef)
+  br i1 false, label %unwind, label %unwind.next
+
+unwind.next:                                      ; preds = %entry
+  call void @printui(i64 3)
+  br i1 false, label %unwind, label %unwind.next1
+
+unwind.next1:                                     ; preds = %unwind.next
+  %y = call i32 @fail(i8* undef)
+  %0 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %0, label %unwind, label %unwind.next2
+
+unwind.next2:                                     ; preds = %unwind.next1
+  %z = call i32 %fn()
+  %1 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %1, label %unwind, label %unwind.next3
+
+unwind.next3:                                     ; preds = %unwind.next2
+  %sum = add i32 %y, %z
+  ret i32 %sum
+
+unwind:                                           ; preds = %unwind.next2, %unwind.next1, %unwind.next, %entry
+  ret i32 0
+}
+
+define void @deferring(i8* %context) {
+entry:
+  %deferframe.buf = alloca %runtime.deferFrame, align 8
+  call void @runtime.setupDeferFrame(%runtime.deferFrame* %deferframe.buf, i8* undef, i8* undef)
+  %0 = call i32 @caller(i32 ()* null, i8* undef)
+  %1 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %1, label %lpad, label %unwind.next
+
+unwind.next:                                      ; preds = %lpad, %entry
+  call void @runtime.destroyDeferFrame(%runtime.deferFrame* %deferframe.buf, i8* undef)
+  ret void
+
+lpad:                                             ; preds = %lpad, %entry
+  call void @runtime.stopUnwinding(i8* undef)
+  call void @printui(i64 1)
+  br i1 false, label %lpad, label %unwind.next
+}
+
+define internal void @"deferringClosure$1"(i8* %context) {
+entry:
+  %0 = call i32 @fail(i8* undef)
+  %1 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %1, label %unwind, label %unwind.next
+
+unwind.next:                                      ; preds = %entry
+  ret void
+
+unwind:                                           ; preds = %entry
+  ret void
+}
+
+define void @deferringClosure(i8* %context) {
+entry:
+  %deferframe.buf = alloca %runtime.deferFrame, align 8
+  call void @runtime.setupDeferFrame(%runtime.deferFrame* %deferframe.buf, i8* undef, i8* undef)
+  %0 = call i32 @fail(i8* undef)
+  %1 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %1, label %lpad, label %unwind.next
+
+unwind.next:                                      ; preds = %rundefers.next, %entry
+  call void @runtime.destroyDeferFrame(%runtime.deferFrame* %deferframe.buf, i8* undef)
+  ret void
+
+lpad:                                             ; preds = %rundefers.next, %lpad, %entry
+  call void @runtime.stopUnwinding(i8* undef)
+  call void @"deferringClosure$1"(i8* undef)
+  %2 = call i1 @runtime.isUnwinding(i8* undef)
+  br i1 %2, label %lpad, label %rundefers.next
+
+rundefers.next:                                   ; preds = %lpad
+  call void @printui(i64 2)
+  br i1 false, label %lpad, label %unwind.next
+}
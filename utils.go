@@ -169,6 +169,14 @@ var gUnpackMap = map[string]string{
 	"chain.ExtendedAsset":      "dec.Unpack(&%s)",
 }
 
+// gZeroCopyUnpackMap unpacks the strings and byte slices of structs that alias
+// the data they are unpacked from, with the types of cZeroCopyCode.
+var gZeroCopyUnpackMap = map[string]string{
+	"bytes":  "dec.UnpackI((*aliasBytes)(&%s))",
+	"string": "dec.UnpackI((*aliasString)(&%s))",
+	"[]byte": "dec.UnpackI((*aliasBytes)(&%s))",
+}
+
 func PackBasicType(member string, tp string) (string, bool) {
 	if packer, ok := gPackerMap[tp]; ok {
 		return fmt.Sprintf(packer, member), true
@@ -422,3 +430,22 @@ func indexTypeToSecondaryTableName(indexType string) string {
 	}
 	return ""
 }
+
+// indexTypeToAbiKeyType returns the ABI key type of a secondary index, as
+// used by the --key-type option of get_table_rows.
+func indexTypeToAbiKeyType(indexType string) string {
+	switch indexType {
+	case "IDX64":
+		return "i64"
+	case "IDX128":
+		return "i128"
+	case "IDX256":
+		return "sha256"
+	case "IDXFloat64":
+		return "float64"
+	case "IDXFloat128":
+		return "float128"
+	default:
+		panic(fmt.Sprintf("unknown secondary index type: %s", indexType))
+	}
+}
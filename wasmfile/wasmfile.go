@@ -0,0 +1,626 @@
+// Package wasmfile reads WebAssembly binaries as they are written by the
+// linker, so that they can be checked and rewritten after linking. Only the
+// MVP is supported, which is what the eosio VM executes; other instructions
+// are recognized only far enough to report them.
+package wasmfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-interpreter/wagon/wasm/leb128"
+)
+
+// Section ids of the wasm binary format.
+const (
+	SectionCustom    = 0
+	SectionType      = 1
+	SectionImport    = 2
+	SectionFunction  = 3
+	SectionTable     = 4
+	SectionMemory    = 5
+	SectionGlobal    = 6
+	SectionExport    = 7
+	SectionStart     = 8
+	SectionElement   = 9
+	SectionCode      = 10
+	SectionData      = 11
+	SectionDataCount = 12
+)
+
+var sectionNames = [...]string{"custom", "type", "import", "function", "table", "memory", "global", "export", "start", "element", "code", "data", "data count"}
+
+// External kinds of imports and exports.
+const (
+	ExternalFunction = 0
+	ExternalTable    = 1
+	ExternalMemory   = 2
+	ExternalGlobal   = 3
+)
+
+var externalNames = [...]string{"function", "table", "memory", "global"}
+
+// Value types.
+const (
+	I32 = 0x7f
+	I64 = 0x7e
+	F32 = 0x7d
+	F64 = 0x7c
+)
+
+// ValueSize returns the size in bytes of a value of type t.
+func ValueSize(t byte) int {
+	if t == I64 || t == F64 {
+		return 8
+	}
+	return 4
+}
+
+// Section is a section of the file.
+type Section struct {
+	ID   byte
+	Name string // name of a custom section
+	// Start and End are the offsets of the content of the section in the
+	// file.
+	Start, End int
+}
+
+// FuncType is a function signature.
+type FuncType struct {
+	Params  []byte
+	Results []byte
+}
+
+// Limits are the limits of a memory or table.
+type Limits struct {
+	Initial uint32
+	Maximum uint32
+	HasMax  bool
+}
+
+// InitExpr is a constant expression with a single instruction.
+type InitExpr struct {
+	Op    byte
+	Value int64 // the constant, or the index of global.get
+}
+
+// Import is an imported function, table, memory or global.
+type Import struct {
+	Module, Name string
+	Kind         byte
+	Type         uint32 // type index of a function
+	GlobalType   byte
+	Mutable      bool
+	Limits       Limits
+}
+
+// Global is a global defined by the module.
+type Global struct {
+	Type    byte
+	Mutable bool
+	Init    InitExpr
+}
+
+// Export is an exported function, table, memory or global.
+type Export struct {
+	Name  string
+	Kind  byte
+	Index uint32
+}
+
+// Element is an element segment, which initializes a part of the table.
+type Element struct {
+	Offset    InitExpr
+	Functions []uint32
+}
+
+// Local declares count locals of a type.
+type Local struct {
+	Count uint32
+	Type  byte
+}
+
+// Code is the body of a function defined by the module.
+type Code struct {
+	Locals []Local
+	// Body holds the instructions of the function. Start and End are the
+	// offsets of the whole function in the file, including the size and
+	// the locals.
+	Body       []byte
+	Start, End int
+}
+
+// Data is a data segment, which initializes a part of the memory.
+type Data struct {
+	Flags  uint32
+	Offset InitExpr
+	Data   []byte
+}
+
+// Module is a wasm module as it is written in a file.
+type Module struct {
+	Sections []Section
+	Types    []FuncType
+	Imports  []Import
+	Funcs    []uint32 // type indices of the functions defined by the module
+	Tables   []Limits
+	Memories []Limits
+	Globals  []Global
+	Exports  []Export
+	Start    *uint32
+	Elements []Element
+	Codes    []Code
+	Data     []Data
+	// Names holds the function names of the name section by function index.
+	Names map[uint32]string
+
+	NumImportedFuncs   int
+	NumImportedGlobals int
+}
+
+// reader reads the values of the wasm binary format. The first error is
+// kept, later reads return zero values.
+type reader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func newReader(data []byte) *reader {
+	return &reader{r: bytes.NewReader(data)}
+}
+
+func (r *reader) pos() int {
+	return int(r.r.Size()) - r.r.Len()
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = err
+	}
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.r.ReadByte()
+	r.fail(err)
+	return b
+}
+
+func (r *reader) u32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := leb128.ReadVarUint32(r.r)
+	r.fail(err)
+	return v
+}
+
+func (r *reader) i32() int32 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := leb128.ReadVarint32(r.r)
+	r.fail(err)
+	return v
+}
+
+func (r *reader) i64() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := leb128.ReadVarint64(r.r)
+	r.fail(err)
+	return v
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > r.r.Len() {
+		r.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := make([]byte, n)
+	r.r.Read(b)
+	return b
+}
+
+func (r *reader) name() string {
+	return string(r.bytes(int(r.u32())))
+}
+
+// count reads the length of a vector. It fails if the vector can't fit in
+// the rest of the data, so that broken files don't allocate huge slices.
+func (r *reader) count() int {
+	n := r.u32()
+	if int64(n) > int64(r.r.Len()) {
+		r.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *reader) limits() Limits {
+	var l Limits
+	flags := r.u32()
+	l.Initial = r.u32()
+	if flags&1 != 0 {
+		l.HasMax = true
+		l.Maximum = r.u32()
+	}
+	return l
+}
+
+func (r *reader) initExpr() InitExpr {
+	e := InitExpr{Op: r.byte()}
+	switch e.Op {
+	case 0x41: // i32.const
+		e.Value = int64(r.i32())
+	case 0x42: // i64.const
+		e.Value = r.i64()
+	case 0x43: // f32.const
+		r.bytes(4)
+	case 0x44: // f64.const
+		r.bytes(8)
+	case 0x23: // global.get
+		e.Value = int64(r.u32())
+	default:
+		r.fail(fmt.Errorf("unsupported instruction 0x%02x in constant expression", e.Op))
+	}
+	if r.byte() != 0x0b {
+		r.fail(errors.New("constant expression with more than one instruction"))
+	}
+	return e
+}
+
+// Parse parses the wasm module in data.
+func Parse(data []byte) (*Module, error) {
+	if len(data) < 8 || !bytes.Equal(data[:4], []byte("\x00asm")) {
+		return nil, errors.New("not a wasm file")
+	}
+	if !bytes.Equal(data[4:8], []byte("\x01\x00\x00\x00")) {
+		return nil, errors.New("bad wasm version")
+	}
+	m := &Module{Names: make(map[uint32]string)}
+	r := newReader(data)
+	r.bytes(8)
+	for r.err == nil && r.r.Len() != 0 {
+		id := r.byte()
+		size := r.u32()
+		start := r.pos()
+		if r.err == nil && int64(size) > int64(r.r.Len()) {
+			return nil, fmt.Errorf("section %d at offset %d exceeds the end of the file", id, start)
+		}
+		section := Section{ID: id, Start: start, End: start + int(size)}
+		content := newReader(data[:section.End])
+		content.r.Seek(int64(start), io.SeekStart)
+		if err := m.parseSection(&section, content); err != nil {
+			return nil, fmt.Errorf("%s section: %w", SectionName(id), err)
+		}
+		m.Sections = append(m.Sections, section)
+		r.r.Seek(int64(section.End), io.SeekStart)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(m.Funcs) != len(m.Codes) {
+		return nil, fmt.Errorf("%d functions are declared, but %d are defined", len(m.Funcs), len(m.Codes))
+	}
+	return m, nil
+}
+
+func (m *Module) parseSection(section *Section, r *reader) error {
+	switch section.ID {
+	case SectionCustom:
+		section.Name = r.name()
+		if section.Name == "name" {
+			// A broken name section only loses the names.
+			m.parseNames(r)
+			return nil
+		}
+		return r.err
+	case SectionType:
+		for i, n := 0, r.count(); i < n; i++ {
+			if r.byte() != 0x60 {
+				r.fail(errors.New("function type expected"))
+			}
+			var t FuncType
+			t.Params = r.bytes(r.count())
+			t.Results = r.bytes(r.count())
+			m.Types = append(m.Types, t)
+		}
+	case SectionImport:
+		for i, n := 0, r.count(); i < n; i++ {
+			imp := Import{Module: r.name(), Name: r.name(), Kind: r.byte()}
+			switch imp.Kind {
+			case ExternalFunction:
+				imp.Type = r.u32()
+				m.NumImportedFuncs++
+			case ExternalTable:
+				r.byte() // element type
+				imp.Limits = r.limits()
+			case ExternalMemory:
+				imp.Limits = r.limits()
+			case ExternalGlobal:
+				imp.GlobalType = r.byte()
+				imp.Mutable = r.byte() != 0
+				m.NumImportedGlobals++
+			default:
+				r.fail(fmt.Errorf("unknown import kind %d", imp.Kind))
+			}
+			m.Imports = append(m.Imports, imp)
+		}
+	case SectionFunction:
+		for i, n := 0, r.count(); i < n; i++ {
+			m.Funcs = append(m.Funcs, r.u32())
+		}
+	case SectionTable:
+		for i, n := 0, r.count(); i < n; i++ {
+			r.byte() // element type
+			m.Tables = append(m.Tables, r.limits())
+		}
+	case SectionMemory:
+		for i, n := 0, r.count(); i < n; i++ {
+			m.Memories = append(m.Memories, r.limits())
+		}
+	case SectionGlobal:
+		for i, n := 0, r.count(); i < n; i++ {
+			g := Global{Type: r.byte(), Mutable: r.byte() != 0}
+			g.Init = r.initExpr()
+			m.Globals = append(m.Globals, g)
+		}
+	case SectionExport:
+		for i, n := 0, r.count(); i < n; i++ {
+			m.Exports = append(m.Exports, Export{Name: r.name(), Kind: r.byte(), Index: r.u32()})
+		}
+	case SectionStart:
+		start := r.u32()
+		m.Start = &start
+	case SectionElement:
+		for i, n := 0, r.count(); i < n; i++ {
+			if flags := r.u32(); flags != 0 {
+				return fmt.Errorf("element segment %d has flags %d, which need the bulk memory or reference types proposal", i, flags)
+			}
+			e := Element{Offset: r.initExpr()}
+			for j, n := 0, r.count(); j < n; j++ {
+				e.Functions = append(e.Functions, r.u32())
+			}
+			m.Elements = append(m.Elements, e)
+		}
+	case SectionCode:
+		for i, n := 0, r.count(); i < n; i++ {
+			var c Code
+			c.Start = r.pos()
+			size := r.u32()
+			end := r.pos() + int(size)
+			for j, n := 0, r.count(); j < n; j++ {
+				c.Locals = append(c.Locals, Local{Count: r.u32(), Type: r.byte()})
+			}
+			c.Body = r.bytes(end - r.pos())
+			c.End = end
+			m.Codes = append(m.Codes, c)
+		}
+	case SectionData:
+		for i, n := 0, r.count(); i < n; i++ {
+			d := Data{Flags: r.u32()}
+			switch d.Flags {
+			case 0:
+				d.Offset = r.initExpr()
+			case 1:
+			case 2:
+				r.u32() // memory index
+				d.Offset = r.initExpr()
+			default:
+				r.fail(fmt.Errorf("unknown data segment flags %d", d.Flags))
+			}
+			d.Data = r.bytes(r.count())
+			m.Data = append(m.Data, d)
+		}
+	case SectionDataCount:
+		r.u32()
+	default:
+		return fmt.Errorf("unknown section id %d", section.ID)
+	}
+	if r.err == nil && r.r.Len() != 0 {
+		r.fail(errors.New("unexpected data at the end of the section"))
+	}
+	return r.err
+}
+
+// parseNames reads the function names of the name section.
+func (m *Module) parseNames(r *reader) {
+	for r.err == nil && r.r.Len() != 0 {
+		id := r.byte()
+		size := r.u32()
+		end := r.pos() + int(size)
+		if id == 1 {
+			for i, n := 0, r.count(); i < n && r.err == nil; i++ {
+				index := r.u32()
+				m.Names[index] = r.name()
+			}
+		}
+		r.r.Seek(int64(end), io.SeekStart)
+	}
+}
+
+// SectionName returns the name of the section with id.
+func SectionName(id byte) string {
+	if int(id) < len(sectionNames) {
+		return sectionNames[id]
+	}
+	return fmt.Sprintf("section %d", id)
+}
+
+// KindName returns the name of an import or export kind.
+func KindName(kind byte) string {
+	if int(kind) < len(externalNames) {
+		return externalNames[kind]
+	}
+	return fmt.Sprintf("kind %d", kind)
+}
+
+// FuncImport returns the import of the function with index in the function
+// index space, or nil if the function is defined by the module.
+func (m *Module) FuncImport(index uint32) *Import {
+	n := uint32(0)
+	for i := range m.Imports {
+		if m.Imports[i].Kind != ExternalFunction {
+			continue
+		}
+		if n == index {
+			return &m.Imports[i]
+		}
+		n++
+	}
+	return nil
+}
+
+// FuncName returns the name of the function with index in the function
+// index space, which starts with the imported functions.
+func (m *Module) FuncName(index uint32) string {
+	if imp := m.FuncImport(index); imp != nil {
+		return imp.Module + "." + imp.Name
+	}
+	if name, ok := m.Names[index]; ok {
+		return name
+	}
+	return fmt.Sprintf("function[%d]", index)
+}
+
+// FuncType returns the type of the function with index in the function
+// index space.
+func (m *Module) FuncType(index uint32) (FuncType, bool) {
+	var typ uint32
+	if imp := m.FuncImport(index); imp != nil {
+		typ = imp.Type
+	} else if i := int(index) - m.NumImportedFuncs; i < len(m.Funcs) {
+		typ = m.Funcs[i]
+	} else {
+		return FuncType{}, false
+	}
+	if int(typ) >= len(m.Types) {
+		return FuncType{}, false
+	}
+	return m.Types[typ], true
+}
+
+// Instruction is an instruction of a function body.
+type Instruction struct {
+	Op byte
+	// Sub is the opcode of instructions with a prefix byte like 0xfc.
+	Sub uint32
+	// Index is the immediate of instructions that refer to a function,
+	// local, global, type or branch depth.
+	Index uint32
+	// BlockType is the type of block, loop and if.
+	BlockType int64
+	// Reserved is the reserved byte of call_indirect, memory.size and
+	// memory.grow, which is 0 in the MVP.
+	Reserved byte
+	// Value is the constant of i32.const and i64.const.
+	Value int64
+	// Start and End are the offsets of the instruction in the body.
+	Start, End int
+}
+
+// IsMVPOpcode reports whether op is an instruction of the MVP.
+func IsMVPOpcode(op byte) bool {
+	switch {
+	case op <= 0x05, op >= 0x0b && op <= 0x11, op == 0x1a, op == 0x1b:
+		return true
+	case op >= 0x20 && op <= 0x24, op >= 0x28 && op <= 0xbf:
+		return true
+	}
+	return false
+}
+
+// InstructionReader reads the instructions of a function body.
+type InstructionReader struct {
+	r *reader
+}
+
+// NewInstructionReader returns a reader for the instructions in body.
+func NewInstructionReader(body []byte) *InstructionReader {
+	return &InstructionReader{newReader(body)}
+}
+
+// Done reports whether all instructions were read or reading failed.
+func (ir *InstructionReader) Done() bool {
+	return ir.r.err != nil || ir.r.r.Len() == 0
+}
+
+// Err returns the error that stopped reading, if any.
+func (ir *InstructionReader) Err() error {
+	return ir.r.err
+}
+
+// Next reads the next instruction. The immediates of instructions outside the
+// MVP are only read for the prefixed instructions of the bulk memory and
+// non-trapping float-to-int proposals; Next fails on other unknown opcodes.
+func (ir *InstructionReader) Next() Instruction {
+	r := ir.r
+	in := Instruction{Start: r.pos(), Op: r.byte()}
+	switch op := in.Op; {
+	case op == 0x02 || op == 0x03 || op == 0x04: // block, loop, if
+		in.BlockType = r.i64()
+	case op == 0x0c || op == 0x0d: // br, br_if
+		in.Index = r.u32()
+	case op == 0x0e: // br_table
+		for i, n := 0, r.count(); i < n; i++ {
+			r.u32()
+		}
+		in.Index = r.u32()
+	case op == 0x10: // call
+		in.Index = r.u32()
+	case op == 0x11: // call_indirect
+		in.Index = r.u32()
+		in.Reserved = r.byte()
+	case op >= 0x20 && op <= 0x24: // local.*, global.*
+		in.Index = r.u32()
+	case op >= 0x28 && op <= 0x3e: // loads and stores
+		r.u32() // alignment
+		r.u32() // offset
+	case op == 0x3f || op == 0x40: // memory.size, memory.grow
+		in.Reserved = r.byte()
+	case op == 0x41:
+		in.Value = int64(r.i32())
+	case op == 0x42:
+		in.Value = r.i64()
+	case op == 0x43:
+		r.bytes(4)
+	case op == 0x44:
+		r.bytes(8)
+	case op == 0xfc:
+		in.Sub = r.u32()
+		switch in.Sub {
+		case 8: // memory.Init
+			in.Index = r.u32()
+			r.byte()
+		case 9: // data.drop
+			in.Index = r.u32()
+		case 10: // memory.copy
+			r.byte()
+			r.byte()
+		case 11: // memory.fill
+			r.byte()
+		case 12, 14: // table.Init, table.copy
+			r.u32()
+			r.u32()
+		case 13, 15, 16, 17: // elem.drop, table.grow, table.size, table.fill
+			r.u32()
+		}
+	case IsMVPOpcode(op) || op >= 0xc0 && op <= 0xc4: // no immediates
+	default:
+		r.fail(fmt.Errorf("unknown instruction 0x%02x", op))
+	}
+	in.End = r.pos()
+	return in
+}
@@ -0,0 +1,88 @@
+// Package wasmtest assembles small WebAssembly modules byte by byte, for the
+// tests of the packages that read or run linked modules without a compiler
+// for the target.
+//
+//	module := wasmtest.Module(
+//		wasmtest.Section(wasmfile.SectionType, wasmtest.Vec([]byte{0x60, 0, 0})),
+//		wasmtest.Section(wasmfile.SectionFunction, wasmtest.Vec([]byte{0})),
+//		wasmtest.Section(wasmfile.SectionCode, wasmtest.Vec(wasmtest.Function(nil, 0x0b))),
+//	)
+package wasmtest
+
+import (
+	"github.com/go-interpreter/wagon/wasm/leb128"
+)
+
+// Module returns a module with the given sections.
+func Module(sections ...[]byte) []byte {
+	module := []byte("\x00asm\x01\x00\x00\x00")
+	for _, section := range sections {
+		module = append(module, section...)
+	}
+	return module
+}
+
+// Section returns the section with the given id and content.
+func Section(id byte, content []byte) []byte {
+	section := leb128.AppendUleb128([]byte{id}, uint64(len(content)))
+	return append(section, content...)
+}
+
+// Vec returns a vector of the items, which are already encoded.
+func Vec(items ...[]byte) []byte {
+	b := leb128.AppendUleb128(nil, uint64(len(items)))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+// Name returns the encoding of a name or a string.
+func Name(s string) []byte {
+	return append(leb128.AppendUleb128(nil, uint64(len(s))), s...)
+}
+
+// Uleb returns the unsigned LEB128 encoding of v.
+func Uleb(v uint64) []byte {
+	return leb128.AppendUleb128(nil, v)
+}
+
+// Sleb returns the signed LEB128 encoding of v.
+func Sleb(v int64) []byte {
+	return leb128.AppendSleb128(nil, v)
+}
+
+// FuncType returns a function signature of the type section.
+func FuncType(params []byte, results []byte) []byte {
+	b := append([]byte{0x60}, Uleb(uint64(len(params)))...)
+	b = append(b, params...)
+	b = append(b, Uleb(uint64(len(results)))...)
+	return append(b, results...)
+}
+
+// ImportFunc returns an import of a function with the signature typ.
+func ImportFunc(module, field string, typ uint32) []byte {
+	b := append(Name(module), Name(field)...)
+	b = append(b, 0) // function
+	return append(b, Uleb(uint64(typ))...)
+}
+
+// Function returns an entry of the code section. locals is the encoded vector
+// of local declarations and body the instructions up to the final end.
+func Function(locals []byte, body ...byte) []byte {
+	fn := append(append([]byte{}, locals...), body...)
+	return append(Uleb(uint64(len(fn))), fn...)
+}
+
+// Names returns the content of a name section with the function names, for
+// the functions from index 0 on.
+func Names(names ...string) []byte {
+	var entries [][]byte
+	for i, name := range names {
+		entries = append(entries, append(Uleb(uint64(i)), Name(name)...))
+	}
+	subsection := Vec(entries...)
+	content := append(Name("name"), 1)
+	content = append(content, Uleb(uint64(len(subsection)))...)
+	return append(content, subsection...)
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/go-interpreter/wagon/wasm/leb128"
+	"github.com/tinygo-org/tinygo/wasmfile"
+)
+
+// The eosio chain charges RAM for every byte of the deployed code, so linked
+// contracts are shrunk by a post-link pass. It works on the wasm file itself,
+// without binaryen, and only does what is safe for any module written by the
+// linker:
+//
+//   - custom sections (names, debug information) are removed
+//   - data segments are trimmed and split at runs of zero bytes, as the memory
+//     is zero when the contract starts
+//   - functions with identical bodies are merged
+//   - trailing table entries are removed if their table index appears in no
+//     i32.const of the code or the globals and in no word of the data, as
+//     function pointers are only made from those
+//   - functions that can't be reached from the exports are removed, together
+//     with the table if no reachable function calls indirectly
+
+const (
+	// Largest data segment written for the eosio VM.
+	wasmMaxDataSegmentSize = 8191
+
+	// Runs of zero bytes in a data segment are only cut out if they are
+	// longer than the header of the new segment: the flags, the i32.const
+	// with an offset below 64KiB, the end and the size of at most 8191.
+	wasmMinZeroRun = (1 + 1 + 3 + 1 + 2) + 1
+)
+
+// wasmOptimizeStep is the result of a step of the post-link pass.
+type wasmOptimizeStep struct {
+	Name  string
+	Saved int
+}
+
+// wasmOptimizer holds the module while it is rewritten. Sections that aren't
+// changed are copied from the original file.
+type wasmOptimizer struct {
+	data   []byte
+	module *wasmfile.Module
+	// Functions that are replaced by an identical one, by index in the
+	// function index space.
+	replaced map[uint32]uint32
+	// live marks the defined functions that are kept, by index in the
+	// function index space minus the imported functions.
+	live     []bool
+	elements []wasmfile.Element
+	segments []wasmfile.Data
+}
+
+// optimizeEosioWasm runs the post-link pass over the linked contract in data.
+// It returns the optimized module, the bytes saved by each step and the
+// function names of the removed name section by function index in the
+// optimized module. A function that identical functions were merged into has
+// their names after its own.
+func optimizeEosioWasm(data []byte) ([]byte, []wasmOptimizeStep, map[uint32][]string, error) {
+	m, err := wasmfile.Parse(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	o := &wasmOptimizer{
+		data:     data,
+		module:   m,
+		replaced: make(map[uint32]uint32),
+		live:     make([]bool, len(m.Codes)),
+		elements: m.Elements,
+		segments: m.Data,
+	}
+	for i := range o.live {
+		o.live[i] = true
+	}
+
+	var steps []wasmOptimizeStep
+	size := len(data)
+	for _, step := range []struct {
+		name string
+		run  func() error
+	}{
+		{"custom sections", func() error { return nil }}, // left out by encode
+		{"data segments", o.splitDataSegments},
+		{"duplicate functions", o.mergeFunctions},
+		{"unused table entries", o.trimElements},
+		{"unreferenced functions", o.removeFunctions},
+	} {
+		if err := step.run(); err != nil {
+			return nil, nil, nil, err
+		}
+		result, err := o.encode()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		steps = append(steps, wasmOptimizeStep{step.name, size - len(result)})
+		size = len(result)
+		data = result
+	}
+
+	names := make(map[uint32][]string)
+	newIndex, _ := o.indices()
+	for index := uint32(0); index < uint32(m.NumImportedFuncs+len(m.Codes)); index++ {
+		name, ok := m.Names[index]
+		if !ok {
+			continue
+		}
+		if i := int(o.resolve(index)) - m.NumImportedFuncs; i >= 0 && !o.live[i] {
+			// The function, or the one it was merged into, was removed.
+			continue
+		}
+		names[newIndex(index)] = append(names[newIndex(index)], name)
+	}
+	return data, steps, names, nil
+}
+
+// optimizeEosioWasmFile optimizes the wasm file in place and returns the
+// function names of the optimized module. The bytes saved by each step are
+// written to report, if it isn't nil.
+func optimizeEosioWasmFile(file string, report io.Writer) (map[uint32][]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	result, steps, names, err := optimizeEosioWasm(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not optimize %s: %w", file, err)
+	}
+	if report != nil {
+		fmt.Fprintf(report, "  saved | post-link step\n")
+		fmt.Fprintf(report, "------- | ----------------------\n")
+		for _, step := range steps {
+			fmt.Fprintf(report, "%7d | %s\n", step.Saved, step.Name)
+		}
+		fmt.Fprintf(report, "------- | ----------------------\n")
+		fmt.Fprintf(report, "%7d | total (%d to %d bytes)\n", len(data)-len(result), len(data), len(result))
+	}
+	return names, ioutil.WriteFile(file, result, 0666)
+}
+
+// splitDataSegments trims the zero bytes at the start and the end of the data
+// segments and splits them at long runs of zero bytes.
+func (o *wasmOptimizer) splitDataSegments() error {
+	var segments []wasmfile.Data
+	for _, d := range o.segments {
+		if d.Flags != 0 || d.Offset.Op != 0x41 {
+			// Passive segments and segments at a computed offset are kept.
+			segments = append(segments, d)
+			continue
+		}
+		start := 0
+		for start < len(d.Data) {
+			if d.Data[start] == 0 {
+				start++
+				continue
+			}
+			// Find the end of the data, which is the first long run of
+			// zero bytes or the end of the segment.
+			end, zeros := start, 0
+			for i := start; i < len(d.Data) && zeros < wasmMinZeroRun && i-start < wasmMaxDataSegmentSize; i++ {
+				if d.Data[i] == 0 {
+					zeros++
+				} else {
+					end, zeros = i+1, 0
+				}
+			}
+			segments = append(segments, wasmfile.Data{
+				Offset: wasmfile.InitExpr{Op: 0x41, Value: d.Offset.Value + int64(start)},
+				Data:   d.Data[start:end],
+			})
+			start = end
+		}
+	}
+	o.segments = segments
+	return nil
+}
+
+// resolve returns the function that replaces the function with index.
+func (o *wasmOptimizer) resolve(index uint32) uint32 {
+	for {
+		replacement, ok := o.replaced[index]
+		if !ok {
+			return index
+		}
+		index = replacement
+	}
+}
+
+// mergeFunctions replaces functions by an earlier function with the same
+// type, locals and body. As merging changes the calls in other functions,
+// this is repeated until no more functions are identical.
+func (o *wasmOptimizer) mergeFunctions() error {
+	m := o.module
+	for {
+		merged := false
+		seen := make(map[string]uint32)
+		for i, code := range m.Codes {
+			index := uint32(m.NumImportedFuncs + i)
+			if !o.live[i] {
+				continue
+			}
+			body, err := o.rewriteCalls(code.Body, o.resolve)
+			if err != nil {
+				return fmt.Errorf("%s: %w", m.FuncName(index), err)
+			}
+			var key bytes.Buffer
+			leb128.WriteVarUint32(&key, m.Funcs[i])
+			for _, local := range code.Locals {
+				leb128.WriteVarUint32(&key, local.Count)
+				key.WriteByte(local.Type)
+			}
+			key.Write(body)
+			if first, ok := seen[key.String()]; ok {
+				o.replaced[index] = first
+				o.live[i] = false
+				merged = true
+				continue
+			}
+			seen[key.String()] = index
+		}
+		if !merged {
+			return nil
+		}
+	}
+}
+
+// tableShared returns whether the table is imported or exported, so that
+// the host may call any of its entries.
+func (o *wasmOptimizer) tableShared() bool {
+	for _, imp := range o.module.Imports {
+		if imp.Kind == wasmfile.ExternalTable {
+			return true
+		}
+	}
+	for _, export := range o.module.Exports {
+		if export.Kind == wasmfile.ExternalTable {
+			return true
+		}
+	}
+	return false
+}
+
+// trimElements removes the entries at the end of the table that no function
+// pointer can refer to. A function pointer is the table index of the
+// function, which the linker writes as an i32.const into the code or a
+// global initializer, or as a word into the data. Entries above the largest
+// of those constants that is within the table are never called. Nothing is removed if the table is
+// shared with the host or filled at a computed offset.
+func (o *wasmOptimizer) trimElements() error {
+	m := o.module
+	if len(o.elements) == 0 || o.tableShared() {
+		return nil
+	}
+	for _, e := range o.elements {
+		if e.Offset.Op != 0x41 {
+			return nil
+		}
+	}
+
+	// used is one more than the largest table index that may be referred to.
+	// Constants beyond the entries can't be table indices.
+	var size, used uint64
+	for _, e := range o.elements {
+		if end := uint64(uint32(e.Offset.Value)) + uint64(len(e.Functions)); end > size {
+			size = end
+		}
+	}
+	use := func(value uint32) {
+		if uint64(value) < size && uint64(value) >= used {
+			used = uint64(value) + 1
+		}
+	}
+	for _, global := range m.Globals {
+		if global.Init.Op == 0x41 {
+			use(uint32(global.Init.Value))
+		}
+	}
+	for i, code := range m.Codes {
+		if !o.live[i] {
+			continue
+		}
+		ir := wasmfile.NewInstructionReader(code.Body)
+		for !ir.Done() {
+			if in := ir.Next(); in.Op == 0x41 {
+				use(uint32(in.Value))
+			}
+		}
+		if ir.Err() != nil {
+			return fmt.Errorf("%s: %w", m.FuncName(uint32(m.NumImportedFuncs+i)), ir.Err())
+		}
+	}
+	for _, d := range m.Data {
+		// The segments as written by the linker, as the split segments
+		// may end in the middle of a word. Function pointers are aligned
+		// in memory. In segments without a known address every offset is
+		// looked at.
+		start, step := 0, 1
+		if d.Flags == 0 && d.Offset.Op == 0x41 {
+			start, step = int(-d.Offset.Value&3), 4
+		}
+		for j := start; j+4 <= len(d.Data); j += step {
+			use(binary.LittleEndian.Uint32(d.Data[j:]))
+		}
+	}
+
+	var elements []wasmfile.Element
+	for _, e := range o.elements {
+		offset := uint64(uint32(e.Offset.Value))
+		n := len(e.Functions)
+		for n > 0 && offset+uint64(n-1) >= used {
+			n--
+		}
+		if n > 0 {
+			elements = append(elements, wasmfile.Element{Offset: e.Offset, Functions: e.Functions[:n]})
+		}
+	}
+	o.elements = elements
+	return nil
+}
+
+// removeFunctions removes the functions that can't be reached from the
+// exports, the start function or the table. The table itself is removed if
+// no reachable function calls indirectly and the table isn't shared with the
+// host. Otherwise the functions in the remaining entries of the table are
+// kept.
+func (o *wasmOptimizer) removeFunctions() error {
+	m := o.module
+	tableShared := o.tableShared()
+
+	reachable := make([]bool, len(m.Codes))
+	var worklist []uint32
+	mark := func(index uint32) {
+		index = o.resolve(index)
+		i := int(index) - m.NumImportedFuncs
+		if i >= 0 && !reachable[i] {
+			reachable[i] = true
+			worklist = append(worklist, index)
+		}
+	}
+	for _, export := range m.Exports {
+		if export.Kind == wasmfile.ExternalFunction {
+			mark(export.Index)
+		}
+	}
+	if m.Start != nil {
+		mark(*m.Start)
+	}
+	callsIndirect := false
+	markTable := func() {
+		for _, e := range o.elements {
+			for _, f := range e.Functions {
+				mark(f)
+			}
+		}
+	}
+	if tableShared {
+		markTable()
+	}
+	for len(worklist) != 0 {
+		index := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		ir := wasmfile.NewInstructionReader(m.Codes[int(index)-m.NumImportedFuncs].Body)
+		for !ir.Done() {
+			in := ir.Next()
+			switch in.Op {
+			case 0x10: // call
+				mark(in.Index)
+			case 0x11: // call_indirect
+				if !callsIndirect && !tableShared {
+					callsIndirect = true
+					markTable()
+				}
+			}
+		}
+		if ir.Err() != nil {
+			return fmt.Errorf("%s: %w", m.FuncName(index), ir.Err())
+		}
+	}
+	if !callsIndirect && !tableShared {
+		o.elements = nil
+	}
+	for i := range o.live {
+		o.live[i] = o.live[i] && reachable[i]
+	}
+	return nil
+}
+
+// rewriteCalls returns body with the function index of each call mapped by
+// index.
+func (o *wasmOptimizer) rewriteCalls(body []byte, index func(uint32) uint32) ([]byte, error) {
+	var b bytes.Buffer
+	b.Grow(len(body))
+	ir := wasmfile.NewInstructionReader(body)
+	for !ir.Done() {
+		in := ir.Next()
+		if ir.Err() != nil {
+			break
+		}
+		if in.Op == 0x10 {
+			b.WriteByte(in.Op)
+			leb128.WriteVarUint32(&b, index(in.Index))
+			continue
+		}
+		b.Write(body[in.Start:in.End])
+	}
+	if ir.Err() != nil {
+		return nil, ir.Err()
+	}
+	return b.Bytes(), nil
+}
+
+// indices returns the mapping of the function indices of the original module
+// to those of the module in its current state, and the number of functions.
+func (o *wasmOptimizer) indices() (func(uint32) uint32, uint32) {
+	m := o.module
+	indices := make([]uint32, len(m.Codes))
+	n := uint32(m.NumImportedFuncs)
+	for i, live := range o.live {
+		indices[i] = n
+		if live {
+			n++
+		}
+	}
+	newIndex := func(index uint32) uint32 {
+		index = o.resolve(index)
+		if int(index) < m.NumImportedFuncs {
+			return index
+		}
+		return indices[int(index)-m.NumImportedFuncs]
+	}
+	return newIndex, n
+}
+
+// encode writes the module in its current state.
+func (o *wasmOptimizer) encode() ([]byte, error) {
+	m := o.module
+	newIndex, n := o.indices()
+
+	out := bytes.NewBuffer(make([]byte, 0, len(o.data)))
+	out.Write(o.data[:8])
+	writeSection := func(id byte, content []byte) {
+		out.WriteByte(id)
+		leb128.WriteVarUint32(out, uint32(len(content)))
+		out.Write(content)
+	}
+	for _, section := range m.Sections {
+		var s bytes.Buffer
+		switch section.ID {
+		case wasmfile.SectionCustom:
+			continue
+		case wasmfile.SectionFunction:
+			leb128.WriteVarUint32(&s, n-uint32(m.NumImportedFuncs))
+			for i, typ := range m.Funcs {
+				if o.live[i] {
+					leb128.WriteVarUint32(&s, typ)
+				}
+			}
+		case wasmfile.SectionExport:
+			leb128.WriteVarUint32(&s, uint32(len(m.Exports)))
+			for _, export := range m.Exports {
+				index := export.Index
+				if export.Kind == wasmfile.ExternalFunction {
+					index = newIndex(index)
+				}
+				writeWasmName(&s, export.Name)
+				s.WriteByte(export.Kind)
+				leb128.WriteVarUint32(&s, index)
+			}
+		case wasmfile.SectionStart:
+			leb128.WriteVarUint32(&s, newIndex(*m.Start))
+		case wasmfile.SectionElement:
+			if len(o.elements) == 0 {
+				continue
+			}
+			leb128.WriteVarUint32(&s, uint32(len(o.elements)))
+			for _, e := range o.elements {
+				s.WriteByte(0) // flags
+				if err := writeWasmInitExpr(&s, e.Offset); err != nil {
+					return nil, err
+				}
+				leb128.WriteVarUint32(&s, uint32(len(e.Functions)))
+				for _, f := range e.Functions {
+					leb128.WriteVarUint32(&s, newIndex(f))
+				}
+			}
+		case wasmfile.SectionCode:
+			leb128.WriteVarUint32(&s, n-uint32(m.NumImportedFuncs))
+			for i, code := range m.Codes {
+				if !o.live[i] {
+					continue
+				}
+				body, err := o.rewriteCalls(code.Body, newIndex)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", m.FuncName(uint32(m.NumImportedFuncs+i)), err)
+				}
+				var fn bytes.Buffer
+				leb128.WriteVarUint32(&fn, uint32(len(code.Locals)))
+				for _, local := range code.Locals {
+					leb128.WriteVarUint32(&fn, local.Count)
+					fn.WriteByte(local.Type)
+				}
+				fn.Write(body)
+				leb128.WriteVarUint32(&s, uint32(fn.Len()))
+				s.Write(fn.Bytes())
+			}
+		case wasmfile.SectionData:
+			leb128.WriteVarUint32(&s, uint32(len(o.segments)))
+			for _, d := range o.segments {
+				leb128.WriteVarUint32(&s, d.Flags)
+				if d.Flags == 2 {
+					s.WriteByte(0) // memory index
+				}
+				if d.Flags != 1 {
+					if err := writeWasmInitExpr(&s, d.Offset); err != nil {
+						return nil, err
+					}
+				}
+				leb128.WriteVarUint32(&s, uint32(len(d.Data)))
+				s.Write(d.Data)
+			}
+		case wasmfile.SectionDataCount:
+			leb128.WriteVarUint32(&s, uint32(len(o.segments)))
+		default:
+			s.Write(o.data[section.Start:section.End])
+		}
+		writeSection(section.ID, s.Bytes())
+	}
+	return out.Bytes(), nil
+}
+
+// writeWasmName writes the name of an import or export.
+func writeWasmName(w *bytes.Buffer, name string) {
+	leb128.WriteVarUint32(w, uint32(len(name)))
+	w.WriteString(name)
+}
+
+// writeWasmInitExpr writes the offset of an element or data segment, which is
+// an i32.const or a global.get.
+func writeWasmInitExpr(w *bytes.Buffer, e wasmfile.InitExpr) error {
+	w.WriteByte(e.Op)
+	switch e.Op {
+	case 0x41: // i32.const
+		leb128.WriteVarint64(w, e.Value)
+	case 0x23: // global.get
+		leb128.WriteVarUint32(w, uint32(e.Value))
+	default:
+		return fmt.Errorf("unsupported instruction 0x%02x in a segment offset", e.Op)
+	}
+	w.WriteByte(0x0b) // end
+	return nil
+}
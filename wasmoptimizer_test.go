@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/wasmfile"
+	"github.com/tinygo-org/tinygo/wasmfile/wasmtest"
+)
+
+func TestOptimizeEosioWasm(t *testing.T) {
+	data := append([]byte("head"), make([]byte, 20)...)
+	data = append(data, "tail"...)
+	data = append(data, make([]byte, 5)...)
+	module := wasmtest.Module(
+		wasmtest.Section(wasmfile.SectionType, wasmtest.Vec([]byte{0x60, 0, 0})),
+		wasmtest.Section(wasmfile.SectionImport, wasmtest.Vec(wasmtest.ImportFunc("env", "prints", 0))),
+		wasmtest.Section(wasmfile.SectionFunction, wasmtest.Vec([]byte{0}, []byte{0}, []byte{0}, []byte{0}, []byte{0})),
+		wasmtest.Section(wasmfile.SectionTable, wasmtest.Vec([]byte{0x70, 0, 2})),
+		wasmtest.Section(wasmfile.SectionMemory, wasmtest.Vec([]byte{0, 1})),
+		wasmtest.Section(wasmfile.SectionExport, wasmtest.Vec(append(wasmtest.Name("apply"), wasmfile.ExternalFunction, 1))),
+		wasmtest.Section(wasmfile.SectionElement, wasmtest.Vec([]byte{0, 0x41, 1, 0x0b, 1, 5})),
+		wasmtest.Section(wasmfile.SectionCode, wasmtest.Vec(
+			wasmtest.Function([]byte{0}, 0x10, 2, 0x10, 3, 0x0b), // apply
+			wasmtest.Function([]byte{0}, 0x10, 0, 0x0b),          // print
+			wasmtest.Function([]byte{0}, 0x10, 0, 0x0b),          // print2, same as print
+			wasmtest.Function([]byte{0}, 0x0b),                   // unused
+			wasmtest.Function([]byte{0}, 0x0b),                   // table
+		)),
+		wasmtest.Section(wasmfile.SectionData, wasmtest.Vec(append([]byte{0, 0x41, 0x80, 0x08, 0x0b}, wasmtest.Name("\x00\x00"+string(data))...))),
+		wasmtest.Section(wasmfile.SectionCustom, wasmtest.Names("prints", "apply", "print", "print2", "unused", "table")),
+	)
+
+	result, steps, names, err := optimizeEosioWasm(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := 0
+	for _, step := range steps {
+		if step.Saved < 0 {
+			t.Errorf("step %s made the module larger", step.Name)
+		}
+		saved += step.Saved
+	}
+	if saved != len(module)-len(result) {
+		t.Errorf("steps saved %d bytes in total, expected %d", saved, len(module)-len(result))
+	}
+	if violations, err := validateEosioWasm(result, false); err != nil || len(violations) != 0 {
+		t.Fatalf("optimized module is invalid: %v %v", err, violations)
+	}
+
+	m, err := wasmfile.Parse(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range m.Sections {
+		if section.ID == wasmfile.SectionCustom {
+			t.Errorf("custom section %q wasn't removed", section.Name)
+		}
+	}
+	// The print functions are merged, and the unused function and the table
+	// are removed as there is no indirect call.
+	if len(m.Codes) != 2 || len(m.Elements) != 0 {
+		t.Fatalf("expected 2 functions and no table entries, got %d and %d", len(m.Codes), len(m.Elements))
+	}
+	if !bytes.Equal(m.Codes[0].Body, []byte{0x10, 2, 0x10, 2, 0x0b}) {
+		t.Errorf("unexpected body of apply: %x", m.Codes[0].Body)
+	}
+	if m.Exports[0].Index != 1 {
+		t.Errorf("apply is exported as function %d", m.Exports[0].Index)
+	}
+	expectedNames := map[uint32][]string{0: {"prints"}, 1: {"apply"}, 2: {"print", "print2"}}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("expected function names %v, got %v", expectedNames, names)
+	}
+	if len(m.Data) != 2 {
+		t.Fatalf("expected two data segments, got %d", len(m.Data))
+	}
+	for i, expected := range []struct {
+		offset int64
+		data   string
+	}{{1026, "head"}, {1050, "tail"}} {
+		if d := m.Data[i]; d.Offset.Value != expected.offset || string(d.Data) != expected.data {
+			t.Errorf("data segment %d is %q at %d, expected %q at %d", i, d.Data, d.Offset.Value, expected.data, expected.offset)
+		}
+	}
+}
+
+func TestOptimizeEosioWasmTable(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		entries int
+	}{
+		// Only the table index 2 is used in the code, so the entry of the
+		// third function at index 3 is removed.
+		{"code", nil, 2},
+		// The data holds the table index 3 at an aligned address.
+		{"data", []byte{0, 0, 0, 0, 3, 0, 0, 0}, 3},
+		// A word at an unaligned address isn't a function pointer, and
+		// neither are the aligned words beyond the table.
+		{"unaligned", []byte{0xff, 3, 0, 0, 0, 0xff, 0xff, 0xff}, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			module := wasmtest.Module(
+				wasmtest.Section(wasmfile.SectionType, wasmtest.Vec([]byte{0x60, 0, 0})),
+				wasmtest.Section(wasmfile.SectionFunction, wasmtest.Vec([]byte{0}, []byte{0}, []byte{0}, []byte{0})),
+				wasmtest.Section(wasmfile.SectionTable, wasmtest.Vec([]byte{0x70, 0, 4})),
+				wasmtest.Section(wasmfile.SectionMemory, wasmtest.Vec([]byte{0, 1})),
+				wasmtest.Section(wasmfile.SectionExport, wasmtest.Vec(append(wasmtest.Name("apply"), wasmfile.ExternalFunction, 0))),
+				wasmtest.Section(wasmfile.SectionElement, wasmtest.Vec([]byte{0, 0x41, 1, 0x0b, 3, 1, 2, 3})),
+				wasmtest.Section(wasmfile.SectionCode, wasmtest.Vec(
+					wasmtest.Function([]byte{0}, 0x41, 2, 0x11, 0, 0, 0x0b), // apply
+					wasmtest.Function([]byte{0}, 0x0b),
+					wasmtest.Function([]byte{0}, 0x01, 0x0b),
+					wasmtest.Function([]byte{0}, 0x01, 0x01, 0x0b),
+				)),
+				wasmtest.Section(wasmfile.SectionData, wasmtest.Vec(append([]byte{0, 0x41, 0x80, 0x08, 0x0b}, wasmtest.Name(string(tc.data))...))),
+			)
+
+			result, _, _, err := optimizeEosioWasm(module)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if violations, err := validateEosioWasm(result, false); err != nil || len(violations) != 0 {
+				t.Fatalf("optimized module is invalid: %v %v", err, violations)
+			}
+			m, err := wasmfile.Parse(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Elements) != 1 || len(m.Elements[0].Functions) != tc.entries {
+				t.Fatalf("expected %d table entries, got %v", tc.entries, m.Elements)
+			}
+			if len(m.Codes) != 1+tc.entries {
+				t.Errorf("expected %d functions, got %d", 1+tc.entries, len(m.Codes))
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/go-interpreter/wagon/wasm/operators"
+	"github.com/tinygo-org/tinygo/wasmfile"
+)
+
+// Limits of the eosio VM, from the wasm constraints of nodeos. setcode fails
+// for modules that exceed them.
+const (
+	eosioMaxPages              = 528 // 33 MiB
+	eosioMaxTableElements      = 1024
+	eosioMaxSectionElements    = 8192
+	eosioMaxLinearMemoryInit   = 64 * 1024
+	eosioMaxFuncLocalBytes     = 8192
+	eosioMaxNestedStructures   = 1024
+	eosioMaxMutableGlobalBytes = 1024
+)
+
+// wasmViolation is a construct of a module that the eosio VM rejects.
+type wasmViolation struct {
+	// Function is the name of the function if the violation is in its body.
+	Function string
+	Message  string
+}
+
+func (v wasmViolation) String() string {
+	if v.Function != "" {
+		return v.Function + ": " + v.Message
+	}
+	return v.Message
+}
+
+// wasmValidationError is returned for a module that can't be deployed to an
+// eosio chain.
+type wasmValidationError struct {
+	File       string
+	Violations []wasmViolation
+}
+
+func (e *wasmValidationError) Error() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "%s can't be deployed to an eosio chain:", e.File)
+	for _, v := range e.Violations {
+		s.WriteString("\n\t" + v.String())
+	}
+	return s.String()
+}
+
+// wasmValidator checks a module against the limits of the eosio VM.
+type wasmValidator struct {
+	module *wasmfile.Module
+	// noFloat rejects floating-point instructions, for chains that require
+	// contracts to use softfloat.
+	noFloat    bool
+	violations []wasmViolation
+}
+
+func (v *wasmValidator) report(function string, format string, args ...interface{}) {
+	v.violations = append(v.violations, wasmViolation{function, fmt.Sprintf(format, args...)})
+}
+
+// validateEosioWasm returns the violations of the limits of the eosio VM in
+// the wasm module data. An error is returned if the module can't be parsed.
+func validateEosioWasm(data []byte, noFloat bool) ([]wasmViolation, error) {
+	m, err := wasmfile.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	v := &wasmValidator{module: m, noFloat: noFloat}
+	v.validateSections()
+	v.validateImports()
+	v.validateMemory()
+	v.validateTables()
+	v.validateGlobals()
+	v.validateExports()
+	v.validateData()
+	if m.Start != nil {
+		v.report("", "start function %s is not allowed", m.FuncName(*m.Start))
+	}
+	for i := range m.Codes {
+		v.validateFunction(uint32(m.NumImportedFuncs + i))
+	}
+	return v.violations, nil
+}
+
+// checkEosioWasmFile validates the wasm file for the eosio VM. It returns a
+// *wasmValidationError with all violations.
+func checkEosioWasmFile(file string, noFloat bool) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	violations, err := validateEosioWasm(data, noFloat)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if len(violations) != 0 {
+		return &wasmValidationError{File: file, Violations: violations}
+	}
+	return nil
+}
+
+func (v *wasmValidator) validateSections() {
+	m := v.module
+	counts := map[byte]int{
+		wasmfile.SectionType:     len(m.Types),
+		wasmfile.SectionImport:   len(m.Imports),
+		wasmfile.SectionFunction: len(m.Funcs),
+		wasmfile.SectionGlobal:   len(m.Globals),
+		wasmfile.SectionExport:   len(m.Exports),
+		wasmfile.SectionElement:  len(m.Elements),
+		wasmfile.SectionData:     len(m.Data),
+	}
+	for _, section := range m.Sections {
+		if n := counts[section.ID]; n > eosioMaxSectionElements {
+			v.report("", "%s section has %d entries, the maximum is %d", wasmfile.SectionName(section.ID), n, eosioMaxSectionElements)
+		}
+		if section.ID == wasmfile.SectionDataCount {
+			v.report("", "data count section needs the bulk memory proposal")
+		}
+	}
+}
+
+func (v *wasmValidator) validateImports() {
+	for _, imp := range v.module.Imports {
+		if imp.Kind != wasmfile.ExternalFunction {
+			v.report("", "import of %s %s.%s is not allowed, only functions can be imported", wasmfile.KindName(imp.Kind), imp.Module, imp.Name)
+		}
+	}
+}
+
+func (v *wasmValidator) validateMemory() {
+	m := v.module
+	if len(m.Memories) > 1 {
+		v.report("", "%d memories are defined, at most one is allowed", len(m.Memories))
+	}
+	for _, mem := range m.Memories {
+		if mem.Initial > eosioMaxPages {
+			v.report("", "memory has %d initial pages, the maximum is %d", mem.Initial, eosioMaxPages)
+		}
+		if mem.HasMax && mem.Maximum > eosioMaxPages {
+			v.report("", "memory has a maximum of %d pages, the maximum is %d", mem.Maximum, eosioMaxPages)
+		}
+	}
+}
+
+func (v *wasmValidator) validateTables() {
+	m := v.module
+	if len(m.Tables) > 1 {
+		v.report("", "%d tables are defined, at most one is allowed", len(m.Tables))
+	}
+	for _, table := range m.Tables {
+		if table.Initial > eosioMaxTableElements {
+			v.report("", "table has %d elements, the maximum is %d", table.Initial, eosioMaxTableElements)
+		}
+		if table.HasMax && table.Maximum > eosioMaxTableElements {
+			v.report("", "table has a maximum of %d elements, the maximum is %d", table.Maximum, eosioMaxTableElements)
+		}
+	}
+	for i, e := range m.Elements {
+		if e.Offset.Op != 0x41 {
+			v.report("", "element segment %d has an offset that is not an i32.const", i)
+			continue
+		}
+		if end := e.Offset.Value + int64(len(e.Functions)); e.Offset.Value < 0 || end > eosioMaxTableElements {
+			v.report("", "element segment %d ends at table element %d, the maximum is %d", i, end, eosioMaxTableElements)
+		}
+	}
+}
+
+func (v *wasmValidator) validateGlobals() {
+	size := 0
+	for _, g := range v.module.Globals {
+		if g.Mutable {
+			size += wasmfile.ValueSize(g.Type)
+		}
+	}
+	if size > eosioMaxMutableGlobalBytes {
+		v.report("", "mutable globals use %d bytes, the maximum is %d", size, eosioMaxMutableGlobalBytes)
+	}
+}
+
+func (v *wasmValidator) validateExports() {
+	m := v.module
+	for _, export := range m.Exports {
+		if export.Kind != wasmfile.ExternalGlobal {
+			continue
+		}
+		index := int(export.Index) - m.NumImportedGlobals
+		if index >= 0 && index < len(m.Globals) && m.Globals[index].Mutable {
+			v.report("", "export %s of a mutable global is not allowed", export.Name)
+		}
+	}
+}
+
+func (v *wasmValidator) validateData() {
+	m := v.module
+	for i, d := range m.Data {
+		if d.Flags != 0 {
+			v.report("", "data segment %d is passive or has a memory index, which needs the bulk memory proposal", i)
+			continue
+		}
+		if d.Offset.Op != 0x41 {
+			v.report("", "data segment %d has an offset that is not an i32.const", i)
+			continue
+		}
+		end := d.Offset.Value + int64(len(d.Data))
+		if d.Offset.Value < 0 || end > eosioMaxLinearMemoryInit {
+			v.report("", "data segment %d ends at offset %d, but only the first %d bytes of memory can be initialized", i, end, eosioMaxLinearMemoryInit)
+		} else if len(m.Memories) != 0 && end > int64(m.Memories[0].Initial)*65536 {
+			v.report("", "data segment %d ends at offset %d, after the end of the initial memory", i, end)
+		}
+	}
+}
+
+// wasmFeature returns the proposal that introduced the instruction.
+func wasmFeature(in wasmfile.Instruction) string {
+	switch op := in.Op; {
+	case op >= 0xc0 && op <= 0xc4:
+		return "sign extension"
+	case op == 0xfc && in.Sub <= 7:
+		return "non-trapping float-to-int conversion"
+	case op == 0xfc:
+		return "bulk memory"
+	case op == 0xfd:
+		return "SIMD"
+	case op == 0xfe:
+		return "threads"
+	case op == 0x1c || op == 0x25 || op == 0x26 || op >= 0xd0 && op <= 0xd2:
+		return "reference types"
+	case op >= 0x06 && op <= 0x09 || op == 0x18 || op == 0x19:
+		return "exception handling"
+	case op == 0x12 || op == 0x13:
+		return "tail call"
+	}
+	return "unknown"
+}
+
+// isFloatOperator reports whether the MVP instruction op takes or produces
+// floating-point values.
+func isFloatOperator(op operators.Op) bool {
+	isFloat := func(t wasm.ValueType) bool {
+		return t == wasm.ValueTypeF32 || t == wasm.ValueTypeF64
+	}
+	for _, t := range op.Args {
+		if isFloat(t) {
+			return true
+		}
+	}
+	return isFloat(op.Returns)
+}
+
+// validateFunction checks the locals and the instructions of the function
+// with index in the function index space.
+func (v *wasmValidator) validateFunction(index uint32) {
+	m := v.module
+	name := m.FuncName(index)
+	code := m.Codes[int(index)-m.NumImportedFuncs]
+
+	size := 0
+	if typ, ok := m.FuncType(index); ok {
+		for _, t := range typ.Params {
+			size += wasmfile.ValueSize(t)
+		}
+	}
+	for _, local := range code.Locals {
+		size += int(local.Count) * wasmfile.ValueSize(local.Type)
+	}
+	if size > eosioMaxFuncLocalBytes {
+		v.report(name, "parameters and locals use %d bytes, the maximum is %d", size, eosioMaxFuncLocalBytes)
+	}
+
+	depth := 0
+	depthReported, floatReported := false, false
+	ir := wasmfile.NewInstructionReader(code.Body)
+	for !ir.Done() {
+		in := ir.Next()
+		if !wasmfile.IsMVPOpcode(in.Op) {
+			// The immediates of unknown instructions can't be skipped, so
+			// the rest of the function isn't checked.
+			v.report(name, "instruction 0x%02x of the %s proposal is not supported", in.Op, wasmFeature(in))
+			return
+		}
+		if ir.Err() != nil {
+			v.report(name, "invalid function body: %v", ir.Err())
+			return
+		}
+		switch in.Op {
+		case 0x02, 0x03, 0x04: // block, loop, if
+			switch in.BlockType {
+			case -0x40, -0x01, -0x02, -0x03, -0x04: // empty or a single value
+			default:
+				v.report(name, "block type %d needs the multi-value proposal", in.BlockType)
+				return
+			}
+			depth++
+			if depth > eosioMaxNestedStructures && !depthReported {
+				v.report(name, "blocks are nested more than %d levels deep", eosioMaxNestedStructures)
+				depthReported = true
+			}
+		case 0x0b: // end
+			depth--
+		case 0x11, 0x3f, 0x40: // call_indirect, memory.size, memory.grow
+			if in.Reserved != 0 {
+				v.report(name, "instruction 0x%02x with a non-zero table or memory index needs the reference types or multi-memory proposal", in.Op)
+			}
+		}
+		if v.noFloat && !floatReported {
+			if op, err := operators.New(in.Op); err == nil && isFloatOperator(op) {
+				v.report(name, "floating-point instruction %s is not allowed, the chain requires softfloat", op.Name)
+				floatReported = true
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/wasmfile"
+	"github.com/tinygo-org/tinygo/wasmfile/wasmtest"
+)
+
+func TestValidateEosioWasm(t *testing.T) {
+	valid := wasmtest.Module(
+		wasmtest.Section(wasmfile.SectionType, wasmtest.Vec([]byte{0x60, 3, wasmfile.I64, wasmfile.I64, wasmfile.I64, 0})),
+		wasmtest.Section(wasmfile.SectionFunction, wasmtest.Vec([]byte{0})),
+		wasmtest.Section(wasmfile.SectionMemory, wasmtest.Vec([]byte{0, 1})),
+		wasmtest.Section(wasmfile.SectionExport, wasmtest.Vec(append(wasmtest.Name("apply"), wasmfile.ExternalFunction, 0))),
+		wasmtest.Section(wasmfile.SectionCode, wasmtest.Vec(wasmtest.Function([]byte{0}, 0x02, 0x40, 0x03, 0x40, 0x0b, 0x0b, 0x0b))),
+		wasmtest.Section(wasmfile.SectionData, wasmtest.Vec(append([]byte{0, 0x41, 0x10, 0x0b}, wasmtest.Name("data")...))),
+		wasmtest.Section(wasmfile.SectionCustom, wasmtest.Names("apply")),
+	)
+	violations, err := validateEosioWasm(valid, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 0 {
+		t.Errorf("unexpected violations: %v", violations)
+	}
+
+	invalid := wasmtest.Module(
+		wasmtest.Section(wasmfile.SectionType, wasmtest.Vec([]byte{0x60, 0, 0})),
+		wasmtest.Section(wasmfile.SectionImport, wasmtest.Vec(append(append(wasmtest.Name("env"), wasmtest.Name("memory")...), wasmfile.ExternalMemory, 0, 1))),
+		wasmtest.Section(wasmfile.SectionFunction, wasmtest.Vec([]byte{0}, []byte{0}, []byte{0}, []byte{0})),
+		wasmtest.Section(wasmfile.SectionTable, wasmtest.Vec([]byte{0x70, 0, 0xd0, 0x0f})),
+		wasmtest.Section(wasmfile.SectionMemory, wasmtest.Vec([]byte{0, 0xd8, 0x04})),
+		wasmtest.Section(wasmfile.SectionGlobal, wasmtest.Vec([]byte{wasmfile.I32, 1, 0x41, 0, 0x0b})),
+		wasmtest.Section(wasmfile.SectionExport, wasmtest.Vec(append(wasmtest.Name("counter"), wasmfile.ExternalGlobal, 0))),
+		wasmtest.Section(wasmfile.SectionStart, []byte{0}),
+		wasmtest.Section(wasmfile.SectionCode, wasmtest.Vec(
+			wasmtest.Function([]byte{0}, 0x0b),
+			wasmtest.Function([]byte{1, 0xb8, 0x17, wasmfile.I32}, 0x0b),
+			wasmtest.Function([]byte{0}, 0x41, 0, 0x41, 0, 0x41, 0, 0xfc, 0x0a, 0, 0, 0x0b),
+			wasmtest.Function([]byte{0}, 0x44, 0, 0, 0, 0, 0, 0, 0, 0, 0x1a, 0x0b),
+		)),
+		wasmtest.Section(wasmfile.SectionData, wasmtest.Vec(append([]byte{0, 0x41, 0xff, 0xff, 0x03, 0x0b}, wasmtest.Name("data")...))),
+		wasmtest.Section(wasmfile.SectionCustom, wasmtest.Names("init", "locals", "copy", "float")),
+	)
+	violations, err = validateEosioWasm(invalid, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, v := range violations {
+		messages = append(messages, v.String())
+	}
+	expected := []string{
+		"import of memory env.memory is not allowed, only functions can be imported",
+		"memory has 600 initial pages, the maximum is 528",
+		"table has 2000 elements, the maximum is 1024",
+		"export counter of a mutable global is not allowed",
+		"data segment 0 ends at offset 65539, but only the first 65536 bytes of memory can be initialized",
+		"start function init is not allowed",
+		"locals: parameters and locals use 12000 bytes, the maximum is 8192",
+		"copy: instruction 0xfc of the bulk memory proposal is not supported",
+		"float: floating-point instruction f64.const is not allowed, the chain requires softfloat",
+	}
+	if got := strings.Join(messages, "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("unexpected violations:\n%s\nexpected:\n%s", got, strings.Join(expected, "\n"))
+	}
+
+	if _, err := validateEosioWasm([]byte("\x00asm\x01\x00\x00\x00\x01\x05\x01"), false); err == nil {
+		t.Error("expected an error for a truncated module")
+	}
+}